@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hetznercloud/csi-driver/internal/config"
+)
+
+const configUsage = `Usage: %s config [flags]
+
+Validate the configuration and print the effective configuration with the
+secrets redacted. The config file is read from the path in the CONFIG_FILE env
+var, the environment variables override its settings.
+
+Flags:
+`
+
+// runConfig runs the config subcommand and returns the exit code.
+func runConfig(args []string) int {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, configUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	file := flags.String("file", os.Getenv(config.FileEnv), "Path of the config file.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err)
+		return 1
+	}
+	for _, warning := range cfg.Warnings() {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	data, err := cfg.Dump()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to print configuration: %s\n", err)
+		return 1
+	}
+	_, _ = os.Stdout.Write(data)
+	return 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/doctor"
+	"github.com/hetznercloud/csi-driver/internal/driver"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/metadata"
+)
+
+const doctorUsage = `Usage: %s doctor [flags]
+
+Check the prerequisites of the node plugin on this server: kernel modules,
+binaries, the XFS config, mount propagation of the kubelet dir and access to
+the metadata service.
+
+Flags:
+`
+
+// runDoctor runs the doctor subcommand and returns the exit code. Like the
+// config subcommand, it runs before the config is loaded, so that it also
+// checks nodes with an invalid config.
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, doctorUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	output := flags.String("output", "text", "Output format, text or json.")
+	kubeletDir := flags.String("kubelet-dir", "/var/lib/kubelet", "Directory, below which volumes are published.")
+	timeout := flags.Duration("timeout", 30*time.Second, "Timeout of all checks.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	write := doctor.WriteText
+	switch *output {
+	case "text":
+	case "json":
+		write = doctor.WriteJSON
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	metadataClient := metadata.NewClient(
+		metadata.WithApplication("csi-driver", driver.PluginVersion),
+		metadata.WithTimeout(5*time.Second),
+	)
+
+	results := doctor.Run(ctx, doctor.NodeChecks(metadataClient, *kubeletDir))
+	if err := write(os.Stdout, results); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write report: %s\n", err)
+		return 1
+	}
+	if !doctor.Passed(results) {
+		return 1
+	}
+	return 0
+}
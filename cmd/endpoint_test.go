@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	proto "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/hetznercloud/csi-driver/internal/app"
+	"github.com/hetznercloud/csi-driver/internal/config"
+	"github.com/hetznercloud/csi-driver/internal/driver"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1, which is used
+// by the server and the client and trusted as CA.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string, cert tls.Certificate, pool *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "csi"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	pool = x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return certFile, keyFile, cert, pool
+}
+
+func TestTCPEndpointRequiresClientCertificate(t *testing.T) {
+	certFile, keyFile, cert, pool := writeTestCert(t, t.TempDir())
+	cfg := &config.Config{
+		CSIEndpoint: "tcp://127.0.0.1:0",
+		CSITLS:      config.CSITLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: certFile},
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	listener, err := app.CreateListener(cfg)
+	require.NoError(t, err)
+	grpcCredentials, err := app.CreateGRPCServerCredentials(logger, cfg)
+	require.NoError(t, err)
+
+	passthrough := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(ctx, req)
+	}
+	grpcServer := app.CreateGRPCServer(logger, passthrough, grpcCredentials...)
+	identityService := driver.NewIdentityService(logger)
+	identityService.SetReady(true)
+	proto.RegisterIdentityServer(grpcServer, identityService)
+	go func() { _ = grpcServer.Serve(listener) }()
+	defer grpcServer.Stop()
+
+	probe := func(tlsConfig *tls.Config) error {
+		conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = proto.NewIdentityClient(conn).Probe(t.Context(), &proto.ProbeRequest{})
+		return err
+	}
+
+	require.NoError(t, probe(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool, Certificates: []tls.Certificate{cert}}))
+	assert.Error(t, probe(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}))
+}
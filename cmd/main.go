@@ -2,28 +2,68 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	proto "github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc"
 
 	"github.com/hetznercloud/csi-driver/internal/app"
+	"github.com/hetznercloud/csi-driver/internal/audit"
+	"github.com/hetznercloud/csi-driver/internal/config"
+	"github.com/hetznercloud/csi-driver/internal/credentials"
 	"github.com/hetznercloud/csi-driver/internal/driver"
 	"github.com/hetznercloud/csi-driver/internal/metrics"
-	"github.com/hetznercloud/csi-driver/internal/utils"
+	"github.com/hetznercloud/csi-driver/internal/ratelimit"
 	"github.com/hetznercloud/csi-driver/internal/volsrv"
 	"github.com/hetznercloud/csi-driver/internal/volumes"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/metadata"
 )
 
+// healthCheckCacheTTL limits how often the health checks, which use the API
+// rate limit or run commands, are run by the Probe calls of the liveness probe.
+const healthCheckCacheTTL = time.Minute
+
 func main() {
 	var controller, node bool
 
-	logger := app.CreateLogger()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:]))
+	}
+
+	configFile := os.Getenv(config.FileEnv)
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger, logLevels, err := app.CreateLogger(cfg)
+	if err != nil {
+		slog.Error("invalid log configuration", "error", err)
+		os.Exit(1)
+	}
+	for _, warning := range cfg.Warnings() {
+		logger.Warn(warning)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(logger, cfg, os.Args[2:]))
+	}
 
 	flag.BoolVar(
 		&controller,
@@ -50,69 +90,154 @@ func main() {
 
 	app.SetupCoverageSignalHandler(logger)
 
-	m := app.CreateMetrics(logger)
+	// The context is canceled on SIGTERM, which starts the graceful shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := app.SetupTracing(ctx, logger)
+	if err != nil {
+		logger.Error("failed to setup tracing", "error", err)
+		os.Exit(1)
+	}
+
+	configWatcher := config.NewWatcher(logger.With("component", "config-watcher"), configFile, cfg)
+	configWatcher.Subscribe(func(cfg *config.Config) {
+		if err := app.ApplyLogConfig(logLevels, cfg); err != nil {
+			logger.Error("failed to apply the reloaded log config", "error", err)
+		}
+	})
+
+	m, err := app.CreateMetrics(logger, cfg)
+	if err != nil {
+		logger.Error("failed to serve metrics", "error", err)
+		os.Exit(1)
+	}
+	m.HandleAuthenticated("/loglevel", logLevels)
+	m.HandleAuthenticated("/config", configWatcher)
 
 	metadataClient := metadata.NewClient(
 		metadata.WithApplication("csi-driver", driver.PluginVersion),
 		metadata.WithInstrumentation(m.Registry()),
 	)
 
-	listener, err := app.CreateListener()
+	listener, err := app.CreateListener(cfg)
 	if err != nil {
 		logger.Error("failed to create listener", "error", err)
 		os.Exit(1)
 	}
 
+	grpcCredentials, err := app.CreateGRPCServerCredentials(logger.With("component", "csi-endpoint-tls"), cfg)
+	if err != nil {
+		logger.Error("failed to create CSI endpoint credentials", "error", err)
+		os.Exit(1)
+	}
+
 	grpcServer := app.CreateGRPCServer(
 		logger.With("component", "grpc-server"),
 		m.UnaryServerInterceptor(),
+		grpcCredentials...,
 	)
 
-	if err := setup(logger, controller, node, grpcServer, m, metadataClient); err != nil {
+	var auditLog *audit.Logger
+	if controller {
+		auditLog, err = app.CreateAuditLogger(logger.With("component", "audit-log"), cfg)
+		if err != nil {
+			logger.Error("failed to create audit log", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	identityService, err := setup(ctx, logger, configWatcher, controller, node, grpcServer, m, metadataClient, auditLog)
+	if err != nil {
 		logger.Error("failed to setup CSI driver", "error", err)
 		os.Exit(1)
 	}
 
-	if err := grpcServer.Serve(listener); err != nil {
+	go configWatcher.Run(ctx, config.DefaultWatchInterval)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- grpcServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
 		logger.Error("failed to run CSI driver", "error", err)
 		os.Exit(1)
+	case <-ctx.Done():
 	}
+
+	// A second signal terminates the process immediately.
+	stop()
+	shutdown(logger, cfg, identityService, grpcServer, m, auditLog, shutdownTracing)
 }
 
+// setup registers the CSI services on the gRPC server. Background work stops,
+// when the context is canceled.
 func setup(
+	ctx context.Context,
 	logger *slog.Logger,
+	configWatcher *config.Watcher,
 	controller, node bool,
 	grpcServer *grpc.Server,
 	m *metrics.Metrics,
 	metadataClient *metadata.Client,
-) error {
-	ctx := context.Background()
-	enableProvidedByTopology := app.GetEnableProvidedByTopology()
+	auditLog *audit.Logger,
+) (*driver.IdentityService, error) {
+	cfg := configWatcher.Current()
 
 	if !metadataClient.IsHcloudServerWithContext(ctx) {
 		logger.Warn("unable to connect to the metadata service")
 	}
 
+	// The health checks run on every Probe, the expensive ones are cached.
+	var healthChecks []driver.HealthCheck
+
 	if node {
-		location, err := app.GetServerLocation(ctx, logger, metadataClient, nil, false)
+		location, err := app.GetServerLocation(ctx, logger, cfg, metadataClient, nil, false)
 		if err != nil {
-			return fmt.Errorf("could not determine default volume location: %w", err)
+			return nil, fmt.Errorf("could not determine default volume location: %w", err)
 		}
 
 		serverID, err := metadataClient.InstanceIDWithContext(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to fetch server ID from metadata service: %w", err)
+			return nil, fmt.Errorf("failed to fetch server ID from metadata service: %w", err)
 		}
 
-		volumeMountService := volumes.NewLinuxMountService(logger.With("component", "linux-mount-service"))
-		volumeResizeService := volumes.NewLinuxResizeService(logger.With("component", "linux-resize-service"))
+		var networkZone string
+		if cfg.Topology.EnableNetworkZone {
+			networkZone, err = app.GetNetworkZoneFromMetadata(ctx, logger, metadataClient)
+			if err != nil {
+				return nil, fmt.Errorf("could not determine network zone: %w", err)
+			}
+		}
+
+		volumeMountService := volumes.NewLinuxMountService(logger.With("component", "linux-mount-service"), m)
+		volumeResizeService := volumes.NewLinuxResizeService(logger.With("component", "linux-resize-service"), m)
 		volumeStatsService := volumes.NewLinuxStatsService(logger.With("component", "linux-stats-service"))
 
+		m.RegisterAttachedVolumes(volumes.CountAttachedVolumes, driver.MaxVolumesPerNode)
+
+		healthChecks = append(healthChecks,
+			driver.NewMetadataHealthCheck(metadataClient),
+			driver.NewCachedHealthCheck(driver.NewToolsHealthCheck(logger.With("component", "driver-health-check")), healthCheckCacheTTL),
+		)
+
+		if cfg.Volume.UsageScanInterval > 0 {
+			usageScanner := volumes.NewUsageScanner(
+				logger.With("component", "volume-usage-scanner"),
+				volumeStatsService,
+				m,
+			)
+			go usageScanner.Run(ctx, cfg.Volume.UsageScanInterval)
+		}
+
 		nodeService := driver.NewNodeService(
 			logger.With("component", "driver-node-service"),
 			strconv.FormatInt(serverID, 10),
 			location,
-			enableProvidedByTopology,
+			networkZone,
+			cfg.Topology.EnableProvidedBy,
 			volumeMountService,
 			volumeResizeService,
 			volumeStatsService,
@@ -122,51 +247,206 @@ func setup(
 	}
 
 	if controller {
-		hcloudClient, err := app.CreateHcloudClient(m.Registry(), logger)
+		rateLimitGovernor := ratelimit.NewGovernor(logger.With("component", "rate-limit-governor"), m)
+
+		token, err := app.LoadToken(logger, cfg, m)
 		if err != nil {
-			return fmt.Errorf("failed to initialize hcloud client: %w", err)
+			return nil, fmt.Errorf("failed to initialize hcloud client: %w", err)
 		}
+		go token.Run(ctx, credentials.DefaultReloadInterval)
+		hcloudClient := app.CreateHcloudClient(cfg, token, m.Registry(), logger, rateLimitGovernor)
 
-		location, err := app.GetServerLocation(ctx, logger, metadataClient, hcloudClient, true)
+		healthChecks = append(healthChecks, driver.NewCachedHealthCheck(driver.NewAPIHealthCheck(hcloudClient), healthCheckCacheTTL))
+
+		location, err := app.GetServerLocation(ctx, logger, cfg, metadataClient, hcloudClient, true)
 		if err != nil {
-			return fmt.Errorf("could not determine default volume location: %w", err)
+			return nil, fmt.Errorf("could not determine default volume location: %w", err)
 		}
 
 		logger.Info("resolved default volume location", "location", location)
 
-		extraVolumeLabels, err := utils.ConvertLabelsToMap(os.Getenv("HCLOUD_VOLUME_EXTRA_LABELS"))
+		if cfg.DryRun {
+			logger.Warn("running in dry-run mode, changes to volumes are not sent to the API")
+		}
+
+		volumeService, err := createVolumeService(ctx, logger, cfg, "", hcloudClient, auditLog, m)
 		if err != nil {
-			return fmt.Errorf("could not parse extra labels for volumes: %w", err)
+			return nil, err
+		}
+
+		var parameterSource driver.VolumeParameterSource
+		if cfg.Volume.LabelReconcileInterval > 0 {
+			parameterSource, err = app.CreateVolumeParameterSource(logger.With("component", "driver-label-reconciler"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize label reconciler: %w", err)
+			}
 		}
 
-		volumeService := volumes.NewIdempotentService(
-			logger.With("component", "idempotent-volume-service"),
-			volsrv.NewVolumeService(
-				logger.With("component", "api-volume-service"),
-				hcloudClient,
+		labelReconcilers := []*driver.LabelReconciler{
+			driver.NewLabelReconciler(
+				logger.With("component", "driver-label-reconciler"),
+				"",
+				volumeService,
+				parameterSource,
+				cfg.Volume.ExtraLabels,
 			),
-		)
+		}
 
 		controllerService := driver.NewControllerService(
 			logger.With("component", "driver-controller-service"),
 			volumeService,
 			location,
-			enableProvidedByTopology,
-			extraVolumeLabels,
+			cfg.Topology.EnableProvidedBy,
+			cfg.Topology.EnableNetworkZone,
+			cfg.Volume.ExtraLabels,
+			app.GetVolumeQuota(cfg),
 		)
 
+		for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+			profileLogger := logger.With("profile", name)
+			profileClient, profileToken, err := app.CreateProfileHcloudClient(
+				cfg, name, m.Registry(), profileLogger,
+				ratelimit.NewGovernor(profileLogger.With("component", "rate-limit-governor"), m.ProfileRateLimit(name)),
+				m.ProfileToken(name),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize hcloud client of profile %s: %w", name, err)
+			}
+			go profileToken.Run(ctx, credentials.DefaultReloadInterval)
+
+			profileVolumeService, err := createVolumeService(ctx, profileLogger, cfg, name, profileClient, auditLog, m)
+			if err != nil {
+				return nil, err
+			}
+			controllerService.AddProfile(driver.Profile{
+				Name:          name,
+				VolumeService: profileVolumeService,
+				Location:      cfg.Profiles[name].DefaultLocation,
+				VolumeQuota:   app.GetProfileVolumeQuota(cfg, name),
+			})
+			labelReconcilers = append(labelReconcilers, driver.NewLabelReconciler(
+				profileLogger.With("component", "driver-label-reconciler"),
+				name,
+				profileVolumeService,
+				parameterSource,
+				cfg.Volume.ExtraLabels,
+			))
+			logger.Info("added project profile", "profile", name, "location", cfg.Profiles[name].DefaultLocation)
+		}
+
+		// Background work only runs on the leader, while all replicas serve
+		// gRPC requests. It has stopped, when onLeading returns.
+		onLeading := func(ctx context.Context) {
+			var wg sync.WaitGroup
+			if cfg.Volume.LabelReconcileInterval > 0 {
+				for _, labelReconciler := range labelReconcilers {
+					wg.Go(func() {
+						labelReconciler.Run(ctx, cfg.Volume.LabelReconcileInterval)
+					})
+				}
+			}
+			wg.Wait()
+		}
+
+		leaderElector, err := app.CreateLeaderElector(logger.With("component", "leader-elector"), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize leader election: %w", err)
+		}
+		if leaderElector != nil {
+			go leaderElector.Run(ctx, onLeading)
+		} else {
+			go onLeading(ctx)
+		}
+
 		proto.RegisterControllerServer(grpcServer, controllerService)
+
+		// The token and the extra volume labels are applied at runtime, the
+		// other settings require a restart. A token file is reloaded by the
+		// token itself.
+		configWatcher.Subscribe(func(cfg *config.Config) {
+			if cfg.TokenFile == "" && cfg.Token != "" && token.Set(string(cfg.Token)) {
+				logger.Info("reloaded API token", "generation", token.Generation())
+			}
+			controllerService.SetExtraVolumeLabels(cfg.Volume.ExtraLabels)
+			for _, labelReconciler := range labelReconcilers {
+				labelReconciler.SetExtraVolumeLabels(cfg.Volume.ExtraLabels)
+			}
+		})
 	}
 
 	identityService := driver.NewIdentityService(
 		logger.With("component", "driver-identity-service"),
+		healthChecks...,
 	)
 
 	proto.RegisterIdentityServer(grpcServer, identityService)
+	m.SetReadinessCheck(identityService.IsReady)
 
 	m.InitializeMetrics(grpcServer)
 
 	identityService.SetReady(true)
 
-	return nil
+	return identityService, nil
+}
+
+// createVolumeService creates the volume service of the controller for the
+// project of the hcloud client. The profile is empty for the default project.
+func createVolumeService(
+	ctx context.Context,
+	logger *slog.Logger,
+	cfg *config.Config,
+	profile string,
+	hcloudClient *hcloud.Client,
+	auditLog *audit.Logger,
+	m *metrics.Metrics,
+) (volumes.Service, error) {
+	var plan *volsrv.Plan
+	if cfg.DryRun {
+		plan = volsrv.NewPlan()
+		if profile == "" {
+			m.HandleAuthenticated("/plan", plan)
+		} else {
+			m.HandleAuthenticated("/plan/"+profile, plan)
+		}
+	}
+
+	var apiVolumeService volumes.Service = volsrv.NewVolumeService(
+		logger.With("component", "api-volume-service"),
+		hcloudClient,
+		volsrv.NewActionWatcher(
+			logger.With("component", "action-watcher"),
+			hcloudClient,
+			app.GetActionPollingInterval(cfg),
+		),
+		plan,
+		auditLog,
+		m,
+	)
+
+	if cfg.Volume.CacheTTL > 0 {
+		cachingVolumeService := volumes.NewCachingService(
+			logger.With("component", "caching-volume-service"),
+			apiVolumeService,
+			cfg.Volume.CacheTTL,
+		)
+		if cfg.Volume.CacheSeedInterval > 0 {
+			go cachingVolumeService.Run(ctx, cfg.Volume.CacheSeedInterval)
+		}
+		apiVolumeService = cachingVolumeService
+	} else if cfg.Volume.CacheSeedInterval > 0 {
+		return nil, errors.New("HCLOUD_VOLUME_CACHE_SEED_INTERVAL requires the volume cache to be enabled")
+	}
+
+	return volumes.NewIdempotentService(
+		logger.With("component", "idempotent-volume-service"),
+		volumes.NewSerializedService(
+			logger.With("component", "serialized-volume-service"),
+			apiVolumeService,
+			hcloud.ExponentialBackoffWithOpts(hcloud.ExponentialBackoffOpts{
+				Base:       time.Second,
+				Multiplier: 2,
+				Cap:        10 * time.Second,
+			}),
+		),
+	), nil
 }
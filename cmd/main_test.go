@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/hetznercloud/csi-driver/internal/app"
+	"github.com/hetznercloud/csi-driver/internal/config"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/metadata"
 )
@@ -36,7 +37,10 @@ func TestSetup(t *testing.T) {
 
 	logger := slog.New(slog.DiscardHandler)
 
-	m := app.CreateMetrics(logger)
+	cfg, err := config.Load("")
+	require.NoError(t, err)
+	m, err := app.CreateMetrics(logger, cfg)
+	require.NoError(t, err)
 
 	t.Run("missing hcloud token", func(t *testing.T) {
 		grpcServer := app.CreateGRPCServer(
@@ -51,7 +55,7 @@ func TestSetup(t *testing.T) {
 
 		t.Setenv("CSI_ENDPOINT", fmt.Sprintf("unix:///%s/csi.sock", t.TempDir()))
 
-		err := setup(logger, true, false, grpcServer, m, metaClient)
+		_, err := setup(t.Context(), logger, newTestConfigWatcher(t), true, false, grpcServer, m, metaClient, nil)
 		require.EqualError(t, err, "failed to initialize hcloud client: you need to provide an API token via the HCLOUD_TOKEN or HCLOUD_TOKEN_FILE env var")
 	})
 
@@ -70,7 +74,7 @@ func TestSetup(t *testing.T) {
 		t.Setenv("CSI_ENDPOINT", fmt.Sprintf("unix:///%s/csi.sock", t.TempDir()))
 		t.Setenv("HCLOUD_TOKEN", "foobar")
 
-		err := setup(logger, true, false, grpcServer, m, metaClient)
+		_, err := setup(t.Context(), logger, newTestConfigWatcher(t), true, false, grpcServer, m, metaClient, nil)
 		require.NoError(t, err)
 	})
 
@@ -87,7 +91,7 @@ func TestSetup(t *testing.T) {
 		})
 		metaClient := metadata.NewClient(metadata.WithEndpoint(metaServer.URL))
 
-		err := setup(logger, false, true, grpcServer, m, metaClient)
+		_, err := setup(t.Context(), logger, newTestConfigWatcher(t), false, true, grpcServer, m, metaClient, nil)
 		require.NoError(t, err)
 	})
 
@@ -108,7 +112,15 @@ func TestSetup(t *testing.T) {
 		t.Setenv("CSI_ENDPOINT", fmt.Sprintf("unix:///%s/csi.sock", t.TempDir()))
 		t.Setenv("HCLOUD_TOKEN", "foobar")
 
-		err := setup(logger, true, true, grpcServer, m, metaClient)
+		_, err := setup(t.Context(), logger, newTestConfigWatcher(t), true, true, grpcServer, m, metaClient, nil)
 		require.NoError(t, err)
 	})
 }
+
+// newTestConfigWatcher loads the config from the env vars of the test.
+func newTestConfigWatcher(t *testing.T) *config.Watcher {
+	t.Helper()
+	cfg, err := config.Load("")
+	require.NoError(t, err)
+	return config.NewWatcher(slog.New(slog.DiscardHandler), "", cfg)
+}
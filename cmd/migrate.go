@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/hetznercloud/csi-driver/internal/app"
+	"github.com/hetznercloud/csi-driver/internal/config"
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/migrate"
+	"github.com/hetznercloud/csi-driver/internal/tlsconfig"
+	"github.com/hetznercloud/csi-driver/internal/volsrv"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+const migrateUsage = `Usage: %s migrate <command> [flags]
+
+Migrate a volume to another location.
+
+Commands:
+  create-target  Create an empty target volume in another location.
+  receive        Write the data sent by the sender to the target device.
+  send           Send the data of the source device to the receiver.
+  finish         Label the source volume as migrated to the target volume.
+
+The sender and receiver connect with mutual TLS. Both need a certificate
+issued by the CA given with -tls-ca-file. The sender additionally
+authenticates with the token from the MIGRATION_TOKEN env var.
+`
+
+// runMigrate runs the migrate subcommand and returns the exit code.
+func runMigrate(logger *slog.Logger, cfg *config.Config, args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, migrateUsage, os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch args[0] {
+	case "create-target":
+		err = migrateCreateTarget(ctx, logger, cfg, args[1:])
+	case "receive":
+		err = migrateReceive(ctx, logger, args[1:])
+	case "send":
+		err = migrateSend(ctx, logger, args[1:])
+	case "finish":
+		err = migrateFinish(ctx, logger, cfg, args[1:])
+	default:
+		usage()
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		logger.Error("migration failed", "error", err)
+		return 1
+	}
+	return 0
+}
+
+func migrateCreateTarget(ctx context.Context, logger *slog.Logger, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("create-target", flag.ContinueOnError)
+	volumeID := flags.Int64("volume-id", 0, "ID of the source volume.")
+	location := flags.String("location", "", "Location of the target volume.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *volumeID == 0 || *location == "" {
+		return errors.New("-volume-id and -location are required")
+	}
+
+	volumeService, err := createMigrationVolumeService(logger, cfg)
+	if err != nil {
+		return err
+	}
+
+	target, err := volumeService.CreateMigrationTarget(ctx, &csi.Volume{ID: *volumeID}, *location)
+	if err != nil {
+		return fmt.Errorf("failed to create target volume: %w", err)
+	}
+
+	logger.Info(
+		"created target volume",
+		"volume-id", *volumeID,
+		"target-volume-id", target.ID,
+		"target-location", target.Location,
+	)
+	fmt.Println(target.ID)
+	return nil
+}
+
+func migrateReceive(ctx context.Context, logger *slog.Logger, args []string) error {
+	flags := flag.NewFlagSet("receive", flag.ContinueOnError)
+	device := flags.String("device", "", "Path of the target block device.")
+	listen := flags.String("listen", ":7070", "Address to listen on for the sender.")
+	tlsFlags := addMigrationTLSFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *device == "" {
+		return errors.New("-device is required")
+	}
+
+	token, err := getMigrationToken()
+	if err != nil {
+		return err
+	}
+	reloader, err := tlsFlags.reloader(logger)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", *listen, err)
+	}
+	defer listener.Close()
+
+	receiver := migrate.NewReceiver(
+		logger.With("component", "migrate-receiver"),
+		token,
+		reloader.ServerConfig(tls.RequireAndVerifyClientCert),
+	)
+	return receiver.Receive(ctx, *device, listener)
+}
+
+func migrateSend(ctx context.Context, logger *slog.Logger, args []string) error {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	device := flags.String("device", "", "Path of the source block device.")
+	receiver := flags.String("receiver", "", "Address of the receiver, e.g. 10.0.0.2:7070.")
+	serverName := flags.String("tls-server-name", "", "Name to verify the certificate of the receiver against. Defaults to the host of -receiver.")
+	tlsFlags := addMigrationTLSFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *device == "" || *receiver == "" {
+		return errors.New("-device and -receiver are required")
+	}
+
+	token, err := getMigrationToken()
+	if err != nil {
+		return err
+	}
+	reloader, err := tlsFlags.reloader(logger)
+	if err != nil {
+		return err
+	}
+	if *serverName == "" {
+		host, _, err := net.SplitHostPort(*receiver)
+		if err != nil {
+			return fmt.Errorf("invalid -receiver: %w", err)
+		}
+		*serverName = host
+	}
+
+	sender := migrate.NewSender(
+		logger.With("component", "migrate-sender"),
+		token,
+		reloader.ClientConfig(*serverName),
+	)
+	return sender.Send(ctx, *device, *receiver)
+}
+
+func migrateFinish(ctx context.Context, logger *slog.Logger, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("finish", flag.ContinueOnError)
+	volumeID := flags.Int64("volume-id", 0, "ID of the source volume.")
+	targetVolumeID := flags.Int64("target-volume-id", 0, "ID of the target volume.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *volumeID == 0 || *targetVolumeID == 0 {
+		return errors.New("-volume-id and -target-volume-id are required")
+	}
+
+	volumeService, err := createMigrationVolumeService(logger, cfg)
+	if err != nil {
+		return err
+	}
+
+	return finishMigration(ctx, volumeService, *volumeID, *targetVolumeID)
+}
+
+// finishMigration labels the source volume as migrated, after making sure the
+// target volume was created for it.
+func finishMigration(ctx context.Context, volumeService volumes.Service, volumeID, targetVolumeID int64) error {
+	target, err := volumeService.GetByID(ctx, targetVolumeID)
+	if err != nil {
+		return fmt.Errorf("failed to get target volume: %w", err)
+	}
+	if target.Labels[volumes.LabelKeyMigratedFrom] != strconv.FormatInt(volumeID, 10) {
+		return fmt.Errorf("volume %d is not a migration target of volume %d", targetVolumeID, volumeID)
+	}
+
+	source, err := volumeService.GetByID(ctx, volumeID)
+	if err != nil {
+		return fmt.Errorf("failed to get source volume: %w", err)
+	}
+
+	labels := maps.Clone(source.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[volumes.LabelKeyMigratedTo] = strconv.FormatInt(targetVolumeID, 10)
+
+	if err := volumeService.UpdateLabels(ctx, source, labels); err != nil {
+		return fmt.Errorf("failed to label source volume: %w", err)
+	}
+	return nil
+}
+
+func createMigrationVolumeService(logger *slog.Logger, cfg *config.Config) (volumes.Service, error) {
+	token, err := app.LoadToken(logger, cfg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize hcloud client: %w", err)
+	}
+	hcloudClient := app.CreateHcloudClient(cfg, token, prometheus.NewRegistry(), logger, nil)
+	actionPollingInterval := app.GetActionPollingInterval(cfg)
+	return volsrv.NewVolumeService(
+		logger.With("component", "api-volume-service"),
+		hcloudClient,
+		volsrv.NewActionWatcher(logger.With("component", "action-watcher"), hcloudClient, actionPollingInterval),
+		nil,
+		nil,
+		nil,
+	), nil
+}
+
+// migrationTLSFlags are the TLS files of the sender and receiver.
+type migrationTLSFlags struct {
+	certFile *string
+	keyFile  *string
+	caFile   *string
+}
+
+func addMigrationTLSFlags(flags *flag.FlagSet) *migrationTLSFlags {
+	return &migrationTLSFlags{
+		certFile: flags.String("tls-cert-file", "", "Path of the PEM encoded certificate."),
+		keyFile:  flags.String("tls-key-file", "", "Path of the PEM encoded key of the certificate."),
+		caFile:   flags.String("tls-ca-file", "", "Path of the PEM encoded CA, which issued the certificates of the sender and receiver."),
+	}
+}
+
+func (f *migrationTLSFlags) reloader(logger *slog.Logger) (*tlsconfig.Reloader, error) {
+	if *f.certFile == "" || *f.keyFile == "" || *f.caFile == "" {
+		return nil, errors.New("-tls-cert-file, -tls-key-file and -tls-ca-file are required")
+	}
+	reloader, err := tlsconfig.NewReloader(logger, tlsconfig.Files{
+		CertFile: *f.certFile,
+		KeyFile:  *f.keyFile,
+		CAFile:   *f.caFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS files: %w", err)
+	}
+	return reloader, nil
+}
+
+func getMigrationToken() (string, error) {
+	token := os.Getenv("MIGRATION_TOKEN")
+	if token == "" {
+		return "", errors.New("MIGRATION_TOKEN env var is required")
+	}
+	return token, nil
+}
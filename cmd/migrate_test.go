@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/mock"
+)
+
+func TestFinishMigration(t *testing.T) {
+	volumeService := &mock.VolumeService{
+		GetByIDFunc: func(_ context.Context, id int64) (*csi.Volume, error) {
+			switch id {
+			case 1:
+				return &csi.Volume{ID: 1, Labels: map[string]string{"managed-by": "csi-driver"}}, nil
+			default:
+				return &csi.Volume{ID: id, Labels: map[string]string{"migrated-from": "1"}}, nil
+			}
+		},
+	}
+
+	var labels map[string]string
+	volumeService.UpdateLabelsFunc = func(_ context.Context, volume *csi.Volume, l map[string]string) error {
+		require.Equal(t, int64(1), volume.ID)
+		labels = l
+		return nil
+	}
+
+	t.Run("happy", func(t *testing.T) {
+		err := finishMigration(context.Background(), volumeService, 1, 2)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"managed-by": "csi-driver", "migrated-to": "2"}, labels)
+	})
+
+	t.Run("not a migration target", func(t *testing.T) {
+		err := finishMigration(context.Background(), volumeService, 3, 2)
+		require.EqualError(t, err, "volume 2 is not a migration target of volume 3")
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/hetznercloud/csi-driver/internal/app"
+	"github.com/hetznercloud/csi-driver/internal/audit"
+	"github.com/hetznercloud/csi-driver/internal/config"
+	"github.com/hetznercloud/csi-driver/internal/driver"
+	"github.com/hetznercloud/csi-driver/internal/metrics"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+// flushTimeout limits how long the traces and metrics may take to flush at the
+// end of the shutdown.
+const flushTimeout = 5 * time.Second
+
+// shutdown stops the driver gracefully. The driver reports not ready and stops
+// accepting requests. In-flight requests may finish until the shutdown timeout,
+// afterwards they are canceled. Commands like luksFormat and mkfs are not
+// canceled with the requests, as interrupting them could corrupt the volume,
+// so the shutdown waits for them up to the shutdown timeout once more. Once
+// the requests stopped, no new commands of this kind may start.
+func shutdown(
+	logger *slog.Logger,
+	cfg *config.Config,
+	identityService *driver.IdentityService,
+	grpcServer *grpc.Server,
+	m *metrics.Metrics,
+	auditLog *audit.Logger,
+	shutdownTracing func(context.Context) error,
+) {
+	logger.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	identityService.SetReady(false)
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		logger.Info("finished in-flight requests")
+	case <-time.After(cfg.ShutdownTimeout):
+		logger.Warn("shutdown timeout exceeded, canceling in-flight requests")
+		grpcServer.Stop()
+	}
+
+	// Canceled handlers may still be running after Stop returned, so new
+	// commands are refused before the running ones are counted.
+	if running := volumes.RefuseUninterruptibleCommands(); running > 0 {
+		logger.Warn("waiting for commands, which must not be interrupted", "commands", running)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		if err := volumes.WaitForUninterruptibleCommands(ctx); err != nil {
+			logger.Error("shutdown timeout exceeded, exiting with running commands, which must not be interrupted",
+				"commands", volumes.UninterruptibleCommands())
+		}
+		cancel()
+	}
+
+	if err := app.RemoveSocket(cfg); err != nil {
+		logger.Error("failed to remove socket", "error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("failed to flush traces", "error", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		logger.Error("failed to close audit log", "error", err)
+	}
+	if err := m.Shutdown(ctx); err != nil {
+		logger.Error("failed to stop metrics server", "error", err)
+	}
+
+	logger.Info("shut down")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	proto "github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/hetznercloud/csi-driver/internal/app"
+	"github.com/hetznercloud/csi-driver/internal/config"
+	"github.com/hetznercloud/csi-driver/internal/driver"
+)
+
+func TestShutdown(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "csi.sock")
+	t.Setenv("CSI_ENDPOINT", fmt.Sprintf("unix://%s", socket))
+	t.Setenv("ENABLE_METRICS", "false")
+
+	cfg, err := config.Load("")
+	require.NoError(t, err)
+	cfg.ShutdownTimeout = time.Second
+
+	logger := slog.New(slog.DiscardHandler)
+	listener, err := app.CreateListener(cfg)
+	require.NoError(t, err)
+	require.FileExists(t, socket)
+
+	m, err := app.CreateMetrics(logger, cfg)
+	require.NoError(t, err)
+	grpcServer := app.CreateGRPCServer(logger, m.UnaryServerInterceptor())
+	identityService := driver.NewIdentityService(logger)
+	identityService.SetReady(true)
+	proto.RegisterIdentityServer(grpcServer, identityService)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- grpcServer.Serve(listener)
+	}()
+
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = proto.NewIdentityClient(conn).Probe(t.Context(), &proto.ProbeRequest{})
+	require.NoError(t, err)
+
+	shutdown(logger, cfg, identityService, grpcServer, m, nil, func(context.Context) error { return nil })
+
+	require.NoError(t, <-served)
+	assert.False(t, identityService.IsReady())
+	assert.NoFileExists(t, socket)
+}
@@ -2,47 +2,46 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime/coverage"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	nomad "github.com/hashicorp/nomad/api"
 	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
+	"github.com/hetznercloud/csi-driver/internal/audit"
+	"github.com/hetznercloud/csi-driver/internal/config"
+	"github.com/hetznercloud/csi-driver/internal/credentials"
 	"github.com/hetznercloud/csi-driver/internal/driver"
+	"github.com/hetznercloud/csi-driver/internal/leaderelection"
+	"github.com/hetznercloud/csi-driver/internal/logging"
 	"github.com/hetznercloud/csi-driver/internal/metrics"
+	"github.com/hetznercloud/csi-driver/internal/persistentvolumes"
+	"github.com/hetznercloud/csi-driver/internal/ratelimit"
+	"github.com/hetznercloud/csi-driver/internal/tlsconfig"
+	"github.com/hetznercloud/csi-driver/internal/tracing"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
-	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/kit/envutil"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/metadata"
 )
 
 const APIClientTimeout = 15 * time.Second
 
-func parseLogLevel(lvl string) slog.Level {
-	switch strings.ToLower(lvl) {
-	case "debug":
-		return slog.LevelDebug
-	case "info":
-		return slog.LevelInfo
-	case "warn":
-		return slog.LevelWarn
-	case "error":
-		return slog.LevelError
-	default:
-		return slog.LevelInfo
-	}
-}
-
 func SetupCoverageSignalHandler(logger *slog.Logger) {
 	coverDir, exists := os.LookupEnv("GOCOVERDIR")
 	if !exists {
@@ -64,128 +63,330 @@ func SetupCoverageSignalHandler(logger *slog.Logger) {
 	}()
 }
 
-// CreateLogger prepares a logger according to LOG_LEVEL environment variable.
-func CreateLogger() *slog.Logger {
-	logLevel := parseLogLevel(os.Getenv("LOG_LEVEL"))
+// CreateLogger prepares a logger according to the log config. The returned levels can be changed at runtime.
+func CreateLogger(cfg *config.Config) (*slog.Logger, *logging.Levels, error) {
+	levels := logging.NewLevels(slog.LevelInfo)
+	if err := ApplyLogConfig(levels, cfg); err != nil {
+		return nil, nil, err
+	}
+
 	options := slog.HandlerOptions{
 		AddSource: true,
-		Level:     logLevel,
+		// The levels are checked by the logging.Handler.
+		Level: slog.Level(math.MinInt),
 	}
-	th := slog.NewTextHandler(os.Stdout, &options)
-	logger := slog.New(th)
 
-	return logger
+	var handler slog.Handler
+	switch cfg.Log.Format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, &options)
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stdout, &options)
+	default:
+		return nil, nil, fmt.Errorf("invalid log format %q, must be text or json", cfg.Log.Format)
+	}
+	return slog.New(logging.NewHandler(handler, levels)), levels, nil
+}
+
+// ApplyLogConfig sets the log levels from the config, e.g. after it was reloaded. The levels are only changed,
+// if all of them are valid. Levels changed at runtime take precedence and are kept.
+func ApplyLogConfig(levels *logging.Levels, cfg *config.Config) error {
+	level, err := config.ParseLogLevel(cfg.Log.Level)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+
+	overrides := make(map[string]slog.Level, len(cfg.Log.LevelOverrides))
+	for component, name := range cfg.Log.LevelOverrides {
+		overrides[component], err = config.ParseLogLevel(name)
+		if err != nil {
+			return fmt.Errorf("invalid log level of component %s: %w", component, err)
+		}
+	}
+
+	levels.Configure(level, overrides)
+	return nil
+}
+
+// CreateAuditLogger creates the audit log of changes to volumes, which is written to a file or "stdout". It
+// returns nil when the audit log is disabled.
+func CreateAuditLogger(logger *slog.Logger, cfg *config.Config) (*audit.Logger, error) {
+	path := cfg.AuditLogFile
+	switch path {
+	case "":
+		return nil, nil
+	case "stdout":
+		return audit.NewLogger(logger, os.Stdout), nil
+	default:
+		return audit.OpenFile(logger, path)
+	}
+}
+
+// SetupTracing exports OpenTelemetry traces over OTLP, if an endpoint is configured with the
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT environment variables. The returned
+// function flushes the remaining spans.
+func SetupTracing(ctx context.Context, logger *slog.Logger) (func(context.Context) error, error) {
+	if !tracing.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+	logger.Info("exporting traces over OTLP")
+	return tracing.Setup(ctx, "hcloud-csi-driver", driver.PluginVersion)
+}
+
+// CreateLeaderElector creates the leader elector of the controller. It returns nil when the leader election is
+// disabled, which is the default.
+func CreateLeaderElector(logger *slog.Logger, cfg *config.Config) (leaderelection.LeaderElector, error) {
+	leaderElection := cfg.LeaderElection
+	if leaderElection.Backend == "none" {
+		return nil, nil
+	}
+
+	identity := leaderElection.ID
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine leader election identity: %w", err)
+		}
+		identity = hostname
+	}
+
+	logger.Info("using leader election", "backend", leaderElection.Backend, "identity", identity)
+
+	var backend leaderelection.Backend
+	switch leaderElection.Backend {
+	case "kubernetes":
+		client, err := CreateKubernetesClient()
+		if err != nil {
+			return nil, err
+		}
+		return leaderelection.NewKubernetesElector(
+			logger, client,
+			leaderElection.Namespace, leaderElection.LeaseName, identity, leaderElection.LeaseDuration,
+		)
+	case "nomad":
+		// The client is configured with the NOMAD_ADDR, NOMAD_TOKEN and
+		// NOMAD_NAMESPACE environment variables.
+		client, err := nomad.NewClient(nomad.DefaultConfig())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Nomad client: %w", err)
+		}
+		backend = leaderelection.NewNomadBackend(
+			client, leaderElection.Namespace, leaderElection.LeaseName, identity, leaderElection.LeaseDuration,
+		)
+	case "file":
+		backend = leaderelection.NewFileBackend(leaderElection.File)
+	}
+
+	return leaderelection.NewElector(logger, backend, leaderElection.LeaseDuration), nil
+}
+
+// CreateKubernetesClient creates a Kubernetes client with the in-cluster configuration of the pod.
+func CreateKubernetesClient() (kubernetes.Interface, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Kubernetes in-cluster config: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return client, nil
+}
+
+// CreateVolumeParameterSource creates the source of the volume parameters for the label reconciler. It returns
+// nil, if the controller does not run in a Kubernetes cluster, e.g. in Nomad.
+func CreateVolumeParameterSource(logger *slog.Logger) (driver.VolumeParameterSource, error) {
+	if _, err := rest.InClusterConfig(); errors.Is(err, rest.ErrNotInCluster) {
+		logger.Info("not running in a Kubernetes cluster, the label reconciler only applies the extra volume labels")
+		return nil, nil
+	}
+	client, err := CreateKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	return persistentvolumes.NewParameterSource(client, driver.PluginName), nil
+}
+
+// GetVolumeQuota returns the volume quota of the controller. It returns nil when no quota is configured, which
+// disables the capacity reporting of the controller.
+func GetVolumeQuota(cfg *config.Config) *driver.VolumeQuota {
+	if cfg.Volume.QuotaGB == nil {
+		return nil
+	}
+	return &driver.VolumeQuota{
+		Total:     *cfg.Volume.QuotaGB,
+		Locations: maps.Clone(cfg.Volume.LocationQuotasGB),
+	}
 }
 
-// GetEnableProvidedByTopology parses the ENABLE_PROVIDED_BY_TOPOLOGY environment variable and returns false by default.
-func GetEnableProvidedByTopology() bool {
-	var enableProvidedByTopology bool
-	if featFlag, exists := os.LookupEnv("ENABLE_PROVIDED_BY_TOPOLOGY"); exists {
-		enableProvidedByTopology, _ = strconv.ParseBool(featFlag)
+// GetProfileVolumeQuota returns the volume quota of a project profile, if it is configured.
+func GetProfileVolumeQuota(cfg *config.Config, profile string) *driver.VolumeQuota {
+	quota := cfg.Profiles[profile].QuotaGB
+	if quota == nil {
+		return nil
 	}
-	return enableProvidedByTopology
+	return &driver.VolumeQuota{Total: *quota}
 }
 
-// CreateListener creates and binds the unix socket in location specified by the CSI_ENDPOINT environment variable.
-func CreateListener() (net.Listener, error) {
-	endpoint := os.Getenv("CSI_ENDPOINT")
+// CreateListener creates the listener of the CSI endpoint specified by the CSI_ENDPOINT env var. A unix:// endpoint
+// binds a unix socket, a tcp:// endpoint a TCP port. The TLS of a tcp:// endpoint is set up by
+// [CreateGRPCServerCredentials].
+func CreateListener(cfg *config.Config) (net.Listener, error) {
+	endpoint := cfg.CSIEndpoint
 	if endpoint == "" {
 		return nil, errors.New("you need to specify an endpoint via the CSI_ENDPOINT env var")
 	}
-	if !strings.HasPrefix(endpoint, "unix://") {
-		return nil, errors.New("endpoint must start with unix://")
+
+	var l net.ListenConfig
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		endpoint = filepath.Clean(endpoint[7:]) // strip unix://
+
+		if err := os.Remove(endpoint); err != nil && !os.IsNotExist(err) { //nolint:gosec // G703: endpoint is from a trusted env var, validated with unix:// prefix, and cleaned with filepath.Clean
+			return nil, fmt.Errorf("failed to remove socket file at %s: %w", endpoint, err)
+		}
+		return l.Listen(context.Background(), "unix", endpoint)
+
+	case strings.HasPrefix(endpoint, "tcp://"):
+		return l.Listen(context.Background(), "tcp", endpoint[6:]) // strip tcp://
+
+	default:
+		return nil, errors.New("endpoint must start with unix:// or tcp://")
 	}
+}
 
-	endpoint = filepath.Clean(endpoint[7:]) // strip unix://
+// CreateGRPCServerCredentials returns the options of the gRPC server, which require mutual TLS for a tcp:// CSI
+// endpoint with the files from the CSI_TLS_CERT_FILE, CSI_TLS_KEY_FILE and CSI_TLS_CA_FILE env vars. The files are
+// reloaded when they change. A unix:// endpoint needs no options.
+func CreateGRPCServerCredentials(logger *slog.Logger, cfg *config.Config) ([]grpc.ServerOption, error) {
+	if !strings.HasPrefix(cfg.CSIEndpoint, "tcp://") {
+		return nil, nil
+	}
 
-	if err := os.Remove(endpoint); err != nil && !os.IsNotExist(err) { //nolint:gosec // G703: endpoint is from a trusted env var, validated with unix:// prefix, and cleaned with filepath.Clean
-		return nil, fmt.Errorf("failed to remove socket file at %s: %w", endpoint, err)
+	reloader, err := tlsconfig.NewReloader(logger, tlsconfig.Files{
+		CertFile: cfg.CSITLS.CertFile,
+		KeyFile:  cfg.CSITLS.KeyFile,
+		CAFile:   cfg.CSITLS.CAFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CSI endpoint TLS files: %w", err)
 	}
-	var l net.ListenConfig
-	return l.Listen(context.Background(), "unix", endpoint)
+	return []grpc.ServerOption{
+		grpc.Creds(grpccredentials.NewTLS(reloader.ServerConfig(tls.RequireAndVerifyClientCert))),
+	}, nil
 }
 
-// CreateMetrics prepares a metrics client pointing at METRICS_ENDPOINT environment variable (will fallback)
-// It will start the metrics HTTP listener depending on the ENABLE_METRICS environment variable.
-func CreateMetrics(logger *slog.Logger) *metrics.Metrics {
-	metricsEndpoint := os.Getenv("METRICS_ENDPOINT")
-	if metricsEndpoint == "" {
-		// Use a default endpoint
-		metricsEndpoint = ":9189"
+// RemoveSocket removes the unix socket of the CSI endpoint, if it still exists, e.g. during the shutdown.
+func RemoveSocket(cfg *config.Config) error {
+	if !strings.HasPrefix(cfg.CSIEndpoint, "unix://") {
+		return nil
 	}
+	endpoint := filepath.Clean(cfg.CSIEndpoint[7:])                    // strip unix://
+	if err := os.Remove(endpoint); err != nil && !os.IsNotExist(err) { //nolint:gosec // G703: endpoint is from a trusted env var, validated with unix:// prefix, and cleaned with filepath.Clean
+		return fmt.Errorf("failed to remove socket file at %s: %w", endpoint, err)
+	}
+	return nil
+}
 
+// CreateMetrics prepares a metrics client pointing at the metrics endpoint. It will start the metrics HTTP
+// listener, unless metrics are disabled. It fails, if the listener cannot be started.
+func CreateMetrics(logger *slog.Logger, cfg *config.Config) (*metrics.Metrics, error) {
 	m := metrics.New(
 		logger,
-		metricsEndpoint,
+		cfg.Metrics.Endpoint,
 	)
 
 	enableMetrics := true // Default to true to keep the old behavior of exporting them always. This is deprecated
-	if enableMetricsEnv := os.Getenv("ENABLE_METRICS"); enableMetricsEnv != "" {
-		var err error
-		enableMetrics, err = strconv.ParseBool(enableMetricsEnv)
-		if err != nil {
-			logger.Error(
-				"ENABLE_METRICS can only contain a boolean value, true or false",
-				"err", err,
-			)
-			os.Exit(1)
-		}
+	if cfg.Metrics.Enabled != nil {
+		enableMetrics = *cfg.Metrics.Enabled
 	} else {
 		logger.Warn(
 			"the environment variable ENABLE_METRICS should be set to true, you can disable metrics by setting this env to false. Not specifying the ENV is deprecated. With v1.9.0 we will change the default to false and in v1.10.0 we will fail on start when the ENABLE_METRICS is not specified.",
 		)
 	}
 	if enableMetrics {
-		m.Serve()
+		authToken, err := cfg.LoadMetricsAuthToken()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the metrics auth token: %w", err)
+		}
+
+		err = m.Serve(metrics.ServeOpts{
+			TLSCertFile:  cfg.Metrics.TLSCertFile,
+			TLSKeyFile:   cfg.Metrics.TLSKeyFile,
+			ClientCAFile: cfg.Metrics.TLSClientCAFile,
+			AuthToken:    authToken,
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return m
+	return m, nil
 }
 
-// CreateHcloudClient creates a hcloud.Client using  various environment variables to guide configuration
-func CreateHcloudClient(metricsRegistry *prometheus.Registry, logger *slog.Logger) (*hcloud.Client, error) {
-	// apiToken can be set via HCLOUD_TOKEN (preferred) or HCLOUD_TOKEN_FILE
-	apiToken, err := envutil.LookupEnvWithFile("HCLOUD_TOKEN")
-	if err != nil {
-		return nil, err
-	}
-	if apiToken == "" {
+// LoadToken reads the API token, which can be set via HCLOUD_TOKEN (preferred) or HCLOUD_TOKEN_FILE. A token read
+// from a file is reloaded by [credentials.Token.Run]. Both report their generation to the observer.
+func LoadToken(logger *slog.Logger, cfg *config.Config, observer credentials.Observer) (*credentials.Token, error) {
+	var token *credentials.Token
+	switch {
+	case cfg.TokenFile != "":
+		var err error
+		token, err = credentials.NewFileToken(logger.With("component", "api-token"), cfg.TokenFile, observer)
+		if err != nil {
+			return nil, err
+		}
+	case cfg.Token != "":
+		token = credentials.NewObservedToken(string(cfg.Token), observer)
+	default:
 		return nil, fmt.Errorf("you need to provide an API token via the HCLOUD_TOKEN or HCLOUD_TOKEN_FILE env var")
 	}
 
-	if len(apiToken) != 64 {
+	if apiToken := token.Get(); len(apiToken) != 64 {
 		logger.Warn(fmt.Sprintf("unrecognized token format, expected 64 characters, got %d, proceeding anyway", len(apiToken)))
 	}
+	return token, nil
+}
+
+// CreateHcloudClient creates a hcloud.Client from the config. The requests use the current value of the token,
+// which may be replaced at runtime. The optional rate limit governor delays requests based on the remaining rate
+// limit budget.
+func CreateHcloudClient(
+	cfg *config.Config,
+	token *credentials.Token,
+	metricsRegistry *prometheus.Registry,
+	logger *slog.Logger,
+	rateLimitGovernor *ratelimit.Governor,
+) *hcloud.Client {
+	transport := token.Transport(http.DefaultTransport)
+	if rateLimitGovernor != nil {
+		transport = rateLimitGovernor.Transport(transport)
+	}
+	httpClient := &http.Client{
+		Timeout:   APIClientTimeout,
+		Transport: tracing.Transport(transport),
+	}
 
 	opts := []hcloud.ClientOption{
-		hcloud.WithToken(apiToken),
+		hcloud.WithToken(token.Get()),
 		hcloud.WithApplication("csi-driver", driver.PluginVersion),
 		hcloud.WithInstrumentation(metricsRegistry),
-		hcloud.WithHTTPClient(&http.Client{
-			Timeout: APIClientTimeout,
-		}),
+		hcloud.WithHTTPClient(httpClient),
 	}
-	hcloudEndpoint := os.Getenv("HCLOUD_ENDPOINT")
-	if hcloudEndpoint != "" {
-		opts = append(opts, hcloud.WithEndpoint(hcloudEndpoint))
+	if cfg.Endpoint != "" {
+		opts = append(opts, hcloud.WithEndpoint(cfg.Endpoint))
 	}
-	enableDebug := os.Getenv("HCLOUD_DEBUG")
-	if enableDebug != "" {
+	if cfg.Debug {
 		opts = append(opts, hcloud.WithDebugWriter(os.Stdout))
 	}
 
 	pollingInterval := 3
-	if customPollingInterval := os.Getenv("HCLOUD_POLLING_INTERVAL_SECONDS"); customPollingInterval != "" {
-		tmp, err := strconv.Atoi(customPollingInterval)
-		if err != nil || tmp < 1 {
-			return nil, errors.New("entered polling interval configuration is not a integer that is higher than 1")
-		}
+	if cfg.PollingIntervalSeconds > 0 {
 		logger.Info(
 			"got custom configuration for polling interval",
-			"interval", customPollingInterval,
+			"interval", cfg.PollingIntervalSeconds,
 		)
 
-		pollingInterval = tmp
+		pollingInterval = cfg.PollingIntervalSeconds
 	}
 
 	opts = append(opts, hcloud.WithPollOpts(hcloud.PollOpts{
@@ -196,27 +397,64 @@ func CreateHcloudClient(metricsRegistry *prometheus.Registry, logger *slog.Logge
 		}),
 	}))
 
-	return hcloud.NewClient(opts...), nil
+	return hcloud.NewClient(opts...)
+}
+
+// CreateProfileHcloudClient creates the hcloud.Client of a project profile. It uses the token file and the endpoint
+// of the profile and shares the other settings with the default client. The generation of the token of the profile
+// is reported to the observer.
+func CreateProfileHcloudClient(
+	cfg *config.Config,
+	profile string,
+	metricsRegistry *prometheus.Registry,
+	logger *slog.Logger,
+	rateLimitGovernor *ratelimit.Governor,
+	tokenObserver credentials.Observer,
+) (*hcloud.Client, *credentials.Token, error) {
+	profileCfg := *cfg
+	profileCfg.Token = ""
+	profileCfg.TokenFile = cfg.Profiles[profile].TokenFile
+	profileCfg.Endpoint = cfg.Profiles[profile].Endpoint
+
+	token, err := LoadToken(logger, &profileCfg, tokenObserver)
+	if err != nil {
+		return nil, nil, err
+	}
+	return CreateHcloudClient(&profileCfg, token, metricsRegistry, logger, rateLimitGovernor), token, nil
+}
+
+// DefaultActionPollingInterval is the interval of the action watcher, unless
+// configured otherwise with HCLOUD_POLLING_INTERVAL_SECONDS.
+const DefaultActionPollingInterval = 3 * time.Second
+
+// GetActionPollingInterval returns the interval in which the action watcher polls
+// all outstanding actions, which can be configured with HCLOUD_POLLING_INTERVAL_SECONDS.
+func GetActionPollingInterval(cfg *config.Config) time.Duration {
+	if cfg.PollingIntervalSeconds <= 0 {
+		return DefaultActionPollingInterval
+	}
+	return time.Duration(cfg.PollingIntervalSeconds) * time.Second
 }
 
 // GetServerLocation retrieves the hcloud server the application is running on.
 func GetServerLocation(
 	ctx context.Context,
 	logger *slog.Logger,
+	cfg *config.Config,
 	metadataClient *metadata.Client,
 	hcloudClient *hcloud.Client,
 	isController bool,
 ) (string, error) {
 	// Set explicitly via environment variable
-	if location, ok := os.LookupEnv("HCLOUD_VOLUME_DEFAULT_LOCATION"); ok {
-		return location, nil
+	if cfg.Volume.DefaultLocation != "" {
+		return cfg.Volume.DefaultLocation, nil
 	}
 
 	if isController {
 		// Get from HCLOUD_SERVER_ID env
 		// This env would be set explicitly by the user
 		// If this is set and location can not be found we do not want a fallback
-		isSet, location, err := getLocationByEnvID(ctx, logger, hcloudClient)
+		isSet, location, err := getLocationByEnvID(ctx, logger, cfg, hcloudClient)
 		if isSet {
 			return location, err
 		}
@@ -224,7 +462,7 @@ func GetServerLocation(
 		// Get from node name and search server list
 		// This env is set by default via a fieldRef on spec.nodeName
 		// If this is set and server can not be found we fallback to the metadata fallback
-		location, err = getLocationByEnvNodeName(ctx, logger, hcloudClient)
+		location, err = getLocationByEnvNodeName(ctx, logger, cfg, hcloudClient)
 		if err != nil {
 			return "", err
 		}
@@ -237,17 +475,12 @@ func GetServerLocation(
 	return GetLocationFromMetadata(ctx, logger, metadataClient)
 }
 
-func getLocationByEnvID(ctx context.Context, logger *slog.Logger, hcloudClient *hcloud.Client) (bool, string, error) {
-	envID := os.Getenv("HCLOUD_SERVER_ID")
-	if envID == "" {
+func getLocationByEnvID(ctx context.Context, logger *slog.Logger, cfg *config.Config, hcloudClient *hcloud.Client) (bool, string, error) {
+	id := cfg.ServerID
+	if id == 0 {
 		return false, "", nil
 	}
 
-	id, err := strconv.ParseInt(envID, 10, 64)
-	if err != nil {
-		return true, "", fmt.Errorf("invalid server id in HCLOUD_SERVER_ID env var: %s", envID)
-	}
-
 	logger.Debug(
 		"using server id from HCLOUD_SERVER_ID env var",
 		"server-id", id,
@@ -264,8 +497,8 @@ func getLocationByEnvID(ctx context.Context, logger *slog.Logger, hcloudClient *
 	return true, server.Location.Name, nil
 }
 
-func getLocationByEnvNodeName(ctx context.Context, logger *slog.Logger, hcloudClient *hcloud.Client) (string, error) {
-	nodeName := os.Getenv("KUBE_NODE_NAME")
+func getLocationByEnvNodeName(ctx context.Context, logger *slog.Logger, cfg *config.Config, hcloudClient *hcloud.Client) (string, error) {
+	nodeName := cfg.NodeName
 	if nodeName == "" {
 		return "", nil
 	}
@@ -305,7 +538,19 @@ func GetLocationFromMetadata(ctx context.Context, logger *slog.Logger, metadataC
 	return parts[0], nil
 }
 
-func CreateGRPCServer(logger *slog.Logger, metricsInterceptor grpc.UnaryServerInterceptor) *grpc.Server {
+// GetNetworkZoneFromMetadata retrieves the network zone of the server from the metadata service.
+func GetNetworkZoneFromMetadata(ctx context.Context, logger *slog.Logger, metadataClient *metadata.Client) (string, error) {
+	logger.Debug("getting network zone from metadata service")
+	networkZone, err := metadataClient.RegionWithContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get network zone from metadata service: %w", err)
+	}
+	return networkZone, nil
+}
+
+// CreateGRPCServer creates the gRPC server of the CSI endpoint with the interceptors for tracing, logging and
+// metrics. The options are passed to the server, e.g. the credentials from [CreateGRPCServerCredentials].
+func CreateGRPCServer(logger *slog.Logger, metricsInterceptor grpc.UnaryServerInterceptor, opts ...grpc.ServerOption) *grpc.Server {
 	requestLogger := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
 		isProbe := info.FullMethod == "/csi.v1.Identity/Probe"
 
@@ -328,10 +573,11 @@ func CreateGRPCServer(logger *slog.Logger, metricsInterceptor grpc.UnaryServerIn
 		return resp, err
 	}
 
-	return grpc.NewServer(
+	return grpc.NewServer(append([]grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(
+			tracing.UnaryServerInterceptor(),
 			requestLogger,
 			metricsInterceptor,
 		),
-	)
+	}, opts...)...)
 }
@@ -0,0 +1,137 @@
+// Package audit writes an audit trail of all changes to volumes as JSON lines,
+// separately from the regular logs of the driver.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Results of an audited operation.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Request describes the request of the container orchestrator, which caused
+// an operation.
+type Request struct {
+	Method       string `json:"method,omitempty"`
+	Name         string `json:"name,omitempty"`
+	PVCName      string `json:"pvc_name,omitempty"`
+	PVCNamespace string `json:"pvc_namespace,omitempty"`
+	NodeID       string `json:"node_id,omitempty"`
+}
+
+type requestKey struct{}
+
+// WithRequest returns a copy of the context, which carries the request into
+// the audit events recorded for it.
+func WithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// RequestFromContext returns the request of the context, if any.
+func RequestFromContext(ctx context.Context) Request {
+	request, _ := ctx.Value(requestKey{}).(Request)
+	return request
+}
+
+// VolumeState is the state of a volume before or after an operation.
+type VolumeState struct {
+	Size     int               `json:"size,omitempty"`
+	Location string            `json:"location,omitempty"`
+	ServerID int64             `json:"server_id,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// Event is a single operation, which changed or tried to change a volume.
+type Event struct {
+	Time            time.Time    `json:"time"`
+	Operation       string       `json:"operation"`
+	Request         Request      `json:"request"`
+	VolumeID        int64        `json:"volume_id,omitempty"`
+	VolumeName      string       `json:"volume_name,omitempty"`
+	ServerID        int64        `json:"server_id,omitempty"`
+	Before          *VolumeState `json:"before,omitempty"`
+	After           *VolumeState `json:"after,omitempty"`
+	ActionID        int64        `json:"action_id,omitempty"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	Result          string       `json:"result"`
+	Error           string       `json:"error,omitempty"`
+}
+
+// Logger writes audit events as JSON lines. A nil Logger discards all events.
+type Logger struct {
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+func NewLogger(logger *slog.Logger, w io.Writer) *Logger {
+	return &Logger{logger: logger, w: w}
+}
+
+// OpenFile creates a Logger, which appends the events to the file at path.
+// Every event is synced to disk before Record returns.
+func OpenFile(logger *slog.Logger, path string) (*Logger, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Logger{logger: logger, w: file, file: file}, nil
+}
+
+// Record writes the event. The time and the request are set from the context,
+// if they are not set in the event yet.
+func (l *Logger) Record(ctx context.Context, event Event) {
+	if l == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Request == (Request{}) {
+		event.Request = RequestFromContext(ctx)
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		l.logger.Error("failed to encode audit event", "err", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.w.Write(line); err != nil {
+		l.logger.Error("failed to write audit event", "err", err, "event", string(line))
+		return
+	}
+	if l.file != nil {
+		if err := l.file.Sync(); err != nil {
+			l.logger.Error("failed to sync audit log", "err", err)
+		}
+	}
+}
+
+// Close closes the file of the Logger, if it was opened with [OpenFile].
+func (l *Logger) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerRecord(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(slog.New(slog.DiscardHandler), &buf)
+
+	ctx := WithRequest(context.Background(), Request{Method: "CreateVolume", Name: "pvc-123", PVCName: "data"})
+	logger.Record(ctx, Event{
+		Operation: "create",
+		VolumeID:  1,
+		After:     &VolumeState{Size: 10, Location: "fsn1"},
+		ActionID:  2,
+		Result:    ResultSuccess,
+	})
+	logger.Record(context.Background(), Event{
+		Operation: "delete",
+		VolumeID:  1,
+		Result:    ResultFailure,
+		Error:     "locked",
+	})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var event Event
+	require.NoError(t, json.Unmarshal(lines[0], &event))
+	assert.Equal(t, "create", event.Operation)
+	assert.Equal(t, "pvc-123", event.Request.Name)
+	assert.Equal(t, "data", event.Request.PVCName)
+	assert.Equal(t, 10, event.After.Size)
+	assert.False(t, event.Time.IsZero())
+
+	var failed Event
+	require.NoError(t, json.Unmarshal(lines[1], &failed))
+	assert.Equal(t, Request{}, failed.Request)
+	assert.Equal(t, "locked", failed.Error)
+}
+
+func TestOpenFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for range 2 {
+		logger, err := OpenFile(slog.New(slog.DiscardHandler), path)
+		require.NoError(t, err)
+		logger.Record(context.Background(), Event{Operation: "attach", Result: ResultSuccess})
+		require.NoError(t, logger.Close())
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, bytes.Split(bytes.TrimSpace(data), []byte("\n")), 2)
+}
+
+func TestNilLogger(t *testing.T) {
+	var logger *Logger
+	logger.Record(context.Background(), Event{Operation: "attach"})
+	assert.NoError(t, logger.Close())
+}
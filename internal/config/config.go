@@ -0,0 +1,221 @@
+// Package config loads the configuration of the driver from an optional YAML
+// file. The environment variables override the settings of the file, so
+// existing deployments, which only use environment variables, keep working.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// FileEnv is the environment variable with the path of the config file.
+const FileEnv = "CONFIG_FILE"
+
+// Config is the configuration of the controller and the node plugin.
+type Config struct {
+	// Token is the hcloud API token. Use TokenFile to reload the token at
+	// runtime.
+	Token                  Secret `yaml:"token,omitempty"`
+	TokenFile              string `yaml:"tokenFile,omitempty"`
+	Endpoint               string `yaml:"endpoint,omitempty"`
+	Debug                  bool   `yaml:"debug,omitempty"`
+	PollingIntervalSeconds int    `yaml:"pollingIntervalSeconds,omitempty"`
+	ServerID               int64  `yaml:"serverID,omitempty"`
+	NodeName               string `yaml:"nodeName,omitempty"`
+
+	CSIEndpoint  string       `yaml:"csiEndpoint,omitempty"`
+	CSITLS       CSITLSConfig `yaml:"csiTLS,omitempty"`
+	DryRun       bool         `yaml:"dryRun,omitempty"`
+	AuditLogFile string       `yaml:"auditLogFile,omitempty"`
+	// ShutdownTimeout limits how long in-flight requests may take after
+	// SIGTERM, before they are canceled.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+
+	Volume         VolumeConfig         `yaml:"volume"`
+	Topology       TopologyConfig       `yaml:"topology"`
+	Metrics        MetricsConfig        `yaml:"metrics"`
+	Log            LogConfig            `yaml:"log"`
+	LeaderElection LeaderElectionConfig `yaml:"leaderElection"`
+
+	// Profiles are additional Hetzner Cloud projects, in which the controller
+	// creates volumes for StorageClasses with the profile parameter. They can
+	// only be set in the config file.
+	Profiles map[string]ProfileConfig `yaml:"profiles,omitempty"`
+
+	warnings []string
+}
+
+// CSITLSConfig are the TLS files of a tcp:// CSI endpoint. All of them are
+// required, as clients must authenticate with a certificate.
+type CSITLSConfig struct {
+	CertFile string `yaml:"certFile,omitempty"`
+	KeyFile  string `yaml:"keyFile,omitempty"`
+	CAFile   string `yaml:"caFile,omitempty"`
+}
+
+type VolumeConfig struct {
+	DefaultLocation string `yaml:"defaultLocation,omitempty"`
+	// ExtraLabels are added to every volume. They are reloaded at runtime.
+	ExtraLabels            map[string]string `yaml:"extraLabels,omitempty"`
+	LabelReconcileInterval time.Duration     `yaml:"labelReconcileInterval,omitempty"`
+	CacheTTL               time.Duration     `yaml:"cacheTTL,omitempty"`
+	CacheSeedInterval      time.Duration     `yaml:"cacheSeedInterval,omitempty"`
+	UsageScanInterval      time.Duration     `yaml:"usageScanInterval"`
+	// QuotaGB enables the capacity reporting of the controller, if set.
+	QuotaGB          *int           `yaml:"quotaGB,omitempty"`
+	LocationQuotasGB map[string]int `yaml:"locationQuotasGB,omitempty"`
+}
+
+type TopologyConfig struct {
+	EnableProvidedBy  bool `yaml:"enableProvidedBy,omitempty"`
+	EnableNetworkZone bool `yaml:"enableNetworkZone,omitempty"`
+}
+
+type MetricsConfig struct {
+	// Enabled defaults to true, but not setting it is deprecated.
+	Enabled         *bool  `yaml:"enabled,omitempty"`
+	Endpoint        string `yaml:"endpoint"`
+	TLSCertFile     string `yaml:"tlsCertFile,omitempty"`
+	TLSKeyFile      string `yaml:"tlsKeyFile,omitempty"`
+	TLSClientCAFile string `yaml:"tlsClientCAFile,omitempty"`
+	AuthToken       Secret `yaml:"authToken,omitempty"`
+	AuthTokenFile   string `yaml:"authTokenFile,omitempty"`
+}
+
+type LogConfig struct {
+	// Level and LevelOverrides are reloaded at runtime.
+	Level          string            `yaml:"level"`
+	Format         string            `yaml:"format"`
+	LevelOverrides map[string]string `yaml:"levelOverrides,omitempty"`
+}
+
+type LeaderElectionConfig struct {
+	Backend       string        `yaml:"backend"`
+	ID            string        `yaml:"id,omitempty"`
+	LeaseName     string        `yaml:"leaseName"`
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
+	Namespace     string        `yaml:"namespace,omitempty"`
+	File          string        `yaml:"file,omitempty"`
+}
+
+type ProfileConfig struct {
+	TokenFile       string `yaml:"tokenFile"`
+	Endpoint        string `yaml:"endpoint,omitempty"`
+	DefaultLocation string `yaml:"defaultLocation"`
+	// QuotaGB enables the capacity reporting for the profile, if set.
+	QuotaGB *int `yaml:"quotaGB,omitempty"`
+}
+
+// Secret is a string, which is redacted when the config is dumped.
+type Secret string
+
+const redacted = "<redacted>"
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+// Default returns the config, which is used for settings that are neither set
+// in the file nor in the environment.
+func Default() *Config {
+	return &Config{
+		ShutdownTimeout: 25 * time.Second,
+		Volume: VolumeConfig{
+			UsageScanInterval: time.Minute,
+		},
+		Metrics: MetricsConfig{
+			Endpoint: ":9189",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		LeaderElection: LeaderElectionConfig{
+			Backend:       "none",
+			LeaseName:     "hcloud-csi-controller",
+			LeaseDuration: 15 * time.Second,
+		},
+	}
+}
+
+// Load reads the config file at path, if it is not empty, and applies the
+// environment variables on top. All invalid settings are reported together.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	var errs []error
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, cfg.applyEnv()...)
+	if len(errs) == 0 {
+		errs = append(errs, cfg.Validate())
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Warnings returns the invalid settings, which Load replaced with their
+// default instead of failing.
+func (c *Config) Warnings() []string {
+	return c.warnings
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadMetricsAuthToken returns the token of the metrics server, which is read
+// from the token file, if it is configured.
+func (c *Config) LoadMetricsAuthToken() (string, error) {
+	if c.Metrics.AuthTokenFile == "" {
+		return string(c.Metrics.AuthToken), nil
+	}
+	data, err := os.ReadFile(c.Metrics.AuthTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read metrics auth token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Dump returns the config as YAML with the secrets redacted.
+func (c *Config) Dump() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// ParseLogLevel parses the name of a log level, e.g. debug.
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("HCLOUD_TOKEN", "")
+	t.Setenv("HCLOUD_TOKEN_FILE", "")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, `
+token: file-token
+volume:
+  defaultLocation: fsn1
+  extraLabels:
+    team: storage
+  cacheTTL: 30s
+log:
+  level: debug
+`, time.Now())
+
+	t.Run("file", func(t *testing.T) {
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, Secret("file-token"), cfg.Token)
+		assert.Equal(t, "fsn1", cfg.Volume.DefaultLocation)
+		assert.Equal(t, map[string]string{"team": "storage"}, cfg.Volume.ExtraLabels)
+		assert.Equal(t, 30*time.Second, cfg.Volume.CacheTTL)
+		assert.Equal(t, "debug", cfg.Log.Level)
+		// Defaults are kept for settings, which are not in the file.
+		assert.Equal(t, ":9189", cfg.Metrics.Endpoint)
+		assert.Equal(t, "none", cfg.LeaderElection.Backend)
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		t.Setenv("HCLOUD_TOKEN_FILE", "/etc/hcloud/token")
+		t.Setenv("HCLOUD_VOLUME_DEFAULT_LOCATION", "nbg1")
+
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, Secret(""), cfg.Token)
+		assert.Equal(t, "/etc/hcloud/token", cfg.TokenFile)
+		assert.Equal(t, "nbg1", cfg.Volume.DefaultLocation)
+	})
+
+	t.Run("no file", func(t *testing.T) {
+		cfg, err := Load("")
+		require.NoError(t, err)
+		assert.Equal(t, Default(), cfg)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "config.yaml")
+		writeFile(t, invalid, "volume:\n  cacheTtl: 30s\n", time.Now())
+
+		_, err := Load(invalid)
+		require.ErrorContains(t, err, "field cacheTtl not found")
+	})
+
+	t.Run("all errors", func(t *testing.T) {
+		t.Setenv("HCLOUD_VOLUME_CACHE_TTL", "-1s")
+		t.Setenv("LOG_FORMAT", "xml")
+		t.Setenv("LEADER_ELECTION_BACKEND", "file")
+
+		_, err := Load(path)
+		require.EqualError(t, err, `volume.cacheTTL (HCLOUD_VOLUME_CACHE_TTL) must not be negative: -1s
+log.format (LOG_FORMAT) must be text or json: xml
+leaderElection.file (LEADER_ELECTION_FILE) is required for the file backend`)
+	})
+}
+
+func TestLoadTCPEndpoint(t *testing.T) {
+	t.Setenv("CSI_ENDPOINT", "tcp://0.0.0.0:9000")
+	t.Setenv("CSI_TLS_CERT_FILE", "/etc/csi/tls.crt")
+
+	_, err := Load("")
+	require.EqualError(t, err, `csiTLS.keyFile (CSI_TLS_KEY_FILE) is required for a tcp:// CSI endpoint
+csiTLS.caFile (CSI_TLS_CA_FILE) is required for a tcp:// CSI endpoint`)
+
+	t.Setenv("CSI_TLS_KEY_FILE", "/etc/csi/tls.key")
+	t.Setenv("CSI_TLS_CA_FILE", "/etc/csi/ca.crt")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, CSITLSConfig{CertFile: "/etc/csi/tls.crt", KeyFile: "/etc/csi/tls.key", CAFile: "/etc/csi/ca.crt"}, cfg.CSITLS)
+}
+
+func TestLoadProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, `
+profiles:
+  team-a:
+    tokenFile: /etc/hcloud/team-a/token
+    defaultLocation: fsn1
+    quotaGB: 1000
+`, time.Now())
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	require.Contains(t, cfg.Profiles, "team-a")
+	assert.Equal(t, "/etc/hcloud/team-a/token", cfg.Profiles["team-a"].TokenFile)
+	assert.Equal(t, "fsn1", cfg.Profiles["team-a"].DefaultLocation)
+	assert.Equal(t, 1000, *cfg.Profiles["team-a"].QuotaGB)
+
+	writeFile(t, path, `
+profiles:
+  Team/A:
+    tokenFile: /etc/hcloud/team-a/token
+    defaultLocation: fsn1
+  team-b: {}
+`, time.Now())
+
+	_, err = Load(path)
+	require.EqualError(t, err, `profiles: invalid name "Team/A", must consist of lower case letters, digits and dashes
+profiles.team-b.tokenFile must not be empty
+profiles.team-b.defaultLocation must not be empty`)
+}
+
+func TestDump(t *testing.T) {
+	cfg := Default()
+	cfg.Token = "secret-token"
+	cfg.Metrics.AuthToken = "secret-auth-token"
+
+	data, err := cfg.Dump()
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.Contains(t, string(data), "token: <redacted>")
+	assert.Contains(t, string(data), "authToken: <redacted>")
+}
+
+func TestWatcher(t *testing.T) {
+	t.Setenv("HCLOUD_VOLUME_EXTRA_LABELS", "")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	modTime := time.Now().Add(-time.Hour)
+	writeFile(t, path, "volume:\n  extraLabels:\n    team: storage\n", modTime)
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	w := NewWatcher(slog.New(slog.DiscardHandler), path, cfg)
+	reloaded := make(chan *Config, 1)
+	w.Subscribe(func(cfg *Config) { reloaded <- cfg })
+
+	go w.Run(t.Context(), 10*time.Millisecond)
+
+	// An invalid config is ignored.
+	writeFile(t, path, "volume:\n  cacheTTL: -1s\n", modTime.Add(time.Minute))
+	select {
+	case <-reloaded:
+		t.Fatal("invalid config was applied")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Equal(t, cfg, w.Current())
+
+	writeFile(t, path, "volume:\n  extraLabels:\n    team: compute\n", modTime.Add(2*time.Minute))
+	select {
+	case cfg := <-reloaded:
+		assert.Equal(t, map[string]string{"team": "compute"}, cfg.Volume.ExtraLabels)
+		assert.Equal(t, cfg, w.Current())
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+}
+
+func TestLoadLenientEnv(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "verbose")
+	t.Setenv("ENABLE_PROVIDED_BY_TOPOLOGY", "yes")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "info", cfg.Log.Level)
+	assert.False(t, cfg.Topology.EnableProvidedBy)
+	assert.Equal(t, []string{
+		"invalid boolean in ENABLE_PROVIDED_BY_TOPOLOGY env var, using false: yes",
+		"invalid log level in LOG_LEVEL env var, using info: verbose",
+	}, cfg.Warnings())
+}
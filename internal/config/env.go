@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/utils"
+)
+
+// applyEnv overrides the settings with the environment variables, which are
+// set to a non-empty value. It returns an error for each invalid value. The
+// env vars, which were read leniently before the config file existed, fall
+// back to their default with a warning instead.
+func (c *Config) applyEnv() []error {
+	e := &envParser{}
+
+	token, hasToken := lookupEnv("HCLOUD_TOKEN")
+	tokenFile, hasTokenFile := lookupEnv("HCLOUD_TOKEN_FILE")
+	switch {
+	case hasToken && hasTokenFile:
+		e.errs = append(e.errs, fmt.Errorf("only one of HCLOUD_TOKEN and HCLOUD_TOKEN_FILE may be set"))
+	case hasToken:
+		c.Token, c.TokenFile = Secret(token), ""
+	case hasTokenFile:
+		c.Token, c.TokenFile = "", tokenFile
+	}
+	e.string("HCLOUD_ENDPOINT", &c.Endpoint)
+	// Any value enables the debug output, as before the config file existed.
+	if _, ok := lookupEnv("HCLOUD_DEBUG"); ok {
+		c.Debug = true
+	}
+	e.int("HCLOUD_POLLING_INTERVAL_SECONDS", &c.PollingIntervalSeconds)
+	e.int64("HCLOUD_SERVER_ID", &c.ServerID)
+	e.string("KUBE_NODE_NAME", &c.NodeName)
+
+	e.string("CSI_ENDPOINT", &c.CSIEndpoint)
+	e.string("CSI_TLS_CERT_FILE", &c.CSITLS.CertFile)
+	e.string("CSI_TLS_KEY_FILE", &c.CSITLS.KeyFile)
+	e.string("CSI_TLS_CA_FILE", &c.CSITLS.CAFile)
+	e.bool("HCLOUD_DRY_RUN", &c.DryRun)
+	e.string("AUDIT_LOG_FILE", &c.AuditLogFile)
+	e.duration("SHUTDOWN_TIMEOUT", &c.ShutdownTimeout)
+
+	e.string("HCLOUD_VOLUME_DEFAULT_LOCATION", &c.Volume.DefaultLocation)
+	e.labels("HCLOUD_VOLUME_EXTRA_LABELS", &c.Volume.ExtraLabels)
+	e.duration("HCLOUD_VOLUME_LABEL_RECONCILE_INTERVAL", &c.Volume.LabelReconcileInterval)
+	e.duration("HCLOUD_VOLUME_CACHE_TTL", &c.Volume.CacheTTL)
+	e.duration("HCLOUD_VOLUME_CACHE_SEED_INTERVAL", &c.Volume.CacheSeedInterval)
+	e.duration("VOLUME_USAGE_SCAN_INTERVAL", &c.Volume.UsageScanInterval)
+	if value, ok := lookupEnv("HCLOUD_VOLUME_QUOTA_GB"); ok {
+		quota, err := strconv.Atoi(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid volume quota in HCLOUD_VOLUME_QUOTA_GB env var: %s", value))
+		}
+		c.Volume.QuotaGB = &quota
+	}
+	if value, ok := lookupEnv("HCLOUD_VOLUME_LOCATION_QUOTAS_GB"); ok {
+		c.Volume.LocationQuotasGB = make(map[string]int)
+		pairs, err := utils.ConvertLabelsToMap(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("could not parse HCLOUD_VOLUME_LOCATION_QUOTAS_GB env var: %w", err))
+		}
+		for location, size := range pairs {
+			quota, err := strconv.Atoi(size)
+			if err != nil {
+				e.errs = append(e.errs, fmt.Errorf("invalid volume quota for location %s in HCLOUD_VOLUME_LOCATION_QUOTAS_GB env var: %s", location, size))
+			}
+			c.Volume.LocationQuotasGB[location] = quota
+		}
+	}
+
+	e.lenientBool("ENABLE_PROVIDED_BY_TOPOLOGY", &c.Topology.EnableProvidedBy)
+	e.bool("ENABLE_NETWORK_ZONE_TOPOLOGY", &c.Topology.EnableNetworkZone)
+
+	if _, ok := lookupEnv("ENABLE_METRICS"); ok {
+		var enabled bool
+		e.bool("ENABLE_METRICS", &enabled)
+		c.Metrics.Enabled = &enabled
+	}
+	e.string("METRICS_ENDPOINT", &c.Metrics.Endpoint)
+	e.string("METRICS_TLS_CERT_FILE", &c.Metrics.TLSCertFile)
+	e.string("METRICS_TLS_KEY_FILE", &c.Metrics.TLSKeyFile)
+	e.string("METRICS_TLS_CLIENT_CA_FILE", &c.Metrics.TLSClientCAFile)
+	if value, ok := lookupEnv("METRICS_AUTH_TOKEN"); ok {
+		c.Metrics.AuthToken, c.Metrics.AuthTokenFile = Secret(value), ""
+	}
+	if value, ok := lookupEnv("METRICS_AUTH_TOKEN_FILE"); ok {
+		c.Metrics.AuthToken, c.Metrics.AuthTokenFile = "", value
+	}
+
+	if value, ok := lookupEnv("LOG_LEVEL"); ok {
+		if _, err := ParseLogLevel(value); err != nil {
+			e.warnings = append(e.warnings, fmt.Sprintf("invalid log level in LOG_LEVEL env var, using info: %s", value))
+			value = "info"
+		}
+		c.Log.Level = value
+	}
+	e.string("LOG_FORMAT", &c.Log.Format)
+	e.labels("LOG_LEVEL_OVERRIDES", &c.Log.LevelOverrides)
+
+	e.string("LEADER_ELECTION_BACKEND", &c.LeaderElection.Backend)
+	e.string("LEADER_ELECTION_ID", &c.LeaderElection.ID)
+	e.string("LEADER_ELECTION_LEASE_NAME", &c.LeaderElection.LeaseName)
+	e.duration("LEADER_ELECTION_LEASE_DURATION", &c.LeaderElection.LeaseDuration)
+	e.string("LEADER_ELECTION_NAMESPACE", &c.LeaderElection.Namespace)
+	e.string("LEADER_ELECTION_FILE", &c.LeaderElection.File)
+
+	c.warnings = e.warnings
+	return e.errs
+}
+
+func lookupEnv(name string) (string, bool) {
+	value := os.Getenv(name)
+	return value, value != ""
+}
+
+// envParser parses environment variables into settings and collects the
+// errors and warnings of invalid values.
+type envParser struct {
+	errs     []error
+	warnings []string
+}
+
+func (e *envParser) string(name string, target *string) {
+	if value, ok := lookupEnv(name); ok {
+		*target = value
+	}
+}
+
+func (e *envParser) bool(name string, target *bool) {
+	if value, ok := lookupEnv(name); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid boolean in %s env var: %s", name, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+// lenientBool is like bool, but sets the target to false with a warning for
+// an invalid value.
+func (e *envParser) lenientBool(name string, target *bool) {
+	if value, ok := lookupEnv(name); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			e.warnings = append(e.warnings, fmt.Sprintf("invalid boolean in %s env var, using false: %s", name, value))
+		}
+		*target = parsed
+	}
+}
+
+func (e *envParser) int(name string, target *int) {
+	if value, ok := lookupEnv(name); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid integer in %s env var: %s", name, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (e *envParser) int64(name string, target *int64) {
+	if value, ok := lookupEnv(name); ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid integer in %s env var: %s", name, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (e *envParser) duration(name string, target *time.Duration) {
+	if value, ok := lookupEnv(name); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid duration in %s env var: %s", name, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (e *envParser) labels(name string, target *map[string]string) {
+	if value, ok := lookupEnv(name); ok {
+		parsed, err := utils.ConvertLabelsToMap(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("could not parse %s env var: %w", name, err))
+			return
+		}
+		*target = parsed
+	}
+}
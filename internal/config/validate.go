@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// profileNameRegexp matches valid profile names. They are used as the prefix
+// of volume IDs and must not contain a slash.
+var profileNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Validate checks the settings and returns all problems together.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Token == "" || c.TokenFile == "", "token (HCLOUD_TOKEN) and tokenFile (HCLOUD_TOKEN_FILE) are mutually exclusive")
+	check(c.PollingIntervalSeconds >= 0, "pollingIntervalSeconds (HCLOUD_POLLING_INTERVAL_SECONDS) must not be negative: %d", c.PollingIntervalSeconds)
+
+	if strings.HasPrefix(c.CSIEndpoint, "tcp://") {
+		check(c.CSITLS.CertFile != "", "csiTLS.certFile (CSI_TLS_CERT_FILE) is required for a tcp:// CSI endpoint")
+		check(c.CSITLS.KeyFile != "", "csiTLS.keyFile (CSI_TLS_KEY_FILE) is required for a tcp:// CSI endpoint")
+		check(c.CSITLS.CAFile != "", "csiTLS.caFile (CSI_TLS_CA_FILE) is required for a tcp:// CSI endpoint")
+	}
+
+	check(c.ShutdownTimeout >= 0, "shutdownTimeout (SHUTDOWN_TIMEOUT) must not be negative: %s", c.ShutdownTimeout)
+
+	check(c.Volume.LabelReconcileInterval >= 0, "volume.labelReconcileInterval (HCLOUD_VOLUME_LABEL_RECONCILE_INTERVAL) must not be negative: %s", c.Volume.LabelReconcileInterval)
+	check(c.Volume.CacheTTL >= 0, "volume.cacheTTL (HCLOUD_VOLUME_CACHE_TTL) must not be negative: %s", c.Volume.CacheTTL)
+	check(c.Volume.CacheSeedInterval >= 0, "volume.cacheSeedInterval (HCLOUD_VOLUME_CACHE_SEED_INTERVAL) must not be negative: %s", c.Volume.CacheSeedInterval)
+	check(c.Volume.UsageScanInterval >= 0, "volume.usageScanInterval (VOLUME_USAGE_SCAN_INTERVAL) must not be negative: %s", c.Volume.UsageScanInterval)
+	if c.Volume.QuotaGB == nil {
+		check(len(c.Volume.LocationQuotasGB) == 0, "volume.locationQuotasGB (HCLOUD_VOLUME_LOCATION_QUOTAS_GB) requires volume.quotaGB (HCLOUD_VOLUME_QUOTA_GB) to be set")
+	} else {
+		check(*c.Volume.QuotaGB >= 0, "volume.quotaGB (HCLOUD_VOLUME_QUOTA_GB) must not be negative: %d", *c.Volume.QuotaGB)
+	}
+	for location, quota := range c.Volume.LocationQuotasGB {
+		check(quota >= 0, "volume.locationQuotasGB of %s must not be negative: %d", location, quota)
+	}
+
+	check(c.Metrics.Endpoint != "", "metrics.endpoint (METRICS_ENDPOINT) must not be empty")
+	check((c.Metrics.TLSCertFile == "") == (c.Metrics.TLSKeyFile == ""), "metrics.tlsCertFile and metrics.tlsKeyFile must be set together")
+	check(c.Metrics.TLSClientCAFile == "" || c.Metrics.TLSCertFile != "", "metrics.tlsClientCAFile requires metrics.tlsCertFile")
+	check(c.Metrics.AuthToken == "" || c.Metrics.AuthTokenFile == "", "metrics.authToken and metrics.authTokenFile are mutually exclusive")
+
+	if _, err := ParseLogLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log.level (LOG_LEVEL): %w", err))
+	}
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format (LOG_FORMAT) must be text or json: %s", c.Log.Format)
+	for component, level := range c.Log.LevelOverrides {
+		if _, err := ParseLogLevel(level); err != nil {
+			errs = append(errs, fmt.Errorf("invalid log.levelOverrides of %s: %w", component, err))
+		}
+	}
+
+	switch c.LeaderElection.Backend {
+	case "none", "kubernetes", "nomad":
+	case "file":
+		check(c.LeaderElection.File != "", "leaderElection.file (LEADER_ELECTION_FILE) is required for the file backend")
+	default:
+		errs = append(errs, fmt.Errorf("leaderElection.backend (LEADER_ELECTION_BACKEND) must be none, kubernetes, nomad or file: %s", c.LeaderElection.Backend))
+	}
+	check(c.LeaderElection.LeaseDuration >= time.Second, "leaderElection.leaseDuration (LEADER_ELECTION_LEASE_DURATION) must be at least 1s: %s", c.LeaderElection.LeaseDuration)
+	check(c.LeaderElection.LeaseName != "", "leaderElection.leaseName must not be empty")
+
+	for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+		profile := c.Profiles[name]
+		check(profileNameRegexp.MatchString(name), "profiles: invalid name %q, must consist of lower case letters, digits and dashes", name)
+		check(profile.TokenFile != "", "profiles.%s.tokenFile must not be empty", name)
+		check(profile.DefaultLocation != "", "profiles.%s.defaultLocation must not be empty", name)
+		check(profile.QuotaGB == nil || *profile.QuotaGB >= 0, "profiles.%s.quotaGB must not be negative", name)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultWatchInterval is the interval in which the config file is checked for
+// changes.
+const DefaultWatchInterval = 10 * time.Second
+
+// Watcher reloads the config when the config file changes or the process
+// receives SIGHUP, and passes the new config to the subscribers. An invalid
+// config is logged and ignored, so the previous config stays in effect.
+//
+// Only some settings are applied at runtime, e.g. the extra volume labels, the
+// log levels and the token file. Other settings require a restart.
+type Watcher struct {
+	logger *slog.Logger
+	path   string
+
+	mu          sync.Mutex
+	current     *Config
+	modTime     time.Time
+	subscribers []func(cfg *Config)
+}
+
+// NewWatcher creates a Watcher for the config, which was loaded from path. The
+// path may be empty, if no config file is used.
+func NewWatcher(logger *slog.Logger, path string, cfg *Config) *Watcher {
+	w := &Watcher{logger: logger, path: path, current: cfg}
+	w.modTime, _ = w.stat()
+	return w
+}
+
+// Current returns the config, which is currently in effect.
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe registers a function, which is called with the new config after
+// every reload.
+func (w *Watcher) Subscribe(fn func(cfg *Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Run reloads the config until the context is canceled.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.logger.Info("reloading config after SIGHUP")
+			w.Reload()
+		case <-ticker.C:
+			w.mu.Lock()
+			previous := w.modTime
+			w.mu.Unlock()
+			if modTime, err := w.stat(); err == nil && !modTime.Equal(previous) {
+				w.logger.Info("reloading changed config file", "path", w.path)
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Reload loads the config and notifies the subscribers, if it is valid.
+func (w *Watcher) Reload() {
+	modTime, _ := w.stat()
+	cfg, err := Load(w.path)
+
+	w.mu.Lock()
+	w.modTime = modTime
+	if err != nil {
+		w.mu.Unlock()
+		w.logger.Error("failed to reload config, keeping the previous config", "err", err)
+		return
+	}
+	w.current = cfg
+	subscribers := w.subscribers
+	w.mu.Unlock()
+
+	for _, warning := range cfg.Warnings() {
+		w.logger.Warn(warning)
+	}
+
+	for _, fn := range subscribers {
+		fn(cfg)
+	}
+}
+
+// ServeHTTP serves the current config as YAML with the secrets redacted.
+func (w *Watcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := w.Current().Dump()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/yaml")
+	_, _ = rw.Write(data)
+}
+
+func (w *Watcher) stat() (time.Time, error) {
+	if w.path == "" {
+		return time.Time{}, os.ErrNotExist
+	}
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
@@ -0,0 +1,203 @@
+// Package credentials holds the hcloud API token, which can be replaced at
+// runtime without recreating the hcloud client.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReloadInterval is the interval in which the token file is read.
+const DefaultReloadInterval = 10 * time.Second
+
+// Observer records the generation of the token, which starts at 1 and is
+// increased every time the token changes.
+type Observer interface {
+	ObserveTokenGeneration(generation int64)
+}
+
+// Token is the hcloud API token used by the requests of a client.
+//
+// A token created with [NewFileToken] is re-read from its file by [Token.Run]
+// and after the API rejected a request with 401 Unauthorized, so a rotated
+// token is picked up without a restart.
+type Token struct {
+	value      atomic.Pointer[string]
+	generation atomic.Int64
+
+	logger   *slog.Logger
+	path     string
+	observer Observer
+
+	// reloadMu serializes the reads of the token file.
+	reloadMu sync.Mutex
+}
+
+func NewToken(value string) *Token {
+	t := &Token{}
+	t.value.Store(&value)
+	t.generation.Store(1)
+	return t
+}
+
+// NewObservedToken is like [NewToken], but reports the generation of the
+// token to the observer.
+func NewObservedToken(value string, observer Observer) *Token {
+	t := NewToken(value)
+	t.observer = observer
+	if observer != nil {
+		observer.ObserveTokenGeneration(1)
+	}
+	return t
+}
+
+// NewFileToken reads the token from the file at path.
+func NewFileToken(logger *slog.Logger, path string, observer Observer) (*Token, error) {
+	value, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := NewObservedToken(value, observer)
+	t.logger = logger
+	t.path = path
+	return t, nil
+}
+
+// Get returns the current token.
+func (t *Token) Get() string {
+	return *t.value.Load()
+}
+
+// Generation returns the number of the current token, which starts at 1.
+func (t *Token) Generation() int64 {
+	return t.generation.Load()
+}
+
+// Set replaces the token and reports whether it changed.
+func (t *Token) Set(value string) bool {
+	if *t.value.Swap(&value) == value {
+		return false
+	}
+	generation := t.generation.Add(1)
+	if t.observer != nil {
+		t.observer.ObserveTokenGeneration(generation)
+	}
+	return true
+}
+
+// Reload reads the token file and reports whether the token changed. It does
+// nothing, if the token was not read from a file. An empty or unreadable file
+// is an error and the previous token is kept.
+func (t *Token) Reload() (bool, error) {
+	if t.path == "" {
+		return false, nil
+	}
+
+	t.reloadMu.Lock()
+	defer t.reloadMu.Unlock()
+
+	value, err := readFile(t.path)
+	if err != nil {
+		return false, err
+	}
+	if !t.Set(value) {
+		return false, nil
+	}
+	t.logger.Info("reloaded API token", "path", t.path, "generation", t.Generation())
+	return true, nil
+}
+
+// Run reloads the token file until the context is canceled. It returns
+// immediately, if the token was not read from a file.
+func (t *Token) Run(ctx context.Context, interval time.Duration) {
+	if t.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := t.Reload(); err != nil {
+				t.logger.Error("failed to reload API token, keeping the previous token", "error", err)
+			}
+		}
+	}
+}
+
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", errors.New("token file is empty")
+	}
+	return value, nil
+}
+
+// Transport sets the Authorization header of the requests to the current
+// token, which takes precedence over the token the client was created with.
+//
+// If the API responds with 401 Unauthorized, the token file is read once more
+// and the request is retried, if the token changed in the meantime.
+func (t *Token) Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{token: t, next: next}
+}
+
+type transport struct {
+	token *Token
+	next  http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := t.token.Get()
+	resp, err := t.next.RoundTrip(authorize(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || t.token.path == "" {
+		return resp, err
+	}
+	// The body of the request can only be sent again, if it can be recreated.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	if _, err := t.token.Reload(); err != nil {
+		t.token.logger.Error("failed to reload API token after 401 Unauthorized", "error", err)
+	}
+	current := t.token.Get()
+	if current == token {
+		return resp, nil
+	}
+
+	retry := authorize(req, current)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return t.next.RoundTrip(retry)
+}
+
+func authorize(req *http.Request, token string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
@@ -0,0 +1,133 @@
+package credentials
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	token := NewToken("first")
+	client := &http.Client{Transport: token.Transport(http.DefaultTransport)}
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer first", authorization)
+
+	assert.False(t, token.Set("first"))
+	assert.True(t, token.Set("second"))
+
+	resp, err = client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer second", authorization)
+}
+
+func writeToken(t *testing.T, path, value string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(value+"\n"), 0o600))
+}
+
+type generationObserver struct {
+	generation atomic.Int64
+}
+
+func (o *generationObserver) ObserveTokenGeneration(generation int64) {
+	o.generation.Store(generation)
+}
+
+func TestObservedToken(t *testing.T) {
+	observer := &generationObserver{}
+	token := NewObservedToken("first", observer)
+	assert.Equal(t, int64(1), observer.generation.Load())
+
+	assert.False(t, token.Set("first"))
+	assert.Equal(t, int64(1), observer.generation.Load())
+	assert.True(t, token.Set("second"))
+	assert.Equal(t, int64(2), observer.generation.Load())
+}
+
+func TestFileToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeToken(t, path, "first")
+
+	observer := &generationObserver{}
+	token, err := NewFileToken(slog.New(slog.DiscardHandler), path, observer)
+	require.NoError(t, err)
+	assert.Equal(t, "first", token.Get())
+	assert.Equal(t, int64(1), observer.generation.Load())
+
+	changed, err := token.Reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	writeToken(t, path, "second")
+	changed, err = token.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "second", token.Get())
+	assert.Equal(t, int64(2), token.Generation())
+	assert.Equal(t, int64(2), observer.generation.Load())
+
+	writeToken(t, path, "")
+	_, err = token.Reload()
+	require.EqualError(t, err, "token file is empty")
+	assert.Equal(t, "second", token.Get())
+
+	_, err = NewFileToken(slog.New(slog.DiscardHandler), filepath.Join(t.TempDir(), "missing"), nil)
+	require.ErrorContains(t, err, "failed to read token file")
+}
+
+func TestTransportUnauthorized(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeToken(t, path, "old")
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Header.Get("Authorization")+" "+string(body))
+		if r.Header.Get("Authorization") != "Bearer new" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	token, err := NewFileToken(slog.New(slog.DiscardHandler), path, nil)
+	require.NoError(t, err)
+	client := &http.Client{Transport: token.Transport(http.DefaultTransport)}
+
+	t.Run("token unchanged", func(t *testing.T) {
+		requests = nil
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, []string{"Bearer old body"}, requests)
+	})
+
+	t.Run("token rotated", func(t *testing.T) {
+		requests = nil
+		writeToken(t, path, "new")
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []string{"Bearer old body", "Bearer new body"}, requests)
+	})
+}
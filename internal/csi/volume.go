@@ -1,15 +1,45 @@
 package csi
 
+import "maps"
+
 // Volume represents a volume in the CSI driver domain.
 type Volume struct {
 	ID          int64
 	Name        string
 	Size        int // GB
 	Location    string
+	NetworkZone string
 	LinuxDevice string
 	Server      *Server
+	Labels      map[string]string
 }
 
 func (v Volume) SizeBytes() int64 {
 	return int64(v.Size) * 1024 * 1024 * 1024
 }
+
+// Copy returns a deep copy of the volume, which can be changed without
+// affecting the original.
+func (v *Volume) Copy() *Volume {
+	c := *v
+	c.Labels = maps.Clone(v.Labels)
+	if v.Server != nil {
+		server := *v.Server
+		c.Server = &server
+	}
+	return &c
+}
+
+// VolumeUsage is the usage of a volume, which is published on the node.
+type VolumeUsage struct {
+	VolumeID   string
+	TargetPath string
+	FSType     string
+	ReadOnly   bool
+	Encrypted  bool
+
+	UsedBytes      int64
+	AvailableBytes int64
+	UsedINodes     int64
+	FreeINodes     int64
+}
@@ -0,0 +1,195 @@
+package doctor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/mount-utils"
+
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/metadata"
+)
+
+// The paths are variables, so the tests can replace them.
+var (
+	sysModuleDir    = "/sys/module"
+	procModulesPath = "/proc/modules"
+	libModulesDir   = "/lib/modules"
+	mountInfoPath   = "/proc/self/mountinfo"
+)
+
+// NodeChecks returns the checks of the prerequisites of the node plugin. The
+// kubelet dir is the directory, below which the container orchestrator
+// publishes volumes.
+func NodeChecks(metadataClient *metadata.Client, kubeletDir string) []Check {
+	checks := []Check{KernelModuleCheck("dm_crypt")}
+	checks = append(checks, ToolChecks(volumes.RequiredTools)...)
+	checks = append(checks,
+		FileCheck("xfs-config", volumes.XFSDefaultConfigPath),
+		MountPropagationCheck(kubeletDir),
+		MetadataCheck(metadataClient),
+	)
+	return checks
+}
+
+// KernelModuleCheck checks that the kernel module is loaded or built into the
+// kernel.
+func KernelModuleCheck(name string) Check {
+	return Check{
+		Name: "kernel-module-" + name,
+		Run: func(context.Context) (string, error) {
+			loaded, err := moduleLoaded(name)
+			if loaded {
+				return "loaded", nil
+			}
+			if moduleBuiltin(name) {
+				return "built into the kernel", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("kernel module %s is not loaded, load it with `modprobe %s`", name, name)
+		},
+	}
+}
+
+func moduleLoaded(name string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(sysModuleDir, name)); err == nil {
+		return true, nil
+	}
+
+	f, err := os.Open(procModulesPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read loaded kernel modules: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if module, _, _ := strings.Cut(scanner.Text(), " "); module == name {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func moduleBuiltin(name string) bool {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return false
+	}
+	release := unix.ByteSliceToString(uname.Release[:])
+
+	data, err := os.ReadFile(filepath.Join(libModulesDir, release, "modules.builtin"))
+	if err != nil {
+		return false
+	}
+	// Module files use dashes and underscores interchangeably.
+	for _, line := range strings.Split(string(data), "\n") {
+		module := strings.TrimSuffix(filepath.Base(line), ".ko")
+		if strings.ReplaceAll(module, "-", "_") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolChecks checks that each tool is installed and reports its version.
+func ToolChecks(tools []volumes.Tool) []Check {
+	checks := make([]Check, 0, len(tools))
+	for _, tool := range tools {
+		checks = append(checks, Check{
+			Name: "binary-" + tool.Name,
+			Run: func(ctx context.Context) (string, error) {
+				versions, err := volumes.CheckTools(ctx, []volumes.Tool{tool})
+				if err != nil {
+					return "", err
+				}
+				if versions[0].Version != "" {
+					return fmt.Sprintf("%s (%s)", versions[0].Path, versions[0].Version), nil
+				}
+				return versions[0].Path, nil
+			},
+		})
+	}
+	return checks
+}
+
+// FileCheck checks that the file exists.
+func FileCheck(name, path string) Check {
+	return Check{
+		Name: name,
+		Run: func(context.Context) (string, error) {
+			if _, err := os.Stat(path); err != nil {
+				return "", err
+			}
+			return path, nil
+		},
+	}
+}
+
+// MountPropagationCheck checks that the mount of the dir propagates mounts to
+// the host, which is required for the volumes published by the node plugin to
+// be visible to the workloads.
+func MountPropagationCheck(dir string) Check {
+	return Check{
+		Name: "mount-propagation",
+		Run: func(context.Context) (string, error) {
+			if _, err := os.Stat(dir); err != nil {
+				return "", err
+			}
+			infos, err := mount.ParseMountInfo(mountInfoPath)
+			if err != nil {
+				return "", fmt.Errorf("failed to read the mount table: %w", err)
+			}
+
+			// The dir belongs to the mount with the longest matching mount point.
+			var found *mount.MountInfo
+			for i, info := range infos {
+				if !isPathBelow(dir, info.MountPoint) {
+					continue
+				}
+				if found == nil || len(info.MountPoint) >= len(found.MountPoint) {
+					found = &infos[i]
+				}
+			}
+			if found == nil {
+				return "", fmt.Errorf("no mount found for %s", dir)
+			}
+
+			for _, field := range found.OptionalFields {
+				if strings.HasPrefix(field, "shared:") {
+					return fmt.Sprintf("%s is mounted with shared propagation", found.MountPoint), nil
+				}
+			}
+			return "", fmt.Errorf("%s is not mounted with shared propagation, mount it with `mountPropagation: Bidirectional`", found.MountPoint)
+		},
+	}
+}
+
+func isPathBelow(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// MetadataCheck checks that the metadata service is reachable.
+func MetadataCheck(client *metadata.Client) Check {
+	return Check{
+		Name: "metadata-service",
+		Run: func(ctx context.Context) (string, error) {
+			if !client.IsHcloudServerWithContext(ctx) {
+				return "", errors.New("the metadata service is not reachable, the node plugin only works on Hetzner Cloud servers")
+			}
+			id, err := client.InstanceIDWithContext(ctx)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("server %d", id), nil
+		},
+	}
+}
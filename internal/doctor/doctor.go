@@ -0,0 +1,78 @@
+// Package doctor checks the prerequisites of the node plugin on a server, like
+// kernel modules, binaries and mount propagation, and reports the results.
+// Most problems with custom images come down to one of them.
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Status is the outcome of a Check.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+)
+
+// Check verifies a single prerequisite. Run returns a short description of
+// what was found, or an error describing what is missing.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (string, error)
+}
+
+// Result is the outcome of a Check.
+type Result struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+}
+
+// Run runs all checks, independent of failures of earlier checks.
+func Run(ctx context.Context, checks []Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks {
+		message, err := check.Run(ctx)
+		result := Result{Name: check.Name, Status: StatusPass, Message: message}
+		if err != nil {
+			result.Status = StatusFail
+			result.Message = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Passed reports whether all checks passed.
+func Passed(results []Result) bool {
+	for _, result := range results {
+		if result.Status != StatusPass {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteText writes the results as a table.
+func WriteText(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		fmt.Fprintf(tw, "[%s]\t%s\t%s\n", result.Status, result.Name, result.Message)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the results as JSON object.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Passed  bool     `json:"passed"`
+		Results []Result `json:"results"`
+	}{Passed: Passed(results), Results: results})
+}
@@ -0,0 +1,80 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	results := Run(context.Background(), []Check{
+		{Name: "ok", Run: func(context.Context) (string, error) { return "found", nil }},
+		{Name: "broken", Run: func(context.Context) (string, error) { return "", errors.New("missing") }},
+	})
+
+	assert.Equal(t, []Result{
+		{Name: "ok", Status: StatusPass, Message: "found"},
+		{Name: "broken", Status: StatusFail, Message: "missing"},
+	}, results)
+	assert.False(t, Passed(results))
+
+	var text bytes.Buffer
+	require.NoError(t, WriteText(&text, results))
+	assert.Equal(t, "[pass]  ok      found\n[fail]  broken  missing\n", text.String())
+
+	var report struct {
+		Passed  bool     `json:"passed"`
+		Results []Result `json:"results"`
+	}
+	var jsonOutput bytes.Buffer
+	require.NoError(t, WriteJSON(&jsonOutput, results))
+	require.NoError(t, json.Unmarshal(jsonOutput.Bytes(), &report))
+	assert.False(t, report.Passed)
+	assert.Equal(t, results, report.Results)
+}
+
+func TestKernelModuleCheck(t *testing.T) {
+	dir := t.TempDir()
+	sysModuleDir = filepath.Join(dir, "sys")
+	procModulesPath = filepath.Join(dir, "modules")
+	libModulesDir = filepath.Join(dir, "lib")
+	t.Cleanup(func() {
+		sysModuleDir, procModulesPath, libModulesDir = "/sys/module", "/proc/modules", "/lib/modules"
+	})
+
+	require.NoError(t, os.WriteFile(procModulesPath, []byte("dm_crypt 61440 0 - Live 0x0000000000000000\n"), 0o644))
+
+	message, err := KernelModuleCheck("dm_crypt").Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "loaded", message)
+
+	_, err = KernelModuleCheck("dm_integrity").Run(context.Background())
+	require.EqualError(t, err, "kernel module dm_integrity is not loaded, load it with `modprobe dm_integrity`")
+}
+
+func TestMountPropagationCheck(t *testing.T) {
+	dir := t.TempDir()
+	mountInfoPath = filepath.Join(dir, "mountinfo")
+	t.Cleanup(func() { mountInfoPath = "/proc/self/mountinfo" })
+
+	writeMountInfo := func(rootFields string) {
+		content := "1 0 8:1 / / rw,relatime " + rootFields + " - ext4 /dev/sda1 rw\n"
+		require.NoError(t, os.WriteFile(mountInfoPath, []byte(content), 0o644))
+	}
+
+	writeMountInfo("shared:1")
+	message, err := MountPropagationCheck(dir).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "/ is mounted with shared propagation", message)
+
+	writeMountInfo("master:1")
+	_, err = MountPropagationCheck(dir).Run(context.Background())
+	require.EqualError(t, err, "/ is not mounted with shared propagation, mount it with `mountPropagation: Bidirectional`")
+}
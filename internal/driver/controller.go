@@ -6,15 +6,18 @@ import (
 	"fmt"
 	"log/slog"
 	"maps"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
 
 	proto "github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	"github.com/hetznercloud/csi-driver/internal/audit"
 	"github.com/hetznercloud/csi-driver/internal/csi"
-	"github.com/hetznercloud/csi-driver/internal/utils"
+	"github.com/hetznercloud/csi-driver/internal/ratelimit"
 	"github.com/hetznercloud/csi-driver/internal/volumes"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
@@ -25,6 +28,8 @@ const (
 	parameterKeyPVName       = "csi.storage.k8s.io/pv/name"
 	parameterKeyLabels       = "labels"
 
+	parameterKeyVolumeNameTemplate = "volumeNameTemplate"
+
 	labelKeyPVCName      = "pvc-name"
 	labelKeyPVCNamespace = "pvc-namespace"
 	labelKeyPVName       = "pv-name"
@@ -36,11 +41,25 @@ const (
 type ControllerService struct {
 	proto.UnimplementedControllerServer
 
-	logger                   *slog.Logger
-	volumeService            volumes.Service
-	location                 string
-	enableProvidedByTopology bool
-	extraVolumeLabels        map[string]string
+	logger                    *slog.Logger
+	volumeService             volumes.Service
+	location                  string
+	enableProvidedByTopology  bool
+	enableNetworkZoneTopology bool
+	volumeQuota               *VolumeQuota
+	profiles                  map[string]*Profile
+
+	extraVolumeLabelsMu sync.RWMutex
+	extraVolumeLabels   map[string]string
+}
+
+// VolumeQuota describes the volume capacity available to the driver. It is
+// used to report the available capacity through GetCapacity.
+type VolumeQuota struct {
+	// Total is the volume capacity of the project in GB.
+	Total int
+	// Locations optionally limits the volume capacity per location in GB.
+	Locations map[string]int
 }
 
 func NewControllerService(
@@ -48,18 +67,37 @@ func NewControllerService(
 	volumeService volumes.Service,
 	location string,
 	enableProvidedByTopology bool,
+	enableNetworkZoneTopology bool,
 	extraVolumeLabels map[string]string,
+	volumeQuota *VolumeQuota,
 ) *ControllerService {
 	return &ControllerService{
-		logger:                   logger,
-		volumeService:            volumeService,
-		location:                 location,
-		enableProvidedByTopology: enableProvidedByTopology,
-		extraVolumeLabels:        extraVolumeLabels,
+		logger:                    logger,
+		volumeService:             volumeService,
+		location:                  location,
+		enableProvidedByTopology:  enableProvidedByTopology,
+		enableNetworkZoneTopology: enableNetworkZoneTopology,
+		extraVolumeLabels:         extraVolumeLabels,
+		volumeQuota:               volumeQuota,
 	}
 }
 
+// SetExtraVolumeLabels replaces the labels added to new volumes, e.g. after
+// the config was reloaded.
+func (s *ControllerService) SetExtraVolumeLabels(labels map[string]string) {
+	s.extraVolumeLabelsMu.Lock()
+	defer s.extraVolumeLabelsMu.Unlock()
+	s.extraVolumeLabels = maps.Clone(labels)
+}
+
 func (s *ControllerService) CreateVolume(ctx context.Context, req *proto.CreateVolumeRequest) (*proto.CreateVolumeResponse, error) {
+	ctx = audit.WithRequest(ctx, audit.Request{
+		Method:       "CreateVolume",
+		Name:         req.GetName(),
+		PVCName:      req.GetParameters()[parameterKeyPVCName],
+		PVCNamespace: req.GetParameters()[parameterKeyPVCNamespace],
+	})
+
 	if req.GetName() == "" {
 		return nil, status.Error(codes.InvalidArgument, "missing name")
 	}
@@ -83,90 +121,120 @@ func (s *ControllerService) CreateVolume(ctx context.Context, req *proto.CreateV
 	// none of them carry a location segment, we must not silently fall back to
 	// the controller's location: that can provision the volume in a location the
 	// selected node can not reach, leaving the pod unschedulable (see #1428).
-	location := s.location
+	var locations []string
 	if reqs := req.GetAccessibilityRequirements(); len(reqs.GetPreferred()) > 0 || len(reqs.GetRequisite()) > 0 {
-		loc := locationFromTopologyRequirement(reqs)
-		if loc == nil {
+		locations = locationsFromTopologyRequirement(reqs)
+		if len(locations) == 0 {
 			return nil, status.Errorf(codes.InvalidArgument,
 				"accessibility requirements were provided but none contained a %q topology segment; "+
 					"can not determine the location to create the volume in",
 				TopologySegmentLocation)
 		}
-		location = *loc
 	}
 
 	volumeLabels := map[string]string{
 		labelKeyManagedBy: "csi-driver",
 	}
 
-	maps.Copy(volumeLabels, s.extraVolumeLabels)
+	s.extraVolumeLabelsMu.RLock()
+	if !setTrackedLabels(volumeLabels, s.extraVolumeLabels, labelKeyExtraLabels) {
+		s.logger.Warn("too many extra volume labels, the label reconciler does not remove all of them once they are no longer configured",
+			"max", maxTrackedLabels)
+	}
+	s.extraVolumeLabelsMu.RUnlock()
+
+	// The label reconciler derives the labels from the same parameters.
+	parameterLabels, customLabels, err := parameterVolumeLabels(req.GetParameters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	maps.Copy(volumeLabels, parameterLabels)
+	if !setTrackedLabels(volumeLabels, customLabels, labelKeyParameterLabels) {
+		s.logger.Warn("too many labels in the labels parameter, the label reconciler does not remove all of them once they are no longer configured",
+			"max", maxTrackedLabels)
+	}
+
+	volumeName := req.GetName()
+	var profileName string
 
 	for key, value := range req.GetParameters() {
 		switch strings.ToLower(key) {
-		case parameterKeyPVCName:
-			volumeLabels[labelKeyPVCName] = value
-		case parameterKeyPVCNamespace:
-			volumeLabels[labelKeyPVCNamespace] = value
-		case parameterKeyPVName:
-			volumeLabels[labelKeyPVName] = value
-		case parameterKeyLabels:
-			customLabels, err := utils.ConvertLabelsToMap(value)
+		case parameterKeyPVCName, parameterKeyPVCNamespace, parameterKeyPVName, parameterKeyLabels:
+			// Handled by parameterVolumeLabels.
+		case strings.ToLower(parameterKeyVolumeNameTemplate):
+			name, err := renderVolumeName(value, newVolumeNameTemplateData(req.GetName(), req.GetParameters()))
 			if err != nil {
-				return nil, status.Errorf(codes.InvalidArgument, "Invalid format of parameter labels: %s", err)
+				return nil, status.Errorf(codes.InvalidArgument, "invalid parameter %s: %s", parameterKeyVolumeNameTemplate, err)
 			}
-			maps.Copy(volumeLabels, customLabels)
+			volumeName = name
+		case parameterKeyProfile:
+			profileName = value
 		default:
 			s.logger.Warn(fmt.Sprintf("invalid parameter key %s for CreateVolume", key))
 		}
 	}
 
-	// Validate all labels before sending to the API.
-	for k, v := range volumeLabels {
-		// Truncate label values to fit API requirements
-		if len(v) > MaxLabelValueLength {
-			truncated := v[len(v)-MaxLabelValueLength:]
-			// After truncation the first character might not be alphanumeric
-			// (e.g. a dash), which violates the label spec. Strip any
-			// leading non-alphanumeric characters.
-			truncated = strings.TrimLeftFunc(truncated, func(r rune) bool {
-				return !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
-			})
-			s.logger.Warn(
-				"volume label value truncated",
-				"volume", req.GetName(),
-				"key", k,
-				"original", v,
-				"truncated", truncated,
-			)
-			volumeLabels[k] = truncated
-		}
+	profile, err := s.profile(profileName)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parameter %s: %s", parameterKeyProfile, err)
+	}
+	if locations == nil {
+		locations = []string{profile.Location}
 	}
 
-	labelsIface := make(map[string]any, len(volumeLabels))
-	for k, v := range volumeLabels {
-		labelsIface[k] = v
+	if volumeName != req.GetName() {
+		// The volume name differs from the name requested by the container
+		// orchestration system. Track the requested name, so retries can verify
+		// that an existing volume with the same name belongs to this request.
+		volumeLabels[volumes.LabelKeyRequestName] = req.GetName()
 	}
-	if _, err := hcloud.ValidateResourceLabels(labelsIface); err != nil {
+
+	if err := normalizeVolumeLabels(s.logger, req.GetName(), volumeLabels); err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "invalid volume labels: %s", err)
 	}
 
 	// Create the volume. The service handles idempotency as required by the CSI spec.
-	volume, err := s.volumeService.Create(ctx, volumes.CreateOpts{
-		Name:     req.GetName(),
-		MinSize:  minSize,
-		MaxSize:  maxSize,
-		Location: location,
-		Labels:   volumeLabels,
-	})
+	// The locations are tried in order, until the volume could be created in one of them.
+	var volume *csi.Volume
+	for i, location := range locations {
+		volume, err = profile.VolumeService.Create(ctx, volumes.CreateOpts{
+			Name:     volumeName,
+			MinSize:  minSize,
+			MaxSize:  maxSize,
+			Location: location,
+			Labels:   volumeLabels,
+		})
+		if err == nil {
+			break
+		}
+
+		// Only errors specific to the location are a reason to try the next
+		// one. A previous attempt might have created the volume in one of the
+		// next locations, but a conflicting volume is a conflict everywhere.
+		retryable := errors.Is(err, volumes.ErrResourceUnavailable) || errors.Is(err, volumes.ErrVolumeInOtherLocation)
+		if !retryable || i == len(locations)-1 {
+			break
+		}
+
+		s.logger.Warn(
+			"failed to create volume in location, trying next location",
+			"volume-name", volumeName,
+			"location", location,
+			"next-location", locations[i+1],
+			"err", err,
+		)
+	}
 	if err != nil {
 		s.logger.Error(
 			"failed to create volume",
 			"err", err,
 		)
 		code := codes.Internal
-		switch { //nolint:gocritic
+		switch {
 		case errors.Is(err, volumes.ErrVolumeAlreadyExists):
 			code = codes.AlreadyExists
+		case errors.Is(err, volumes.ErrResourceUnavailable):
+			code = codes.ResourceExhausted
 		}
 		return nil, status.Error(code, fmt.Sprintf("failed to create volume: %s", err))
 	}
@@ -174,13 +242,10 @@ func (s *ControllerService) CreateVolume(ctx context.Context, req *proto.CreateV
 		"created volume",
 		"volume-id", volume.ID,
 		"volume-name", volume.Name,
+		"profile", profileName,
 	)
 
-	topology := &proto.Topology{
-		Segments: map[string]string{
-			TopologySegmentLocation: volume.Location,
-		},
-	}
+	topology := s.volumeTopology(volume)
 
 	if s.enableProvidedByTopology {
 		topology.Segments[ProvidedByLabel] = "cloud"
@@ -188,7 +253,7 @@ func (s *ControllerService) CreateVolume(ctx context.Context, req *proto.CreateV
 
 	resp := &proto.CreateVolumeResponse{
 		Volume: &proto.Volume{
-			VolumeId:      strconv.FormatInt(volume.ID, 10),
+			VolumeId:      formatProfileVolumeID(profileName, volume.ID),
 			CapacityBytes: volume.SizeBytes(),
 			AccessibleTopology: []*proto.Topology{
 				topology,
@@ -202,13 +267,21 @@ func (s *ControllerService) CreateVolume(ctx context.Context, req *proto.CreateV
 }
 
 func (s *ControllerService) DeleteVolume(ctx context.Context, req *proto.DeleteVolumeRequest) (*proto.DeleteVolumeResponse, error) {
+	ctx = audit.WithRequest(ctx, audit.Request{Method: "DeleteVolume", Name: req.GetVolumeId()})
+
 	if req.GetVolumeId() == "" {
 		return nil, status.Error(codes.InvalidArgument, "invalid volume id")
 	}
 
-	if volumeID, err := parseVolumeID(req.GetVolumeId()); err == nil {
+	if profileName, volumeID, err := parseProfileVolumeID(req.GetVolumeId()); err == nil {
+		// The volume can not be deleted in an unknown profile, but must not be
+		// reported as deleted either, as it would be leaked.
+		profile, err := s.profile(profileName)
+		if err != nil {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
 		volume := &csi.Volume{ID: volumeID}
-		if err := s.volumeService.Delete(ctx, volume); err != nil {
+		if err := profile.VolumeService.Delete(ctx, volume); err != nil {
 			if errors.Is(err, volumes.ErrVolumeNotFound) {
 				return &proto.DeleteVolumeResponse{}, nil
 			}
@@ -224,6 +297,14 @@ func (s *ControllerService) DeleteVolume(ctx context.Context, req *proto.DeleteV
 }
 
 func (s *ControllerService) ControllerPublishVolume(ctx context.Context, req *proto.ControllerPublishVolumeRequest) (*proto.ControllerPublishVolumeResponse, error) {
+	// Attaching a volume blocks the workload, so it may use the reserved rate limit budget.
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityUrgent)
+	ctx = audit.WithRequest(ctx, audit.Request{
+		Method: "ControllerPublishVolume",
+		Name:   req.GetVolumeId(),
+		NodeID: req.GetNodeId(),
+	})
+
 	if req.GetVolumeId() == "" {
 		return nil, status.Error(codes.InvalidArgument, "missing volume id")
 	}
@@ -234,7 +315,7 @@ func (s *ControllerService) ControllerPublishVolume(ctx context.Context, req *pr
 		return nil, status.Error(codes.InvalidArgument, "missing volume capabilities")
 	}
 
-	volumeID, err := parseVolumeID(req.GetVolumeId())
+	profile, volumeID, err := s.parseVolumeID(req.GetVolumeId())
 	if err != nil {
 		return nil, status.Error(codes.NotFound, "volume not found")
 	}
@@ -254,7 +335,7 @@ func (s *ControllerService) ControllerPublishVolume(ctx context.Context, req *pr
 	volume := &csi.Volume{ID: volumeID}
 	server := &csi.Server{ID: serverID}
 
-	if err := s.volumeService.Attach(ctx, volume, server); err != nil {
+	if err := profile.VolumeService.Attach(ctx, volume, server); err != nil {
 		code := codes.Internal
 		switch {
 		case errors.Is(err, volumes.ErrVolumeNotFound):
@@ -271,7 +352,7 @@ func (s *ControllerService) ControllerPublishVolume(ctx context.Context, req *pr
 		return nil, status.Error(code, fmt.Sprintf("failed to publish volume: %s", err))
 	}
 
-	volume, err = s.volumeService.GetByID(ctx, volumeID)
+	volume, err = profile.VolumeService.GetByID(ctx, volumeID)
 	if err != nil {
 		switch {
 		case errors.Is(err, volumes.ErrVolumeNotFound):
@@ -290,11 +371,18 @@ func (s *ControllerService) ControllerPublishVolume(ctx context.Context, req *pr
 }
 
 func (s *ControllerService) ControllerUnpublishVolume(ctx context.Context, req *proto.ControllerUnpublishVolumeRequest) (*proto.ControllerUnpublishVolumeResponse, error) {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityUrgent)
+	ctx = audit.WithRequest(ctx, audit.Request{
+		Method: "ControllerUnpublishVolume",
+		Name:   req.GetVolumeId(),
+		NodeID: req.GetNodeId(),
+	})
+
 	if req.GetVolumeId() == "" {
 		return nil, status.Error(codes.InvalidArgument, "invalid volume id")
 	}
 
-	volumeID, err := parseVolumeID(req.GetVolumeId())
+	profile, volumeID, err := s.parseVolumeID(req.GetVolumeId())
 	if err != nil {
 		return nil, status.Error(codes.NotFound, "volume not found")
 	}
@@ -309,7 +397,7 @@ func (s *ControllerService) ControllerUnpublishVolume(ctx context.Context, req *
 		server = &csi.Server{ID: serverID}
 	}
 
-	if err := s.volumeService.Detach(ctx, volume, server); err != nil {
+	if err := profile.VolumeService.Detach(ctx, volume, server); err != nil {
 		code := codes.Internal
 		switch {
 		case errors.Is(err, volumes.ErrVolumeNotFound): // Based on the spec it is save to assume that the call was successful if the volume is not found
@@ -335,12 +423,12 @@ func (s *ControllerService) ValidateVolumeCapabilities(ctx context.Context, req
 		return nil, status.Error(codes.InvalidArgument, "missing volume capabilities")
 	}
 
-	volumeID, err := parseVolumeID(req.GetVolumeId())
+	profile, volumeID, err := s.parseVolumeID(req.GetVolumeId())
 	if err != nil {
 		return nil, status.Error(codes.NotFound, "volume not found")
 	}
 
-	volume, err := s.volumeService.GetByID(ctx, volumeID)
+	volume, err := profile.VolumeService.GetByID(ctx, volumeID)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -365,30 +453,36 @@ func (s *ControllerService) ValidateVolumeCapabilities(ctx context.Context, req
 	return resp, nil
 }
 
+// ListVolumes lists the volumes of the default project and all profiles. It
+// fails, if the volumes of any of them cannot be listed, as callers would treat
+// the volumes missing from a partial list as deleted.
 func (s *ControllerService) ListVolumes(ctx context.Context, req *proto.ListVolumesRequest) (*proto.ListVolumesResponse, error) {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityLow)
+
 	if req.GetStartingToken() != "" {
 		return nil, status.Error(codes.Aborted, "Starting token is not implemented")
 	}
 
-	vols, err := s.volumeService.All(ctx)
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
+	resp := &proto.ListVolumesResponse{}
+	for _, profile := range s.allProfiles() {
+		vols, err := profile.VolumeService.All(ctx)
+		if err != nil {
+			if profile.Name != "" {
+				return nil, status.Errorf(codes.Internal, "failed to list volumes of profile %s: %s", profile.Name, err)
+			}
+			return nil, status.Error(codes.Internal, err.Error())
+		}
 
-	resp := &proto.ListVolumesResponse{Entries: make([]*proto.ListVolumesResponse_Entry, len(vols))}
-	for i, volume := range vols {
-		resp.Entries[i] = &proto.ListVolumesResponse_Entry{
-			Volume: &proto.Volume{
-				VolumeId:      strconv.FormatInt(volume.ID, 10),
-				CapacityBytes: volume.SizeBytes(),
-				AccessibleTopology: []*proto.Topology{
-					{
-						Segments: map[string]string{
-							TopologySegmentLocation: volume.Location,
-						},
+		for _, volume := range vols {
+			resp.Entries = append(resp.Entries, &proto.ListVolumesResponse_Entry{
+				Volume: &proto.Volume{
+					VolumeId:      formatProfileVolumeID(profile.Name, volume.ID),
+					CapacityBytes: volume.SizeBytes(),
+					AccessibleTopology: []*proto.Topology{
+						s.volumeTopology(volume),
 					},
 				},
-			},
+			})
 		}
 	}
 
@@ -435,15 +529,81 @@ func (s *ControllerService) ControllerGetCapabilities(context.Context, *proto.Co
 			},
 		},
 	}
+
+	if slices.ContainsFunc(s.allProfiles(), func(p *Profile) bool { return p.VolumeQuota != nil }) {
+		resp.Capabilities = append(resp.Capabilities, &proto.ControllerServiceCapability{
+			Type: &proto.ControllerServiceCapability_Rpc{
+				Rpc: &proto.ControllerServiceCapability_RPC{
+					Type: proto.ControllerServiceCapability_RPC_GET_CAPACITY,
+				},
+			},
+		})
+	}
+	return resp, nil
+}
+
+func (s *ControllerService) GetCapacity(ctx context.Context, req *proto.GetCapacityRequest) (*proto.GetCapacityResponse, error) {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityLow)
+
+	profile, err := s.profile(req.GetParameters()[parameterKeyProfile])
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid parameter %s: %s", parameterKeyProfile, err)
+	}
+	if profile.VolumeQuota == nil {
+		return nil, status.Error(codes.Unimplemented, "volume quota is not configured")
+	}
+
+	for _, capability := range req.GetVolumeCapabilities() {
+		if !isCapabilitySupported(capability) {
+			return &proto.GetCapacityResponse{}, nil
+		}
+	}
+
+	location := req.GetAccessibleTopology().GetSegments()[TopologySegmentLocation]
+
+	vols, err := profile.VolumeService.All(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var usedTotal, usedLocation int
+	for _, volume := range vols {
+		usedTotal += volume.Size
+		if volume.Location == location {
+			usedLocation += volume.Size
+		}
+	}
+
+	available := profile.VolumeQuota.Total - usedTotal
+	if quota, ok := profile.VolumeQuota.Locations[location]; ok && location != "" {
+		available = min(available, quota-usedLocation)
+	}
+	available = max(available, 0)
+
+	s.logger.Debug(
+		"calculated available capacity",
+		"location", location,
+		"used-total", usedTotal,
+		"used-location", usedLocation,
+		"available", available,
+	)
+
+	resp := &proto.GetCapacityResponse{
+		AvailableCapacity: gbToBytes(available),
+		MaximumVolumeSize: wrapperspb.Int64(gbToBytes(min(available, MaxVolumeSize))),
+		MinimumVolumeSize: wrapperspb.Int64(gbToBytes(MinVolumeSize)),
+	}
 	return resp, nil
 }
 
 func (s *ControllerService) ControllerExpandVolume(ctx context.Context, req *proto.ControllerExpandVolumeRequest) (*proto.ControllerExpandVolumeResponse, error) {
+	ctx = audit.WithRequest(ctx, audit.Request{Method: "ControllerExpandVolume", Name: req.GetVolumeId()})
+
 	if req.GetVolumeId() == "" {
 		return nil, status.Error(codes.InvalidArgument, "invalid volume id")
 	}
 
-	volumeID, err := parseVolumeID(req.GetVolumeId())
+	profile, volumeID, err := s.parseVolumeID(req.GetVolumeId())
 	if err != nil {
 		return nil, status.Error(codes.NotFound, "volume not found")
 	}
@@ -454,7 +614,7 @@ func (s *ControllerService) ControllerExpandVolume(ctx context.Context, req *pro
 		return nil, status.Error(codes.OutOfRange, "invalid capacity range")
 	}
 
-	if err := s.volumeService.Resize(ctx, volume, minSize); err != nil {
+	if err := profile.VolumeService.Resize(ctx, volume, minSize); err != nil {
 		code := codes.Internal
 		switch { //nolint:gocritic
 		case errors.Is(err, volumes.ErrVolumeNotFound):
@@ -463,7 +623,7 @@ func (s *ControllerService) ControllerExpandVolume(ctx context.Context, req *pro
 		return nil, status.Error(code, fmt.Sprintf("failed to expand volume: %s", err))
 	}
 
-	if volume, err = s.volumeService.GetByID(ctx, volumeID); err != nil {
+	if volume, err = profile.VolumeService.GetByID(ctx, volumeID); err != nil {
 		code := codes.Internal
 		switch { //nolint:gocritic
 		case errors.Is(err, volumes.ErrVolumeNotFound):
@@ -478,3 +638,50 @@ func (s *ControllerService) ControllerExpandVolume(ctx context.Context, req *pro
 	}
 	return resp, nil
 }
+
+// volumeTopology returns the topology segments in which the volume is accessible.
+func (s *ControllerService) volumeTopology(volume *csi.Volume) *proto.Topology {
+	topology := &proto.Topology{
+		Segments: map[string]string{
+			TopologySegmentLocation: volume.Location,
+		},
+	}
+
+	if s.enableNetworkZoneTopology && volume.NetworkZone != "" {
+		topology.Segments[TopologySegmentNetworkZone] = volume.NetworkZone
+	}
+
+	return topology
+}
+
+// normalizeVolumeLabels truncates label values that exceed the API limits and
+// validates the resulting labels. The labels are modified in place.
+func normalizeVolumeLabels(logger *slog.Logger, volumeName string, labels map[string]string) error {
+	for k, v := range labels {
+		// Truncate label values to fit API requirements
+		if len(v) > MaxLabelValueLength {
+			truncated := v[len(v)-MaxLabelValueLength:]
+			// After truncation the first character might not be alphanumeric
+			// (e.g. a dash), which violates the label spec. Strip any
+			// leading non-alphanumeric characters.
+			truncated = strings.TrimLeftFunc(truncated, func(r rune) bool {
+				return !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
+			})
+			logger.Warn(
+				"volume label value truncated",
+				"volume", volumeName,
+				"key", k,
+				"original", v,
+				"truncated", truncated,
+			)
+			labels[k] = truncated
+		}
+	}
+
+	labelsIface := make(map[string]any, len(labels))
+	for k, v := range labels {
+		labelsIface[k] = v
+	}
+	_, err := hcloud.ValidateResourceLabels(labelsIface)
+	return err
+}
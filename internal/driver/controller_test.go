@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"slices"
 	"testing"
 
 	proto "github.com/container-storage-interface/spec/lib/go/csi"
@@ -34,7 +35,9 @@ func newControllerServiceTestEnv() *controllerServiceTestEnv {
 			volumeService,
 			"testloc",
 			false,
+			false,
 			map[string]string{"clusterName": "myCluster"},
+			nil,
 		),
 		volumeService: volumeService,
 	}
@@ -246,6 +249,53 @@ func TestControllerServiceCreateVolumeWithTruncatedLabelStartingWithDash(t *test
 	}
 }
 
+func TestControllerServiceCreateVolumeWithNameTemplate(t *testing.T) {
+	env := newControllerServiceTestEnv()
+
+	env.volumeService.CreateFunc = func(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error) {
+		if opts.Name != "default-data-"+newVolumeNameTemplateData("testvol", nil).Short {
+			t.Errorf("unexpected name passed to volume service: %s", opts.Name)
+		}
+		if v := opts.Labels[volumes.LabelKeyRequestName]; v != "testvol" {
+			t.Errorf("unexpected request name label passed to volume service: %s", v)
+		}
+		return &csi.Volume{
+			ID:       1,
+			Name:     opts.Name,
+			Size:     opts.MinSize,
+			Location: opts.Location,
+		}, nil
+	}
+
+	req := &proto.CreateVolumeRequest{
+		Name: "testvol",
+		Parameters: map[string]string{
+			parameterKeyPVCName:            "data",
+			parameterKeyPVCNamespace:       "default",
+			parameterKeyVolumeNameTemplate: "{{.PVCNamespace}}-{{.PVCName}}-{{.Short}}",
+		},
+		VolumeCapabilities: []*proto.VolumeCapability{
+			{
+				AccessType: &proto.VolumeCapability_Mount{
+					Mount: &proto.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &proto.VolumeCapability_AccessMode{
+					Mode: proto.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	if _, err := env.service.CreateVolume(env.ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Parameters[parameterKeyVolumeNameTemplate] = "{{.Invalid}}"
+	_, err := env.service.CreateVolume(env.ctx, req)
+	if c := status.Code(err); c != codes.InvalidArgument {
+		t.Errorf("unexpected error code: %s", c)
+	}
+}
+
 func TestControllerServiceCreateVolumeWithLocation(t *testing.T) {
 	env := newControllerServiceTestEnv()
 
@@ -301,6 +351,154 @@ func TestControllerServiceCreateVolumeWithLocation(t *testing.T) {
 	}
 }
 
+func TestControllerServiceCreateVolumeLocationFallback(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Errors   map[string]error
+		Tried    []string
+		Location string
+		Code     codes.Code
+	}{
+		{
+			Name:     "first location available",
+			Errors:   map[string]error{},
+			Location: "fsn1",
+		},
+		{
+			Name:     "first location unavailable",
+			Errors:   map[string]error{"fsn1": volumes.ErrResourceUnavailable},
+			Location: "nbg1",
+		},
+		{
+			Name: "all locations unavailable",
+			Errors: map[string]error{
+				"fsn1": volumes.ErrResourceUnavailable,
+				"nbg1": volumes.ErrResourceUnavailable,
+				"hel1": volumes.ErrResourceUnavailable,
+			},
+			Code: codes.ResourceExhausted,
+		},
+		{
+			Name:   "other error",
+			Errors: map[string]error{"fsn1": io.EOF},
+			Tried:  []string{"fsn1"},
+			Code:   codes.Internal,
+		},
+		{
+			Name:   "conflicting volume",
+			Errors: map[string]error{"fsn1": volumes.ErrVolumeAlreadyExists},
+			Tried:  []string{"fsn1"},
+			Code:   codes.AlreadyExists,
+		},
+		{
+			Name:     "volume created in next location by previous attempt",
+			Errors:   map[string]error{"fsn1": volumes.ErrVolumeInOtherLocation},
+			Tried:    []string{"fsn1", "nbg1"},
+			Location: "nbg1",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			env := newControllerServiceTestEnv()
+
+			var tried []string
+			env.volumeService.CreateFunc = func(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error) {
+				tried = append(tried, opts.Location)
+				if err := testCase.Errors[opts.Location]; err != nil {
+					return nil, err
+				}
+				return &csi.Volume{
+					ID:       1,
+					Name:     opts.Name,
+					Size:     opts.MinSize,
+					Location: opts.Location,
+				}, nil
+			}
+
+			req := &proto.CreateVolumeRequest{
+				Name: "testvol",
+				VolumeCapabilities: []*proto.VolumeCapability{
+					{
+						AccessType: &proto.VolumeCapability_Mount{
+							Mount: &proto.VolumeCapability_MountVolume{},
+						},
+						AccessMode: &proto.VolumeCapability_AccessMode{
+							Mode: proto.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+						},
+					},
+				},
+				AccessibilityRequirements: &proto.TopologyRequirement{
+					Preferred: []*proto.Topology{
+						{Segments: map[string]string{TopologySegmentLocation: "fsn1"}},
+					},
+					Requisite: []*proto.Topology{
+						{Segments: map[string]string{TopologySegmentLocation: "nbg1"}},
+						{Segments: map[string]string{TopologySegmentLocation: "hel1"}},
+					},
+				},
+			}
+
+			resp, err := env.service.CreateVolume(env.ctx, req)
+			if testCase.Tried != nil && !slices.Equal(tried, testCase.Tried) {
+				t.Errorf("unexpected tried locations: %v", tried)
+			}
+			if testCase.Code != codes.OK {
+				if c := status.Code(err); c != testCase.Code {
+					t.Fatalf("unexpected error code: %s (tried %v)", c, tried)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc := resp.GetVolume().GetAccessibleTopology()[0].GetSegments()[TopologySegmentLocation]; loc != testCase.Location {
+				t.Errorf("unexpected location segment in topology: %s (tried %v)", loc, tried)
+			}
+		})
+	}
+}
+
+func TestControllerServiceCreateVolumeWithNetworkZone(t *testing.T) {
+	env := newControllerServiceTestEnv()
+	env.service.enableNetworkZoneTopology = true
+
+	env.volumeService.CreateFunc = func(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error) {
+		return &csi.Volume{
+			ID:          1,
+			Name:        opts.Name,
+			Size:        opts.MinSize,
+			Location:    opts.Location,
+			NetworkZone: "eu-central",
+		}, nil
+	}
+
+	resp, err := env.service.CreateVolume(env.ctx, &proto.CreateVolumeRequest{
+		Name: "testvol",
+		VolumeCapabilities: []*proto.VolumeCapability{
+			{
+				AccessType: &proto.VolumeCapability_Mount{
+					Mount: &proto.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &proto.VolumeCapability_AccessMode{
+					Mode: proto.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segments := resp.GetVolume().GetAccessibleTopology()[0].GetSegments()
+	if loc := segments[TopologySegmentLocation]; loc != "testloc" {
+		t.Errorf("unexpected location segment in topology: %s", loc)
+	}
+	if zone := segments[TopologySegmentNetworkZone]; zone != "eu-central" {
+		t.Errorf("unexpected network zone segment in topology: %s", zone)
+	}
+}
+
 func TestControllerServiceCreateVolumeInputErrors(t *testing.T) {
 	env := newControllerServiceTestEnv()
 
@@ -933,6 +1131,102 @@ func TestControllerServiceControllerGetCapabilities(t *testing.T) {
 	}
 }
 
+func TestControllerServiceControllerGetCapabilitiesWithQuota(t *testing.T) {
+	env := newControllerServiceTestEnv()
+	env.service.volumeQuota = &VolumeQuota{Total: 100}
+
+	resp, err := env.service.ControllerGetCapabilities(env.ctx, &proto.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.GetCapabilities()) != 6 {
+		t.Fatalf("unexpected number of capabilities: %d", len(resp.GetCapabilities()))
+	}
+	if c := resp.GetCapabilities()[5].GetRpc().GetType(); c != proto.ControllerServiceCapability_RPC_GET_CAPACITY {
+		t.Errorf("unexpected capability: %s", c)
+	}
+}
+
+func TestControllerServiceGetCapacity(t *testing.T) {
+	env := newControllerServiceTestEnv()
+	env.service.volumeQuota = &VolumeQuota{
+		Total:     20000,
+		Locations: map[string]int{"fsn1": 1000},
+	}
+
+	env.volumeService.AllFunc = func(ctx context.Context) ([]*csi.Volume, error) {
+		return []*csi.Volume{
+			{ID: 1, Size: 400, Location: "fsn1"},
+			{ID: 2, Size: 500, Location: "nbg1"},
+		}, nil
+	}
+
+	testCases := []struct {
+		Name              string
+		Location          string
+		AvailableCapacity int64
+		MaximumVolumeSize int64
+	}{
+		{
+			Name:              "location with quota",
+			Location:          "fsn1",
+			AvailableCapacity: 600 * GB,
+			MaximumVolumeSize: 600 * GB,
+		},
+		{
+			Name:              "location without quota",
+			Location:          "nbg1",
+			AvailableCapacity: 19100 * GB,
+			MaximumVolumeSize: MaxVolumeSize * GB,
+		},
+		{
+			Name:              "without topology",
+			AvailableCapacity: 19100 * GB,
+			MaximumVolumeSize: MaxVolumeSize * GB,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			req := &proto.GetCapacityRequest{}
+			if testCase.Location != "" {
+				req.AccessibleTopology = &proto.Topology{
+					Segments: map[string]string{TopologySegmentLocation: testCase.Location},
+				}
+			}
+
+			resp, err := env.service.GetCapacity(env.ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.GetAvailableCapacity() != testCase.AvailableCapacity {
+				t.Errorf("unexpected available capacity: %d", resp.GetAvailableCapacity())
+			}
+			if resp.GetMaximumVolumeSize().GetValue() != testCase.MaximumVolumeSize {
+				t.Errorf("unexpected maximum volume size: %d", resp.GetMaximumVolumeSize().GetValue())
+			}
+		})
+	}
+}
+
+func TestControllerServiceGetCapacityExhausted(t *testing.T) {
+	env := newControllerServiceTestEnv()
+	env.service.volumeQuota = &VolumeQuota{Total: 100}
+
+	env.volumeService.AllFunc = func(ctx context.Context) ([]*csi.Volume, error) {
+		return []*csi.Volume{{ID: 1, Size: 200, Location: "fsn1"}}, nil
+	}
+
+	resp, err := env.service.GetCapacity(env.ctx, &proto.GetCapacityRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetAvailableCapacity() != 0 {
+		t.Errorf("unexpected available capacity: %d", resp.GetAvailableCapacity())
+	}
+}
+
 func TestControllerServiceValidateVolumeCapabilities(t *testing.T) {
 	env := newControllerServiceTestEnv()
 
@@ -1111,3 +1405,35 @@ func TestControllerServiceValidateVolumeCapabilitiesUnsupportedCapability(t *tes
 		t.Errorf("unexpected confirmation: %v", resp.GetConfirmed())
 	}
 }
+
+func TestControllerServiceListVolumes(t *testing.T) {
+	env := newControllerServiceTestEnv()
+	env.service.enableNetworkZoneTopology = true
+
+	env.volumeService.AllFunc = func(ctx context.Context) ([]*csi.Volume, error) {
+		return []*csi.Volume{
+			{ID: 1, Size: 10, Location: "fsn1", NetworkZone: "eu-central"},
+			{ID: 2, Size: 20, Location: "ash", NetworkZone: "us-east"},
+		}, nil
+	}
+
+	resp, err := env.service.ListVolumes(env.ctx, &proto.ListVolumesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetEntries()) != 2 {
+		t.Fatalf("unexpected number of entries: %d", len(resp.GetEntries()))
+	}
+
+	volume := resp.GetEntries()[1].GetVolume()
+	if volume.GetVolumeId() != "2" {
+		t.Errorf("unexpected volume id: %s", volume.GetVolumeId())
+	}
+	segments := volume.GetAccessibleTopology()[0].GetSegments()
+	if loc := segments[TopologySegmentLocation]; loc != "ash" {
+		t.Errorf("unexpected location segment in topology: %s", loc)
+	}
+	if zone := segments[TopologySegmentNetworkZone]; zone != "us-east" {
+		t.Errorf("unexpected network zone segment in topology: %s", zone)
+	}
+}
@@ -5,9 +5,11 @@ const (
 	PluginVersion = "2.22.1" // x-releaser-pleaser-version
 
 	MaxVolumesPerNode = 16
-	MinVolumeSize     = 10 // GB
+	MinVolumeSize     = 10    // GB
+	MaxVolumeSize     = 10240 // GB
 	DefaultVolumeSize = MinVolumeSize
 
-	TopologySegmentLocation = PluginName + "/location"
-	ProvidedByLabel         = "instance.hetzner.cloud/provided-by"
+	TopologySegmentLocation    = PluginName + "/location"
+	TopologySegmentNetworkZone = PluginName + "/network-zone"
+	ProvidedByLabel            = "instance.hetzner.cloud/provided-by"
 )
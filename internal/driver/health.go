@@ -0,0 +1,127 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/metadata"
+)
+
+// HealthCheck checks a dependency of the driver, e.g. the hcloud API. The
+// [IdentityService] runs the health checks on every Probe.
+type HealthCheck interface {
+	Name() string
+	// Check returns an error describing the problem, if the dependency is
+	// unavailable.
+	Check(ctx context.Context) error
+}
+
+type healthCheckFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (c *healthCheckFunc) Name() string                    { return c.name }
+func (c *healthCheckFunc) Check(ctx context.Context) error { return c.check(ctx) }
+
+// NewHealthCheck creates a HealthCheck from a function.
+func NewHealthCheck(name string, check func(ctx context.Context) error) HealthCheck {
+	return &healthCheckFunc{name: name, check: check}
+}
+
+// healthCheckTimeout bounds a cached health check. The check runs with its own
+// timeout, as its result is shared by later probes.
+const healthCheckTimeout = 10 * time.Second
+
+// cachedHealthCheck runs the wrapped check at most once per ttl and returns
+// the previous result in between. Failures caused by the timeout of the check
+// are not cached, so the next probe checks again.
+type cachedHealthCheck struct {
+	HealthCheck
+	ttl     time.Duration
+	timeout time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// NewCachedHealthCheck caches the result of a check for the ttl, for checks,
+// which are expensive or use up the API rate limit.
+func NewCachedHealthCheck(check HealthCheck, ttl time.Duration) HealthCheck {
+	return &cachedHealthCheck{HealthCheck: check, ttl: ttl, timeout: healthCheckTimeout}
+}
+
+func (c *cachedHealthCheck) Check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checked.IsZero() && time.Since(c.checked) < c.ttl {
+		return c.err
+	}
+
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	err := c.HealthCheck.Check(checkCtx)
+	if checkCtx.Err() != nil {
+		return err
+	}
+	c.err = err
+	c.checked = time.Now()
+	return err
+}
+
+// NewAPIHealthCheck checks that the hcloud API is reachable and accepts the
+// token.
+func NewAPIHealthCheck(client *hcloud.Client) HealthCheck {
+	return NewHealthCheck("hcloud-api", func(ctx context.Context) error {
+		_, _, err := client.Location.List(ctx, hcloud.LocationListOpts{ListOpts: hcloud.ListOpts{PerPage: 1}})
+		return err
+	})
+}
+
+// NewMetadataHealthCheck checks that the metadata service of the server is
+// reachable.
+func NewMetadataHealthCheck(client *metadata.Client) HealthCheck {
+	return NewHealthCheck("metadata-service", func(ctx context.Context) error {
+		if !client.IsHcloudServerWithContext(ctx) {
+			return errors.New("the metadata service is not reachable")
+		}
+		return nil
+	})
+}
+
+// NewToolsHealthCheck checks that the tools to publish and resize volumes are
+// installed. The versions are logged after the first successful check.
+func NewToolsHealthCheck(logger *slog.Logger) HealthCheck {
+	var once sync.Once
+	return NewHealthCheck("node-tools", func(ctx context.Context) error {
+		versions, err := volumes.CheckTools(ctx, volumes.RequiredTools)
+		if err != nil {
+			return err
+		}
+		once.Do(func() {
+			for _, version := range versions {
+				logger.Info("found node tool", "tool", version.Name, "path", version.Path, "version", version.Version)
+			}
+		})
+		return nil
+	})
+}
+
+// runHealthChecks runs the checks and returns the first failure.
+func runHealthChecks(ctx context.Context, checks []HealthCheck) error {
+	for _, check := range checks {
+		if err := check.Check(ctx); err != nil {
+			return fmt.Errorf("health check %s failed: %w", check.Name(), err)
+		}
+	}
+	return nil
+}
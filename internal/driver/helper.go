@@ -2,6 +2,7 @@ package driver
 
 import (
 	"math"
+	"slices"
 	"strconv"
 
 	proto "github.com/container-storage-interface/spec/lib/go/csi"
@@ -10,6 +11,8 @@ import (
 func parseVolumeID(id string) (int64, error) { return strconv.ParseInt(id, 10, 64) }
 func parseNodeID(id string) (int64, error)   { return strconv.ParseInt(id, 10, 64) }
 
+func gbToBytes(size int) int64 { return int64(size) * 1024 * 1024 * 1024 }
+
 func volumeSizeFromCapacityRange(cr *proto.CapacityRange) (int, int, bool) {
 	if cr == nil {
 		return DefaultVolumeSize, 0, true
@@ -58,19 +61,19 @@ func isCapabilitySupported(capability *proto.VolumeCapability) bool {
 	}
 }
 
-func locationFromTopologyRequirement(tr *proto.TopologyRequirement) *string {
+// locationsFromTopologyRequirement returns the distinct locations of the
+// topology requirement, ordered by the preferred topologies first and the
+// requisite topologies second.
+func locationsFromTopologyRequirement(tr *proto.TopologyRequirement) []string {
 	if tr == nil {
 		return nil
 	}
-	for _, top := range tr.GetPreferred() {
-		if location, ok := top.GetSegments()[TopologySegmentLocation]; ok {
-			return &location
-		}
-	}
-	for _, top := range tr.GetRequisite() {
-		if location, ok := top.GetSegments()[TopologySegmentLocation]; ok {
-			return &location
+
+	var locations []string
+	for _, top := range slices.Concat(tr.GetPreferred(), tr.GetRequisite()) {
+		if location, ok := top.GetSegments()[TopologySegmentLocation]; ok && !slices.Contains(locations, location) {
+			locations = append(locations, location)
 		}
 	}
-	return nil
+	return locations
 }
@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"slices"
 	"testing"
 
 	proto "github.com/container-storage-interface/spec/lib/go/csi"
@@ -118,3 +119,65 @@ func TestVolumeSizeFromCapacityRange(t *testing.T) {
 		})
 	}
 }
+
+func TestLocationsFromTopologyRequirement(t *testing.T) {
+	testCases := []struct {
+		Name      string
+		TR        *proto.TopologyRequirement
+		Locations []string
+	}{
+		{
+			Name:      "without requirement",
+			TR:        nil,
+			Locations: nil,
+		},
+		{
+			Name: "preferred before requisite",
+			TR: &proto.TopologyRequirement{
+				Requisite: []*proto.Topology{
+					{Segments: map[string]string{TopologySegmentLocation: "nbg1"}},
+					{Segments: map[string]string{TopologySegmentLocation: "hel1"}},
+				},
+				Preferred: []*proto.Topology{
+					{Segments: map[string]string{TopologySegmentLocation: "hel1"}},
+					{Segments: map[string]string{TopologySegmentLocation: "fsn1"}},
+				},
+			},
+			Locations: []string{"hel1", "fsn1", "nbg1"},
+		},
+		{
+			Name: "without location segment",
+			TR: &proto.TopologyRequirement{
+				Requisite: []*proto.Topology{
+					{Segments: map[string]string{ProvidedByLabel: "cloud"}},
+				},
+			},
+			Locations: nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			locations := locationsFromTopologyRequirement(testCase.TR)
+			if !slices.Equal(locations, testCase.Locations) {
+				t.Fatalf("unexpected locations: %v", locations)
+			}
+		})
+	}
+}
+
+func TestLocationsFromTopologyRequirementKeepsRequest(t *testing.T) {
+	fsn1 := &proto.Topology{Segments: map[string]string{TopologySegmentLocation: "fsn1"}}
+	nbg1 := &proto.Topology{Segments: map[string]string{TopologySegmentLocation: "nbg1"}}
+
+	// The preferred topologies have spare capacity, which must not be written.
+	preferred := make([]*proto.Topology, 1, 2)
+	preferred[0] = fsn1
+	tr := &proto.TopologyRequirement{Preferred: preferred, Requisite: []*proto.Topology{nbg1}}
+
+	locationsFromTopologyRequirement(tr)
+
+	if spare := preferred[:2][1]; spare != nil {
+		t.Errorf("preferred topologies were modified: %v", spare)
+	}
+}
@@ -12,15 +12,19 @@ import (
 type IdentityService struct {
 	proto.UnimplementedIdentityServer
 
-	logger *slog.Logger
+	logger       *slog.Logger
+	healthChecks []HealthCheck
 
 	readyMu sync.RWMutex
 	ready   bool
 }
 
-func NewIdentityService(logger *slog.Logger) *IdentityService {
+// NewIdentityService creates an IdentityService, which runs the health checks
+// on every Probe, once the driver is ready.
+func NewIdentityService(logger *slog.Logger, healthChecks ...HealthCheck) *IdentityService {
 	return &IdentityService{
-		logger: logger,
+		logger:       logger,
+		healthChecks: healthChecks,
 	}
 }
 
@@ -30,7 +34,8 @@ func (s *IdentityService) SetReady(ready bool) {
 	s.readyMu.Unlock()
 }
 
-func (s *IdentityService) isReady() bool {
+// IsReady reports whether the driver finished its setup and serves requests.
+func (s *IdentityService) IsReady() bool {
 	s.readyMu.RLock()
 	ready := s.ready
 	s.readyMu.RUnlock()
@@ -81,9 +86,19 @@ func (s *IdentityService) GetPluginCapabilities(context.Context, *proto.GetPlugi
 	return resp, nil
 }
 
-func (s *IdentityService) Probe(context.Context, *proto.ProbeRequest) (*proto.ProbeResponse, error) {
+// Probe reports whether the driver is ready. The driver is reported as not
+// ready, if a health check failed. The reason is logged.
+func (s *IdentityService) Probe(ctx context.Context, _ *proto.ProbeRequest) (*proto.ProbeResponse, error) {
+	ready := s.IsReady()
+	if ready {
+		if err := runHealthChecks(ctx, s.healthChecks); err != nil {
+			s.logger.Warn("probe failed, reporting the driver as not ready", "err", err)
+			ready = false
+		}
+	}
+
 	resp := &proto.ProbeResponse{
-		Ready: &wrapperspb.BoolValue{Value: s.isReady()},
+		Ready: &wrapperspb.BoolValue{Value: ready},
 	}
 	return resp, nil
 }
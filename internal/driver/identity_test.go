@@ -2,8 +2,10 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"testing"
+	"time"
 
 	proto "github.com/container-storage-interface/spec/lib/go/csi"
 )
@@ -110,3 +112,94 @@ func TestIdentityServiceProbeNotReady(t *testing.T) {
 		t.Error("expected to not be ready")
 	}
 }
+
+func TestIdentityServiceProbeHealthChecks(t *testing.T) {
+	var failure error
+	env := identityServiceTestEnv{
+		ctx: context.Background(),
+		service: NewIdentityService(
+			slog.New(slog.DiscardHandler),
+			NewHealthCheck("ok", func(context.Context) error { return nil }),
+			NewHealthCheck("hcloud-api", func(context.Context) error { return failure }),
+		),
+	}
+	env.service.SetReady(true)
+
+	resp, err := env.service.Probe(env.ctx, &proto.ProbeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.GetReady().GetValue() {
+		t.Error("expected to be ready")
+	}
+
+	failure = errors.New("unauthorized")
+	resp, err = env.service.Probe(env.ctx, &proto.ProbeRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetReady().GetValue() {
+		t.Error("expected to not be ready")
+	}
+}
+
+func TestCachedHealthCheck(t *testing.T) {
+	calls := 0
+	check := NewCachedHealthCheck(NewHealthCheck("counting", func(context.Context) error {
+		calls++
+		return nil
+	}), time.Hour)
+
+	for range 3 {
+		if err := check.Check(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the check to run once, got %d", calls)
+	}
+	if check.Name() != "counting" {
+		t.Errorf("unexpected name: %s", check.Name())
+	}
+}
+
+func TestCachedHealthCheckIgnoresProbeContext(t *testing.T) {
+	calls := 0
+	check := NewCachedHealthCheck(NewHealthCheck("counting", func(ctx context.Context) error {
+		calls++
+		return ctx.Err()
+	}), time.Hour)
+
+	// The check does not fail because the context of the probe was canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := check.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected the check to run once, got %d", calls)
+	}
+}
+
+func TestCachedHealthCheckDoesNotCacheTimeouts(t *testing.T) {
+	calls := 0
+	check := NewCachedHealthCheck(NewHealthCheck("counting", func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}), time.Hour)
+	check.(*cachedHealthCheck).timeout = time.Millisecond
+
+	if err := check.Check(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if err := check.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the check to run twice, got %d", calls)
+	}
+}
@@ -0,0 +1,114 @@
+package driver
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hetznercloud/csi-driver/internal/utils"
+)
+
+const (
+	// labelKeyExtraLabels tracks the keys of the extra volume labels, which
+	// were added to a volume, so they can be removed once they are no longer
+	// configured. A label value can not hold the keys themselves, so it holds
+	// a short hash of every key.
+	labelKeyExtraLabels = "extra-labels"
+	// labelKeyParameterLabels tracks the keys of the labels parameter of the
+	// StorageClass like labelKeyExtraLabels.
+	labelKeyParameterLabels = "parameter-labels"
+
+	labelKeyHashLength = 6
+	// maxTrackedLabels fits the hashes into a single label value.
+	maxTrackedLabels = MaxLabelValueLength / labelKeyHashLength
+)
+
+// parameterVolumeLabels returns the labels of a volume, which are derived from
+// the CreateVolume parameters: the names of the PVC and the PV, and separately
+// the labels parameter of the StorageClass.
+func parameterVolumeLabels(parameters map[string]string) (labels, customLabels map[string]string, err error) {
+	labels = make(map[string]string)
+	customLabels = make(map[string]string)
+	for key, value := range parameters {
+		switch strings.ToLower(key) {
+		case parameterKeyPVCName:
+			labels[labelKeyPVCName] = value
+		case parameterKeyPVCNamespace:
+			labels[labelKeyPVCNamespace] = value
+		case parameterKeyPVName:
+			labels[labelKeyPVName] = value
+		case parameterKeyLabels:
+			customLabels, err = utils.ConvertLabelsToMap(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid format of parameter labels: %w", err)
+			}
+		}
+	}
+	return labels, customLabels, nil
+}
+
+// labelKeyHash returns the hash of a label key, which is stored in a tracking
+// label.
+func labelKeyHash(key string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return fmt.Sprintf("%08x", h.Sum32())[:labelKeyHashLength]
+}
+
+// formatLabelKeys returns the value of a tracking label for the given labels.
+// Only the first keys in lexical order are tracked, if there are more than fit
+// into a label value. It returns false in that case.
+func formatLabelKeys(labels map[string]string) (string, bool) {
+	keys := slices.Sorted(maps.Keys(labels))
+	complete := len(keys) <= maxTrackedLabels
+	if !complete {
+		keys = keys[:maxTrackedLabels]
+	}
+
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(labelKeyHash(key))
+	}
+	return b.String(), complete
+}
+
+// isTrackedLabel reports whether the key is tracked in the value of a tracking
+// label.
+func isTrackedLabel(value, key string) bool {
+	hash := labelKeyHash(key)
+	for i := 0; i+labelKeyHashLength <= len(value); i += labelKeyHashLength {
+		if value[i:i+labelKeyHashLength] == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// setTrackedLabels adds the tracked labels and the tracking label with the
+// given key, which tracks them, to the labels of a volume.
+func setTrackedLabels(labels, tracked map[string]string, trackingKey string) (complete bool) {
+	maps.Copy(labels, tracked)
+	value, complete := formatLabelKeys(tracked)
+	if value == "" {
+		delete(labels, trackingKey)
+	} else {
+		labels[trackingKey] = value
+	}
+	return complete
+}
+
+// removeUntrackedLabels removes the labels from desired, which are tracked in
+// the tracking label of current, but are no longer in tracked.
+func removeUntrackedLabels(desired, current, tracked map[string]string, trackingKey string) {
+	value, ok := current[trackingKey]
+	if !ok {
+		return
+	}
+	for key := range current {
+		if _, ok := tracked[key]; !ok && isTrackedLabel(value, key) {
+			delete(desired, key)
+		}
+	}
+}
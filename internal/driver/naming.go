@@ -0,0 +1,195 @@
+package driver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// MaxVolumeNameLength is the maximum length of a volume name accepted by the API.
+const MaxVolumeNameLength = 63
+
+// volumeNameTemplateData holds the values available in the volume name template.
+type volumeNameTemplateData struct {
+	// Name is the name of the volume requested by the container orchestration
+	// system, e.g. pvc-<uuid>.
+	Name         string
+	PVCName      string
+	PVCNamespace string
+	PVName       string
+	// Short is a short, stable identifier derived from Name, which can be used
+	// to keep rendered names unique.
+	Short string
+}
+
+func newVolumeNameTemplateData(name string, params map[string]string) volumeNameTemplateData {
+	sum := sha256.Sum256([]byte(name))
+	return volumeNameTemplateData{
+		Name:         name,
+		PVCName:      params[parameterKeyPVCName],
+		PVCNamespace: params[parameterKeyPVCNamespace],
+		PVName:       params[parameterKeyPVName],
+		Short:        hex.EncodeToString(sum[:])[:8],
+	}
+}
+
+// The values of the unique fields are wrapped in these markers while the
+// template is rendered, so they can be kept when the name is truncated.
+const (
+	uniqueStartMarker = '\uE000'
+	uniqueEndMarker   = '\uE001'
+)
+
+// unique returns a copy of the data with the fields, which make a name unique,
+// wrapped in markers.
+func (d volumeNameTemplateData) unique() volumeNameTemplateData {
+	wrap := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return string(uniqueStartMarker) + value + string(uniqueEndMarker)
+	}
+	d.Name = wrap(d.Name)
+	d.PVName = wrap(d.PVName)
+	d.Short = wrap(d.Short)
+	return d
+}
+
+// nameSegment is a part of a rendered volume name.
+type nameSegment struct {
+	value  string
+	unique bool
+}
+
+// renderVolumeName renders the volume name template and sanitizes the result,
+// so it can be used as name of a volume.
+//
+// Names exceeding [MaxVolumeNameLength] are truncated from the left, like
+// label values are truncated. The values of the unique fields Name, PVName and
+// Short are never truncated, so the name stays unique. Only the other parts of
+// the name are truncated, starting with the leftmost one.
+func renderVolumeName(nameTemplate string, data volumeNameTemplateData) (string, error) {
+	tmpl, err := template.New("volume-name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse volume name template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data.unique()); err != nil {
+		return "", fmt.Errorf("failed to render volume name template: %w", err)
+	}
+
+	segments := splitVolumeName(b.String())
+
+	excess := -MaxVolumeNameLength
+	for _, segment := range segments {
+		excess += len(segment.value)
+	}
+	for i := range segments {
+		if excess <= 0 {
+			break
+		}
+		if segments[i].unique || segments[i].value == "" {
+			continue
+		}
+		// A leading separator is kept, so the part stays separated from the
+		// unique value before it.
+		value := segments[i].value
+		keep := 0
+		if trimVolumeName(value[:1]) == "" {
+			keep = 1
+		}
+		cut := min(excess, len(value)-keep)
+		segments[i].value = value[:keep] + value[keep+cut:]
+		excess -= cut
+	}
+	if excess > 0 {
+		return "", fmt.Errorf("the unique parts of the volume name exceed %d characters", MaxVolumeNameLength)
+	}
+
+	b.Reset()
+	for _, segment := range segments {
+		b.WriteString(segment.value)
+	}
+	name := trimVolumeName(b.String())
+	if name == "" {
+		return "", errors.New("volume name template rendered an empty name")
+	}
+	return name, nil
+}
+
+// splitVolumeName splits a rendered name into its unique and other parts and
+// sanitizes them. Unmatched markers, e.g. from cutting a unique value in the
+// template, are dropped.
+func splitVolumeName(rendered string) []nameSegment {
+	var (
+		segments []nameSegment
+		current  strings.Builder
+		unique   bool
+	)
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, nameSegment{value: sanitizeVolumeName(current.String()), unique: unique})
+			current.Reset()
+		}
+	}
+	for _, r := range rendered {
+		switch r {
+		case uniqueStartMarker:
+			flush()
+			unique = true
+		case uniqueEndMarker:
+			flush()
+			unique = false
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	// Dashes are collapsed across the parts, so the length of the name is
+	// known before it is truncated.
+	var last byte
+	for i := range segments {
+		if last == '-' && strings.HasPrefix(segments[i].value, "-") {
+			segments[i].value = segments[i].value[1:]
+		}
+		if value := segments[i].value; value != "" {
+			last = value[len(value)-1]
+		}
+	}
+	return segments
+}
+
+// sanitizeVolumeName replaces all characters that are not allowed in a volume
+// name with dashes.
+func sanitizeVolumeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		case r == '.' || r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+
+	result := b.String()
+	for strings.Contains(result, "--") {
+		result = strings.ReplaceAll(result, "--", "-")
+	}
+	return result
+}
+
+// trimVolumeName removes characters from the start and the end of the name,
+// as names must start and end with an alphanumeric character.
+func trimVolumeName(name string) string {
+	return strings.TrimFunc(name, func(r rune) bool {
+		return !((r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'))
+	})
+}
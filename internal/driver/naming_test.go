@@ -0,0 +1,88 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderVolumeName(t *testing.T) {
+	data := newVolumeNameTemplateData("pvc-0b8c4a2e-7f3d-4c1b-9e5a-2d6f8a1c3b7e", map[string]string{
+		parameterKeyPVCName:      "data-postgres-0",
+		parameterKeyPVCNamespace: "Production",
+		parameterKeyPVName:       "pvc-0b8c4a2e-7f3d-4c1b-9e5a-2d6f8a1c3b7e",
+	})
+
+	testCases := []struct {
+		Name     string
+		Template string
+		Expected string
+		Err      bool
+	}{
+		{
+			Name:     "namespace and name",
+			Template: "{{.PVCNamespace}}-{{.PVCName}}-{{.Short}}",
+			Expected: "production-data-postgres-0-" + data.Short,
+		},
+		{
+			Name:     "invalid characters",
+			Template: "{{.PVCNamespace}}/{{.PVCName}}!",
+			Expected: "production-data-postgres-0",
+		},
+		{
+			Name:     "too long",
+			Template: strings.Repeat("a", 80) + "-{{.Short}}",
+			Expected: strings.Repeat("a", MaxVolumeNameLength-9) + "-" + data.Short,
+		},
+		{
+			Name:     "too long with short first",
+			Template: "{{.Short}}-" + strings.Repeat("a", 80),
+			Expected: data.Short + "-" + strings.Repeat("a", MaxVolumeNameLength-9),
+		},
+		{
+			Name:     "too long with short in the middle",
+			Template: strings.Repeat("a", 40) + "-{{.Short}}-" + strings.Repeat("b", 40),
+			Expected: strings.Repeat("a", 13) + "-" + data.Short + "-" + strings.Repeat("b", 40),
+		},
+		{
+			Name:     "unique parts too long",
+			Template: "{{.Name}}-{{.PVName}}",
+			Err:      true,
+		},
+		{
+			Name:     "empty",
+			Template: "--",
+			Err:      true,
+		},
+		{
+			Name:     "unknown field",
+			Template: "{{.Unknown}}",
+			Err:      true,
+		},
+		{
+			Name:     "invalid template",
+			Template: "{{.PVCName",
+			Err:      true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			name, err := renderVolumeName(testCase.Template, data)
+			if testCase.Err {
+				if err == nil {
+					t.Fatalf("expected error, got name %q", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != testCase.Expected {
+				t.Errorf("unexpected name: %q, expected %q", name, testCase.Expected)
+			}
+			if len(name) > MaxVolumeNameLength {
+				t.Errorf("name exceeds max length: %d", len(name))
+			}
+		})
+	}
+}
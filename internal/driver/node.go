@@ -18,6 +18,7 @@ type NodeService struct {
 	logger                   *slog.Logger
 	serverID                 string
 	serverLocation           string
+	serverNetworkZone        string
 	enableProvidedByTopology bool
 	volumeMountService       volumes.MountService
 	volumeResizeService      volumes.ResizeService
@@ -28,6 +29,7 @@ func NewNodeService(
 	logger *slog.Logger,
 	serverID string,
 	serverLocation string,
+	serverNetworkZone string,
 	enableProvidedByTopology bool,
 	volumeMountService volumes.MountService,
 	volumeResizeService volumes.ResizeService,
@@ -37,6 +39,7 @@ func NewNodeService(
 		logger:                   logger,
 		serverID:                 serverID,
 		serverLocation:           serverLocation,
+		serverNetworkZone:        serverNetworkZone,
 		enableProvidedByTopology: enableProvidedByTopology,
 		volumeMountService:       volumeMountService,
 		volumeResizeService:      volumeResizeService,
@@ -185,6 +188,10 @@ func (s *NodeService) NodeGetInfo(_ context.Context, _ *proto.NodeGetInfoRequest
 		},
 	}
 
+	if s.serverNetworkZone != "" {
+		resp.AccessibleTopology.Segments[TopologySegmentNetworkZone] = s.serverNetworkZone
+	}
+
 	if s.enableProvidedByTopology {
 		resp.AccessibleTopology.Segments[ProvidedByLabel] = "cloud"
 	}
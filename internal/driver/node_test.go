@@ -35,6 +35,7 @@ func newNodeServerTestEnv() nodeServiceTestEnv {
 			slog.New(slog.DiscardHandler),
 			"1",
 			"loc",
+			"",
 			false,
 			volumeMountService,
 			volumeResizeService,
@@ -325,6 +326,26 @@ func TestNodeServiceNodeGetInfo(t *testing.T) {
 	if resp.GetMaxVolumesPerNode() != MaxVolumesPerNode {
 		t.Errorf("unexpected max volumes per node: %d", resp.GetMaxVolumesPerNode())
 	}
+	if _, ok := resp.GetAccessibleTopology().GetSegments()[TopologySegmentNetworkZone]; ok {
+		t.Error("unexpected network zone segment in topology")
+	}
+}
+
+func TestNodeServiceNodeGetInfoWithNetworkZone(t *testing.T) {
+	env := newNodeServerTestEnv()
+	env.service.serverNetworkZone = "eu-central"
+
+	resp, err := env.service.NodeGetInfo(env.ctx, &proto.NodeGetInfoRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := resp.GetAccessibleTopology().GetSegments()
+	if loc := segments[TopologySegmentLocation]; loc != "loc" {
+		t.Errorf("unexpected location segment in topology: %s", loc)
+	}
+	if zone := segments[TopologySegmentNetworkZone]; zone != "eu-central" {
+		t.Errorf("unexpected network zone segment in topology: %s", zone)
+	}
 }
 
 func TestNodeServiceNodeExpandVolume(t *testing.T) {
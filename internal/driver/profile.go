@@ -0,0 +1,104 @@
+package driver
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+// parameterKeyProfile selects the project profile of a volume in the
+// StorageClass parameters.
+const parameterKeyProfile = "profile"
+
+// Profile is a Hetzner Cloud project, in which the controller manages volumes
+// in addition to the project of its own token. The IDs of the volumes of a
+// profile are prefixed with the name of the profile, e.g. team-a/123, so that
+// later calls for the volume are routed to the same project.
+type Profile struct {
+	Name          string
+	VolumeService volumes.Service
+	// Location is the default location of new volumes.
+	Location string
+	// VolumeQuota is optional and enables the capacity reporting.
+	VolumeQuota *VolumeQuota
+}
+
+// AddProfile adds a project profile. It must be called before the service
+// handles any requests.
+func (s *ControllerService) AddProfile(profile Profile) {
+	if s.profiles == nil {
+		s.profiles = make(map[string]*Profile)
+	}
+	s.profiles[profile.Name] = &profile
+}
+
+// profile returns the profile with the given name. The empty name is the
+// default profile of the controller.
+func (s *ControllerService) profile(name string) (*Profile, error) {
+	if name == "" {
+		return &Profile{
+			VolumeService: s.volumeService,
+			Location:      s.location,
+			VolumeQuota:   s.volumeQuota,
+		}, nil
+	}
+	profile, ok := s.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return profile, nil
+}
+
+// allProfiles returns the default profile and the added profiles ordered by
+// their name.
+func (s *ControllerService) allProfiles() []*Profile {
+	defaultProfile, _ := s.profile("")
+	profiles := []*Profile{defaultProfile}
+	for _, name := range slices.Sorted(maps.Keys(s.profiles)) {
+		profiles = append(profiles, s.profiles[name])
+	}
+	return profiles
+}
+
+// parseProfileVolumeID splits a volume ID into the name of the profile and the
+// ID of the volume in the project of the profile. Volumes of the default
+// profile have no prefix.
+func parseProfileVolumeID(id string) (string, int64, error) {
+	name, volumeID, found := strings.Cut(id, "/")
+	if !found {
+		name, volumeID = "", id
+	} else if name == "" {
+		return "", 0, fmt.Errorf("invalid volume id %q", id)
+	}
+	parsed, err := parseVolumeID(volumeID)
+	if err != nil {
+		return "", 0, err
+	}
+	return name, parsed, nil
+}
+
+// parseVolumeID returns the profile and the ID of the volume with the given
+// volume ID.
+func (s *ControllerService) parseVolumeID(id string) (*Profile, int64, error) {
+	name, volumeID, err := parseProfileVolumeID(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	profile, err := s.profile(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return profile, volumeID, nil
+}
+
+// formatProfileVolumeID is the inverse of [parseProfileVolumeID].
+func formatProfileVolumeID(profile string, id int64) string {
+	if profile == "" {
+		return strconv.FormatInt(id, 10)
+	}
+	return profile + "/" + strconv.FormatInt(id, 10)
+}
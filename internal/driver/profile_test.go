@@ -0,0 +1,206 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	proto "github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/mock"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+func TestParseProfileVolumeID(t *testing.T) {
+	testCases := []struct {
+		id       string
+		profile  string
+		volumeID int64
+		wantErr  bool
+	}{
+		{id: "123", volumeID: 123},
+		{id: "team-a/123", profile: "team-a", volumeID: 123},
+		{id: "/123", wantErr: true},
+		{id: "team-a/", wantErr: true},
+		{id: "team-a/abc", wantErr: true},
+		{id: "abc", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.id, func(t *testing.T) {
+			profile, volumeID, err := parseProfileVolumeID(tc.id)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profile != tc.profile || volumeID != tc.volumeID {
+				t.Errorf("unexpected result: %q, %d", profile, volumeID)
+			}
+			if id := formatProfileVolumeID(profile, volumeID); id != tc.id {
+				t.Errorf("unexpected formatted id: %s", id)
+			}
+		})
+	}
+}
+
+func newProfileTestEnv() (*controllerServiceTestEnv, *mock.VolumeService) {
+	env := newControllerServiceTestEnv()
+	profileVolumeService := &mock.VolumeService{}
+	env.service.AddProfile(Profile{
+		Name:          "team-a",
+		VolumeService: profileVolumeService,
+		Location:      "profileloc",
+		VolumeQuota:   &VolumeQuota{Total: 100},
+	})
+	return env, profileVolumeService
+}
+
+func TestControllerServiceProfileCreateVolume(t *testing.T) {
+	env, profileVolumeService := newProfileTestEnv()
+
+	env.volumeService.CreateFunc = func(context.Context, volumes.CreateOpts) (*csi.Volume, error) {
+		t.Error("unexpected call of the default volume service")
+		return nil, nil
+	}
+	profileVolumeService.CreateFunc = func(_ context.Context, opts volumes.CreateOpts) (*csi.Volume, error) {
+		if opts.Location != "profileloc" {
+			t.Errorf("unexpected location passed to volume service: %s", opts.Location)
+		}
+		return &csi.Volume{ID: 1, Name: opts.Name, Size: opts.MinSize, Location: opts.Location}, nil
+	}
+
+	req := &proto.CreateVolumeRequest{
+		Name:       "testvol",
+		Parameters: map[string]string{parameterKeyProfile: "team-a"},
+		VolumeCapabilities: []*proto.VolumeCapability{
+			{
+				AccessType: &proto.VolumeCapability_Mount{
+					Mount: &proto.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &proto.VolumeCapability_AccessMode{
+					Mode: proto.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+	}
+	resp, err := env.service.CreateVolume(env.ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetVolume().GetVolumeId() != "team-a/1" {
+		t.Errorf("unexpected value for VolumeId: %s", resp.GetVolume().GetVolumeId())
+	}
+
+	req.Parameters[parameterKeyProfile] = "team-b"
+	_, err = env.service.CreateVolume(env.ctx, req)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unexpected error for unknown profile: %v", err)
+	}
+}
+
+func TestControllerServiceProfileRouting(t *testing.T) {
+	env, profileVolumeService := newProfileTestEnv()
+
+	var deleted, resized int64
+	profileVolumeService.DeleteFunc = func(_ context.Context, volume *csi.Volume) error {
+		deleted = volume.ID
+		return nil
+	}
+	profileVolumeService.ResizeFunc = func(_ context.Context, volume *csi.Volume, _ int) error {
+		resized = volume.ID
+		return nil
+	}
+	profileVolumeService.GetByIDFunc = func(_ context.Context, id int64) (*csi.Volume, error) {
+		return &csi.Volume{ID: id, Size: 20}, nil
+	}
+
+	if _, err := env.service.DeleteVolume(env.ctx, &proto.DeleteVolumeRequest{VolumeId: "team-a/1"}); err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("volume was not deleted in the profile: %d", deleted)
+	}
+
+	_, err := env.service.ControllerExpandVolume(env.ctx, &proto.ControllerExpandVolumeRequest{
+		VolumeId:      "team-a/2",
+		CapacityRange: &proto.CapacityRange{RequiredBytes: 20 * GB},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resized != 2 {
+		t.Errorf("volume was not resized in the profile: %d", resized)
+	}
+
+	// A volume of an unknown profile must not be reported as deleted.
+	_, err = env.service.DeleteVolume(env.ctx, &proto.DeleteVolumeRequest{VolumeId: "team-b/1"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("unexpected error for unknown profile: %v", err)
+	}
+}
+
+func TestControllerServiceProfileListVolumes(t *testing.T) {
+	env, profileVolumeService := newProfileTestEnv()
+
+	env.volumeService.AllFunc = func(context.Context) ([]*csi.Volume, error) {
+		return []*csi.Volume{{ID: 1, Location: "testloc"}}, nil
+	}
+	profileVolumeService.AllFunc = func(context.Context) ([]*csi.Volume, error) {
+		return []*csi.Volume{{ID: 2, Location: "profileloc"}}, nil
+	}
+
+	resp, err := env.service.ListVolumes(env.ctx, &proto.ListVolumesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetEntries()) != 2 {
+		t.Fatalf("unexpected number of volumes: %d", len(resp.GetEntries()))
+	}
+	for i, id := range []string{"1", "team-a/2"} {
+		if got := resp.GetEntries()[i].GetVolume().GetVolumeId(); got != id {
+			t.Errorf("unexpected volume id: %s", got)
+		}
+	}
+
+	// A partial list is not returned, if a profile fails.
+	profileVolumeService.AllFunc = func(context.Context) ([]*csi.Volume, error) {
+		return nil, errors.New("unauthorized")
+	}
+	_, err = env.service.ListVolumes(env.ctx, &proto.ListVolumesRequest{})
+	if status.Code(err) != codes.Internal || !strings.Contains(err.Error(), "profile team-a") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestControllerServiceProfileGetCapacity(t *testing.T) {
+	env, profileVolumeService := newProfileTestEnv()
+
+	profileVolumeService.AllFunc = func(context.Context) ([]*csi.Volume, error) {
+		return []*csi.Volume{{ID: 2, Size: 30, Location: "profileloc"}}, nil
+	}
+
+	resp, err := env.service.GetCapacity(env.ctx, &proto.GetCapacityRequest{
+		Parameters: map[string]string{parameterKeyProfile: "team-a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetAvailableCapacity() != 70*GB {
+		t.Errorf("unexpected available capacity: %d", resp.GetAvailableCapacity())
+	}
+
+	// The default profile has no quota.
+	_, err = env.service.GetCapacity(env.ctx, &proto.GetCapacityRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("unexpected error for the default profile: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/audit"
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/ratelimit"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+// VolumeParameterSource recovers the CreateVolume parameters of the existing
+// volumes, e.g. from the PersistentVolumes and their StorageClasses in
+// Kubernetes.
+type VolumeParameterSource interface {
+	// VolumeParameters returns the parameters by the ID of the volume.
+	VolumeParameters(ctx context.Context) (map[string]map[string]string, error)
+}
+
+// LabelReconciler periodically recomputes the labels of all volumes managed by
+// the driver and updates volumes whose labels drifted from the desired state.
+//
+// The desired labels are computed like in CreateVolume: the extra volume
+// labels of the controller and the labels derived from the parameters of the
+// volume, which are recovered from the parameter source. Extra labels and
+// labels of the labels parameter, which are no longer configured, are removed. Labels of volumes without parameters
+// in the source, and labels which are not managed by the driver, are kept.
+type LabelReconciler struct {
+	logger          *slog.Logger
+	profile         string
+	volumeService   volumes.Service
+	parameterSource VolumeParameterSource
+
+	extraVolumeLabelsMu sync.RWMutex
+	extraVolumeLabels   map[string]string
+}
+
+// NewLabelReconciler creates a LabelReconciler for the volumes of a project
+// profile, the profile is empty for the default project. The parameter source
+// is optional.
+func NewLabelReconciler(
+	logger *slog.Logger,
+	profile string,
+	volumeService volumes.Service,
+	parameterSource VolumeParameterSource,
+	extraVolumeLabels map[string]string,
+) *LabelReconciler {
+	return &LabelReconciler{
+		logger:            logger,
+		profile:           profile,
+		volumeService:     volumeService,
+		parameterSource:   parameterSource,
+		extraVolumeLabels: extraVolumeLabels,
+	}
+}
+
+// SetExtraVolumeLabels replaces the extra labels, e.g. after the config was
+// reloaded. The next reconciliation applies them to all volumes.
+func (r *LabelReconciler) SetExtraVolumeLabels(labels map[string]string) {
+	r.extraVolumeLabelsMu.Lock()
+	defer r.extraVolumeLabelsMu.Unlock()
+	r.extraVolumeLabels = maps.Clone(labels)
+}
+
+// Run reconciles the volume labels every interval until the context is
+// canceled.
+func (r *LabelReconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Reconcile(ctx); err != nil {
+			r.logger.Error("failed to reconcile volume labels", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile runs a single reconciliation pass over all volumes.
+func (r *LabelReconciler) Reconcile(ctx context.Context) error {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityLow)
+	ctx = audit.WithRequest(ctx, audit.Request{Method: "LabelReconciler"})
+
+	vols, err := r.volumeService.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.extraVolumeLabelsMu.RLock()
+	extraVolumeLabels := r.extraVolumeLabels
+	r.extraVolumeLabelsMu.RUnlock()
+
+	// Without the parameters, the labels derived from them are kept as they
+	// are, so a failing source does not block the extra labels.
+	var parameters map[string]map[string]string
+	if r.parameterSource != nil {
+		parameters, err = r.parameterSource.VolumeParameters(ctx)
+		if err != nil {
+			r.logger.Warn("failed to get volume parameters, keeping the labels derived from them", "err", err)
+		}
+	}
+
+	var errs []error
+	for _, volume := range vols {
+		if volume.Labels[labelKeyManagedBy] != "csi-driver" {
+			continue
+		}
+
+		desired, err := r.desiredLabels(volume, extraVolumeLabels, parameters)
+		if err != nil {
+			r.logger.Warn(
+				"skipping volume with invalid parameters",
+				"volume-id", volume.ID,
+				"err", err,
+			)
+			continue
+		}
+
+		if err := normalizeVolumeLabels(r.logger, volume.Name, desired); err != nil {
+			r.logger.Warn(
+				"skipping volume with invalid desired labels",
+				"volume-id", volume.ID,
+				"err", err,
+			)
+			continue
+		}
+
+		if maps.Equal(desired, volume.Labels) {
+			continue
+		}
+
+		r.logger.Info(
+			"updating drifted volume labels",
+			"volume-id", volume.ID,
+			"current", volume.Labels,
+			"desired", desired,
+		)
+
+		if err := r.volumeService.UpdateLabels(ctx, volume, desired); err != nil {
+			if errors.Is(err, volumes.ErrVolumeNotFound) {
+				continue
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// desiredLabels computes the labels of a volume from the extra labels and the
+// parameters of the volume.
+func (r *LabelReconciler) desiredLabels(
+	volume *csi.Volume,
+	extraVolumeLabels map[string]string,
+	parameters map[string]map[string]string,
+) (map[string]string, error) {
+	desired := maps.Clone(volume.Labels)
+
+	// Remove the labels, which were added before, but are no longer
+	// configured.
+	removeUntrackedLabels(desired, volume.Labels, extraVolumeLabels, labelKeyExtraLabels)
+
+	volumeParameters, ok := parameters[formatProfileVolumeID(r.profile, volume.ID)]
+	if !ok {
+		setTrackedLabels(desired, extraVolumeLabels, labelKeyExtraLabels)
+		return desired, nil
+	}
+	parameterLabels, customLabels, err := parameterVolumeLabels(volumeParameters)
+	if err != nil {
+		return nil, err
+	}
+	removeUntrackedLabels(desired, volume.Labels, customLabels, labelKeyParameterLabels)
+
+	setTrackedLabels(desired, extraVolumeLabels, labelKeyExtraLabels)
+	maps.Copy(desired, parameterLabels)
+	setTrackedLabels(desired, customLabels, labelKeyParameterLabels)
+	return desired, nil
+}
@@ -0,0 +1,223 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"testing"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/mock"
+)
+
+type fakeParameterSource struct {
+	parameters map[string]map[string]string
+	err        error
+}
+
+func (s *fakeParameterSource) VolumeParameters(_ context.Context) (map[string]map[string]string, error) {
+	return s.parameters, s.err
+}
+
+func reconcileLabels(t *testing.T, volumes []*csi.Volume, profile string, source VolumeParameterSource, extraLabels map[string]string) map[int64]map[string]string {
+	t.Helper()
+
+	volumeService := &mock.VolumeService{
+		AllFunc: func(ctx context.Context) ([]*csi.Volume, error) {
+			return volumes, nil
+		},
+	}
+
+	updated := map[int64]map[string]string{}
+	volumeService.UpdateLabelsFunc = func(ctx context.Context, volume *csi.Volume, labels map[string]string) error {
+		updated[volume.ID] = labels
+		return nil
+	}
+
+	reconciler := NewLabelReconciler(slog.New(slog.DiscardHandler), profile, volumeService, source, extraLabels)
+	if err := reconciler.Reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return updated
+}
+
+func TestLabelReconcilerReconcile(t *testing.T) {
+	trackedClusterName, _ := formatLabelKeys(map[string]string{"clusterName": ""})
+
+	updated := reconcileLabels(t, []*csi.Volume{
+		{
+			ID: 1,
+			Labels: map[string]string{
+				labelKeyManagedBy: "csi-driver",
+				labelKeyPVCName:   "data",
+				"clusterName":     "oldCluster",
+			},
+		},
+		{
+			ID: 2,
+			Labels: map[string]string{
+				labelKeyManagedBy:   "csi-driver",
+				labelKeyExtraLabels: trackedClusterName,
+				"clusterName":       "myCluster",
+			},
+		},
+		{
+			ID:     3,
+			Labels: map[string]string{"clusterName": "otherCluster"},
+		},
+	}, "", nil, map[string]string{"clusterName": "myCluster"})
+
+	if len(updated) != 1 {
+		t.Fatalf("unexpected number of updated volumes: %d", len(updated))
+	}
+	expected := map[string]string{
+		labelKeyManagedBy:   "csi-driver",
+		labelKeyExtraLabels: trackedClusterName,
+		labelKeyPVCName:     "data",
+		"clusterName":       "myCluster",
+	}
+	if !maps.Equal(updated[1], expected) {
+		t.Errorf("unexpected labels for volume 1: %v", updated[1])
+	}
+}
+
+func TestLabelReconcilerRemovesExtraLabels(t *testing.T) {
+	tracked, _ := formatLabelKeys(map[string]string{"clusterName": "", "team": ""})
+	trackedTeam, _ := formatLabelKeys(map[string]string{"team": ""})
+
+	updated := reconcileLabels(t, []*csi.Volume{
+		{
+			ID: 1,
+			Labels: map[string]string{
+				labelKeyManagedBy:   "csi-driver",
+				labelKeyExtraLabels: tracked,
+				"clusterName":       "myCluster",
+				"team":              "storage",
+				"owner":             "set-in-console",
+			},
+		},
+	}, "", nil, map[string]string{"team": "storage"})
+
+	expected := map[string]string{
+		labelKeyManagedBy:   "csi-driver",
+		labelKeyExtraLabels: trackedTeam,
+		"team":              "storage",
+		"owner":             "set-in-console",
+	}
+	if !maps.Equal(updated[1], expected) {
+		t.Errorf("unexpected labels: %v", updated[1])
+	}
+}
+
+func TestLabelReconcilerParameters(t *testing.T) {
+	trackedTeam, _ := formatLabelKeys(map[string]string{"team": ""})
+
+	volumes := []*csi.Volume{
+		{
+			ID: 1,
+			Labels: map[string]string{
+				labelKeyManagedBy:    "csi-driver",
+				labelKeyPVCName:      "data",
+				labelKeyPVCNamespace: "default",
+				labelKeyPVName:       "pvc-1",
+				"team":               "storage",
+			},
+		},
+		{
+			ID: 2,
+			Labels: map[string]string{
+				labelKeyManagedBy: "csi-driver",
+				labelKeyPVCName:   "unknown",
+			},
+		},
+	}
+	source := &fakeParameterSource{
+		parameters: map[string]map[string]string{
+			// The claim was restored with another name.
+			"team-a/1": {
+				parameterKeyPVCName:      "data-restored",
+				parameterKeyPVCNamespace: "restored",
+				parameterKeyPVName:       "pvc-1",
+				parameterKeyLabels:       "team=databases",
+				"type":                   "ext4",
+			},
+		},
+	}
+
+	updated := reconcileLabels(t, volumes, "team-a", source, nil)
+
+	if len(updated) != 1 {
+		t.Fatalf("unexpected number of updated volumes: %d", len(updated))
+	}
+	expected := map[string]string{
+		labelKeyManagedBy:       "csi-driver",
+		labelKeyPVCName:         "data-restored",
+		labelKeyPVCNamespace:    "restored",
+		labelKeyPVName:          "pvc-1",
+		labelKeyParameterLabels: trackedTeam,
+		"team":                  "databases",
+	}
+	if !maps.Equal(updated[1], expected) {
+		t.Errorf("unexpected labels for volume 1: %v", updated[1])
+	}
+
+	// The labels derived from the parameters are kept, if the source fails.
+	source.err = errors.New("api unavailable")
+	source.parameters = nil
+	if updated := reconcileLabels(t, volumes, "team-a", source, nil); len(updated) != 0 {
+		t.Errorf("unexpected updated volumes: %v", updated)
+	}
+}
+
+func TestLabelReconcilerRemovesParameterLabels(t *testing.T) {
+	tracked, _ := formatLabelKeys(map[string]string{"team": "", "env": ""})
+	trackedTeam, _ := formatLabelKeys(map[string]string{"team": ""})
+
+	source := &fakeParameterSource{
+		parameters: map[string]map[string]string{
+			"1": {parameterKeyLabels: "team=storage"},
+		},
+	}
+	updated := reconcileLabels(t, []*csi.Volume{
+		{
+			ID: 1,
+			Labels: map[string]string{
+				labelKeyManagedBy:       "csi-driver",
+				labelKeyParameterLabels: tracked,
+				"team":                  "storage",
+				"env":                   "prod",
+				"owner":                 "set-in-console",
+			},
+		},
+	}, "", source, nil)
+
+	expected := map[string]string{
+		labelKeyManagedBy:       "csi-driver",
+		labelKeyParameterLabels: trackedTeam,
+		"team":                  "storage",
+		"owner":                 "set-in-console",
+	}
+	if !maps.Equal(updated[1], expected) {
+		t.Errorf("unexpected labels: %v", updated[1])
+	}
+}
+
+func TestLabelKeys(t *testing.T) {
+	value, complete := formatLabelKeys(map[string]string{"b": "", "a": ""})
+	if !complete || len(value) != 2*labelKeyHashLength {
+		t.Fatalf("unexpected value %q", value)
+	}
+	if !isTrackedLabel(value, "a") || !isTrackedLabel(value, "b") || isTrackedLabel(value, "c") {
+		t.Errorf("unexpected tracked keys in %q", value)
+	}
+
+	many := map[string]string{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"} {
+		many[key] = ""
+	}
+	value, complete = formatLabelKeys(many)
+	if complete || len(value) > MaxLabelValueLength {
+		t.Errorf("unexpected value %q", value)
+	}
+}
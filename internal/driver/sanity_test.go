@@ -48,7 +48,9 @@ func TestSanity(t *testing.T) {
 		volumeService,
 		"testloc",
 		false,
+		false,
 		map[string]string{"clusterName": "myCluster"},
+		nil,
 	)
 
 	identityService := NewIdentityService(
@@ -59,6 +61,7 @@ func TestSanity(t *testing.T) {
 		logger.With("component", "driver-node-service"),
 		"123456",
 		"loc",
+		"",
 		false,
 		volumeMountService,
 		volumeResizeService,
@@ -123,6 +126,7 @@ func (s *sanityVolumeService) Create(_ context.Context, opts volumes.CreateOpts)
 		Name:        opts.Name,
 		Size:        opts.MinSize,
 		Location:    opts.Location,
+		Labels:      opts.Labels,
 		LinuxDevice: fmt.Sprintf("/dev/disk/by-id/scsi-0HC_Volume_%d", s.volumes.Len()+1),
 	}
 
@@ -196,6 +200,30 @@ func (s *sanityVolumeService) Detach(_ context.Context, _ *csi.Volume, _ *csi.Se
 	return nil
 }
 
+func (s *sanityVolumeService) UpdateLabels(_ context.Context, volume *csi.Volume, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for e := s.volumes.Front(); e != nil; e = e.Next() {
+		v := e.Value.(*csi.Volume)
+		if v.ID == volume.ID {
+			v.Labels = labels
+			return nil
+		}
+	}
+
+	return volumes.ErrVolumeNotFound
+}
+
+func (s *sanityVolumeService) CreateMigrationTarget(ctx context.Context, volume *csi.Volume, location string) (*csi.Volume, error) {
+	return s.Create(ctx, volumes.CreateOpts{
+		Name:     fmt.Sprintf("%s-%s", volume.Name, location),
+		MinSize:  volume.Size,
+		Location: location,
+		Labels:   volume.Labels,
+	})
+}
+
 type sanityMountService struct{}
 
 func (s *sanityMountService) Publish(_ context.Context, _ string, _ string, _ volumes.MountOpts) error {
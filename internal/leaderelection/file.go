@@ -0,0 +1,63 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// FileBackend holds the leadership with an exclusive flock on a file. It is
+// meant for setups, where all replicas run on the same host. The lock is
+// released by the kernel when the process exits.
+type FileBackend struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{path: path}
+}
+
+func (b *FileBackend) TryAcquireOrRenew(_ context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file != nil {
+		return true, nil
+	}
+
+	file, err := os.OpenFile(b.path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return false, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil { //nolint:gosec // G115: file descriptors fit into an int
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to lock file: %w", err)
+	}
+
+	b.file = file
+	return true, nil
+}
+
+func (b *FileBackend) Release(_ context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file == nil {
+		return nil
+	}
+
+	// Closing the file releases the lock.
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
@@ -0,0 +1,37 @@
+package leaderelection
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileBackend(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "leader.lock")
+
+	first := NewFileBackend(path)
+	second := NewFileBackend(path)
+
+	acquired, err := first.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = first.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = second.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, first.Release(ctx))
+
+	acquired, err = second.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	require.NoError(t, second.Release(ctx))
+}
@@ -0,0 +1,139 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// KubernetesElector holds the leadership with a coordination.k8s.io/v1 Lease,
+// using the leader election of client-go like the CSI sidecars.
+type KubernetesElector struct {
+	logger *slog.Logger
+	config leaderelection.LeaderElectionConfig
+
+	leading atomic.Bool
+}
+
+// NewKubernetesElector creates a KubernetesElector. The namespace defaults to
+// the namespace of the pod. The leadership is given up, when it could not be
+// renewed for two thirds of the lease duration.
+func NewKubernetesElector(
+	logger *slog.Logger,
+	client kubernetes.Interface,
+	namespace, name, identity string,
+	leaseDuration time.Duration,
+) (*KubernetesElector, error) {
+	if namespace == "" {
+		data, err := os.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	e := &KubernetesElector{
+		logger: logger,
+		config: leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+				Client:     client.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+			},
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   leaseDuration * 2 / 3,
+			RetryPeriod:     leaseDuration / 5,
+			ReleaseOnCancel: true,
+			Name:            name,
+		},
+	}
+
+	// The config is validated when the elector is created, so the errors are
+	// reported at startup instead of in Run.
+	if _, err := e.newLeaderElector(func(context.Context) {}, func() {}); err != nil {
+		return nil, fmt.Errorf("invalid leader election config: %w", err)
+	}
+	return e, nil
+}
+
+func (e *KubernetesElector) newLeaderElector(
+	onStartedLeading func(ctx context.Context),
+	onStoppedLeading func(),
+) (*leaderelection.LeaderElector, error) {
+	config := e.config
+	config.Callbacks = leaderelection.LeaderCallbacks{
+		OnStartedLeading: onStartedLeading,
+		OnStoppedLeading: onStoppedLeading,
+	}
+	return leaderelection.NewLeaderElector(config)
+}
+
+func (e *KubernetesElector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+func (e *KubernetesElector) Run(ctx context.Context, onLeading func(ctx context.Context)) {
+	for ctx.Err() == nil {
+		e.runOnce(ctx, onLeading)
+	}
+}
+
+// runOnce campaigns for the leadership and returns after it was lost and
+// onLeading returned.
+func (e *KubernetesElector) runOnce(ctx context.Context, onLeading func(ctx context.Context)) {
+	// client-go starts onStartedLeading in a goroutine and does not wait for
+	// it, so the wait group tracks it. Once the elector returned, a late
+	// onStartedLeading does not run onLeading anymore.
+	var (
+		mu      sync.Mutex
+		stopped bool
+		wg      sync.WaitGroup
+	)
+	onStartedLeading := func(ctx context.Context) {
+		mu.Lock()
+		if stopped {
+			mu.Unlock()
+			return
+		}
+		wg.Add(1)
+		mu.Unlock()
+		defer wg.Done()
+
+		e.logger.Info("acquired leadership")
+		e.leading.Store(true)
+		onLeading(ctx)
+	}
+
+	elector, err := e.newLeaderElector(onStartedLeading, func() {})
+	if err != nil {
+		// The config was validated in NewKubernetesElector.
+		e.logger.Error("failed to create leader elector", "err", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(e.config.RetryPeriod):
+		}
+		return
+	}
+	elector.Run(ctx)
+
+	mu.Lock()
+	stopped = true
+	mu.Unlock()
+	wg.Wait()
+
+	if e.leading.Swap(false) {
+		e.logger.Info("lost leadership")
+	}
+}
@@ -0,0 +1,77 @@
+package leaderelection
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetesElector(t *testing.T) {
+	client := fake.NewClientset()
+	logger := slog.New(slog.DiscardHandler)
+
+	first, err := NewKubernetesElector(logger, client, "default", "csi", "first", time.Second)
+	require.NoError(t, err)
+	second, err := NewKubernetesElector(logger, client, "default", "csi", "second", time.Second)
+	require.NoError(t, err)
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstLeading := make(chan struct{})
+	firstDone := make(chan struct{})
+	go func() {
+		first.Run(firstCtx, func(ctx context.Context) {
+			close(firstLeading)
+			<-ctx.Done()
+		})
+		close(firstDone)
+	}()
+
+	select {
+	case <-firstLeading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership was not acquired")
+	}
+	assert.True(t, first.IsLeader())
+
+	lease, err := client.CoordinationV1().Leases("default").Get(context.Background(), "csi", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "first", *lease.Spec.HolderIdentity)
+
+	secondCtx, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	secondLeading := make(chan struct{})
+	go second.Run(secondCtx, func(ctx context.Context) {
+		close(secondLeading)
+		<-ctx.Done()
+	})
+
+	select {
+	case <-secondLeading:
+		t.Fatal("leadership was acquired while it is held by another replica")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// The leadership is released on shutdown, so the other replica takes
+	// over without waiting for the lease to expire.
+	cancelFirst()
+	<-firstDone
+	assert.False(t, first.IsLeader())
+
+	select {
+	case <-secondLeading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership was not taken over")
+	}
+	assert.True(t, second.IsLeader())
+}
+
+func TestNewKubernetesElectorInvalidConfig(t *testing.T) {
+	_, err := NewKubernetesElector(slog.New(slog.DiscardHandler), fake.NewClientset(), "default", "csi", "", time.Second)
+	require.Error(t, err)
+}
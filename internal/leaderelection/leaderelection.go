@@ -0,0 +1,138 @@
+// Package leaderelection elects a single leader among the replicas of the
+// controller, so background work only runs once, while all replicas serve
+// gRPC requests.
+//
+// The leadership is held in a Kubernetes Lease by a [KubernetesElector], or in
+// a lock provided by a [Backend] of an [Elector]: a Nomad variable lock or a
+// file lock for single-host setups.
+package leaderelection
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LeaderElector runs the leader callback while this replica holds the
+// leadership.
+type LeaderElector interface {
+	// Run campaigns for the leadership until the context is canceled. Every
+	// time the leadership is acquired, onLeading is started with a context,
+	// which is canceled once the leadership is lost. The leadership is only
+	// acquired again, after onLeading returned.
+	Run(ctx context.Context, onLeading func(ctx context.Context))
+	// IsLeader returns whether this replica currently holds the leadership.
+	IsLeader() bool
+}
+
+// Backend provides the lock which is held by the leader.
+type Backend interface {
+	// TryAcquireOrRenew acquires the lock, or renews it if it is already held
+	// by this replica. It returns false if the lock is held by another replica.
+	TryAcquireOrRenew(ctx context.Context) (bool, error)
+	// Release releases the lock, if it is held by this replica.
+	Release(ctx context.Context) error
+}
+
+// Elector campaigns for the leadership with the lock of a Backend and runs the
+// leader callback while the lock is held.
+type Elector struct {
+	logger        *slog.Logger
+	backend       Backend
+	leaseDuration time.Duration
+	retryPeriod   time.Duration
+
+	mu      sync.Mutex
+	leading bool
+}
+
+// NewElector creates an Elector. The leadership is given up, when it could not
+// be renewed for two thirds of the lease duration, so that another replica
+// does not take over while this replica still considers itself leader.
+func NewElector(logger *slog.Logger, backend Backend, leaseDuration time.Duration) *Elector {
+	return &Elector{
+		logger:        logger,
+		backend:       backend,
+		leaseDuration: leaseDuration,
+		retryPeriod:   leaseDuration / 5,
+	}
+}
+
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leading = leading
+}
+
+func (e *Elector) Run(ctx context.Context, onLeading func(ctx context.Context)) {
+	renewDeadline := e.leaseDuration * 2 / 3
+
+	var (
+		cancelLeading context.CancelFunc
+		leadingDone   chan struct{}
+		lastRenew     time.Time
+	)
+	// stopLeading waits for onLeading to return, so the background work of
+	// two leaderships never overlaps.
+	stopLeading := func() {
+		if cancelLeading != nil {
+			cancelLeading()
+			<-leadingDone
+			cancelLeading = nil
+			e.setLeading(false)
+		}
+	}
+
+	for {
+		acquired, err := e.backend.TryAcquireOrRenew(ctx)
+		switch {
+		case err != nil:
+			e.logger.Warn("failed to acquire or renew leadership", "err", err)
+			if cancelLeading != nil && time.Since(lastRenew) > renewDeadline {
+				e.logger.Info("lost leadership, could not renew it in time")
+				stopLeading()
+			}
+		case acquired:
+			lastRenew = time.Now()
+			if cancelLeading == nil {
+				e.logger.Info("acquired leadership")
+
+				var leaderCtx context.Context
+				leaderCtx, cancelLeading = context.WithCancel(ctx)
+				leadingDone = make(chan struct{})
+				e.setLeading(true)
+				go func() {
+					defer close(leadingDone)
+					onLeading(leaderCtx)
+				}()
+			}
+		default:
+			if cancelLeading != nil {
+				e.logger.Info("lost leadership to another replica")
+				stopLeading()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if cancelLeading != nil {
+				stopLeading()
+
+				releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.retryPeriod)
+				if err := e.backend.Release(releaseCtx); err != nil {
+					e.logger.Warn("failed to release leadership", "err", err)
+				}
+				cancel()
+			}
+			return
+		case <-time.After(e.retryPeriod):
+		}
+	}
+}
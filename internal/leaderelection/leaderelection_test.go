@@ -0,0 +1,149 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackend struct {
+	mu       sync.Mutex
+	acquired bool
+	err      error
+	released bool
+}
+
+func (b *fakeBackend) set(acquired bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acquired, b.err = acquired, err
+}
+
+func (b *fakeBackend) TryAcquireOrRenew(_ context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.acquired, b.err
+}
+
+func (b *fakeBackend) Release(_ context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.released = true
+	return nil
+}
+
+func TestElector(t *testing.T) {
+	backend := &fakeBackend{acquired: true}
+	elector := NewElector(slog.New(slog.DiscardHandler), backend, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leading := make(chan context.Context, 2)
+	done := make(chan struct{})
+	go func() {
+		elector.Run(ctx, func(ctx context.Context) { leading <- ctx })
+		close(done)
+	}()
+
+	var leaderCtx context.Context
+	select {
+	case leaderCtx = <-leading:
+	case <-time.After(time.Second):
+		t.Fatal("leadership was not acquired")
+	}
+	assert.True(t, elector.IsLeader())
+
+	// Another replica takes over the lock.
+	backend.set(false, nil)
+	select {
+	case <-leaderCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("leader context was not canceled")
+	}
+	assert.False(t, elector.IsLeader())
+
+	backend.set(true, nil)
+	select {
+	case leaderCtx = <-leading:
+	case <-time.After(time.Second):
+		t.Fatal("leadership was not acquired again")
+	}
+
+	cancel()
+	<-done
+	require.Error(t, leaderCtx.Err())
+	assert.True(t, backend.released)
+}
+
+func TestElectorRenewDeadline(t *testing.T) {
+	backend := &fakeBackend{acquired: true}
+	elector := NewElector(slog.New(slog.DiscardHandler), backend, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leading := make(chan context.Context, 1)
+	go elector.Run(ctx, func(ctx context.Context) { leading <- ctx })
+
+	var leaderCtx context.Context
+	select {
+	case leaderCtx = <-leading:
+	case <-time.After(time.Second):
+		t.Fatal("leadership was not acquired")
+	}
+
+	// The leadership is kept through failed renewals until the renew deadline.
+	backend.set(false, errors.New("api unavailable"))
+	select {
+	case <-leaderCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("leader context was not canceled after the renew deadline")
+	}
+	assert.False(t, elector.IsLeader())
+}
+
+func TestElectorWaitsForOnLeading(t *testing.T) {
+	backend := &fakeBackend{acquired: true}
+	elector := NewElector(slog.New(slog.DiscardHandler), backend, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var active, maxActive atomic.Int32
+	leading := make(chan struct{}, 2)
+	go elector.Run(ctx, func(ctx context.Context) {
+		n := active.Add(1)
+		if n > maxActive.Load() {
+			maxActive.Store(n)
+		}
+		leading <- struct{}{}
+
+		// The background work takes a while to stop.
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		active.Add(-1)
+	})
+
+	select {
+	case <-leading:
+	case <-time.After(time.Second):
+		t.Fatal("leadership was not acquired")
+	}
+
+	// The leadership is lost and acquired again right away.
+	backend.set(false, nil)
+	time.Sleep(20 * time.Millisecond)
+	backend.set(true, nil)
+
+	select {
+	case <-leading:
+	case <-time.After(time.Second):
+		t.Fatal("leadership was not acquired again")
+	}
+	assert.Equal(t, int32(1), maxActive.Load())
+}
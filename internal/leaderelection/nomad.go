@@ -0,0 +1,107 @@
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// NomadBackend holds the leadership with the lock of a Nomad variable. The
+// lock expires after the lease duration, unless it is renewed.
+type NomadBackend struct {
+	client        *api.Client
+	namespace     string
+	path          string
+	identity      string
+	leaseDuration time.Duration
+
+	mu    sync.Mutex
+	locks *api.Locks
+}
+
+// NewNomadBackend creates a NomadBackend. The namespace defaults to the
+// namespace of the client, e.g. from NOMAD_NAMESPACE.
+func NewNomadBackend(client *api.Client, namespace, path, identity string, leaseDuration time.Duration) *NomadBackend {
+	return &NomadBackend{
+		client:        client,
+		namespace:     namespace,
+		path:          path,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+	}
+}
+
+func (b *NomadBackend) TryAcquireOrRenew(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.locks != nil {
+		err := b.locks.Renew(ctx)
+		if err == nil {
+			return true, nil
+		}
+		if !lockLost(err) {
+			return false, fmt.Errorf("failed to renew variable lock: %w", err)
+		}
+		// The lock expired or was taken over, start over with acquiring it.
+		b.locks = nil
+	}
+
+	// The Elector retries on its own, so the client does not retry the
+	// requests of the lock.
+	locks, err := b.client.Locks(
+		api.WriteOptions{Namespace: b.namespace},
+		api.Variable{
+			Path:  b.path,
+			Items: api.VariableItems{"holder": b.identity},
+			Lock: &api.VariableLock{
+				TTL:       b.leaseDuration.String(),
+				LockDelay: b.leaseDuration.String(),
+			},
+		},
+		api.LocksOptionWithMaxRetries(0),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := locks.Acquire(ctx); err != nil {
+		if errors.Is(err, api.ErrLockConflict) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to acquire variable lock: %w", err)
+	}
+	b.locks = locks
+	return true, nil
+}
+
+func (b *NomadBackend) Release(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.locks == nil {
+		return nil
+	}
+
+	err := b.locks.Release(ctx)
+	b.locks = nil
+	if err != nil && !lockLost(err) {
+		return fmt.Errorf("failed to release variable lock: %w", err)
+	}
+	return nil
+}
+
+// lockLost reports whether the error of a lock operation means that the lock
+// is no longer held by this replica.
+func lockLost(err error) bool {
+	var responseErr api.UnexpectedResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	return errors.Is(err, api.ErrLockConflict)
+}
@@ -0,0 +1,100 @@
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNomadAPI implements the lock operations of the Nomad variables API.
+type fakeNomadAPI struct {
+	mu     sync.Mutex
+	lockID string
+	locks  int
+}
+
+func (f *fakeNomadAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method != http.MethodPut || r.URL.Path != "/v1/var/csi" || r.Header.Get("X-Nomad-Token") != "token" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var variable api.Variable
+	_ = json.NewDecoder(r.Body).Decode(&variable)
+
+	query := r.URL.Query()
+	switch {
+	case query.Has("lock-acquire"):
+		if f.lockID != "" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.locks++
+		f.lockID = "lock-" + strconv.Itoa(f.locks)
+		variable.Lock = &api.VariableLock{ID: f.lockID, TTL: variable.Lock.TTL}
+	case query.Has("lock-renew"):
+		if variable.Lock == nil || variable.Lock.ID != f.lockID {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+	case query.Has("lock-release"):
+		if variable.Lock == nil || variable.Lock.ID != f.lockID {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.lockID = ""
+		variable.Lock = nil
+	}
+	_ = json.NewEncoder(w).Encode(variable)
+}
+
+func TestNomadBackend(t *testing.T) {
+	ctx := context.Background()
+
+	nomadAPI := &fakeNomadAPI{}
+	server := httptest.NewServer(nomadAPI)
+	defer server.Close()
+
+	client, err := api.NewClient(&api.Config{Address: server.URL, SecretID: "token"})
+	require.NoError(t, err)
+
+	first := NewNomadBackend(client, "", "csi", "first", 15*time.Second)
+	second := NewNomadBackend(client, "", "csi", "second", 15*time.Second)
+
+	acquired, err := first.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	acquired, err = first.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	assert.Equal(t, 1, nomadAPI.locks)
+
+	acquired, err = second.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	require.NoError(t, first.Release(ctx))
+
+	acquired, err = second.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// The lock was lost, e.g. because it expired, and is acquired again.
+	nomadAPI.lockID = "lock-other"
+	acquired, err = second.TryAcquireOrRenew(ctx)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+}
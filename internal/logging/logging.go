@@ -0,0 +1,185 @@
+// Package logging filters log records by the level configured for the
+// component of the logger, which can be changed at runtime.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+)
+
+// ComponentKey is the attribute, which identifies the component of a logger,
+// e.g. logger.With(ComponentKey, "api-volume-service").
+const ComponentKey = "component"
+
+// Levels holds the default log level and the overrides per component. The
+// levels configured at startup or by a config reload are kept apart from the
+// levels changed at runtime, which take precedence, so a reload does not reset
+// them.
+type Levels struct {
+	mu        sync.RWMutex
+	level     slog.Level
+	overrides map[string]slog.Level
+
+	// runtimeLevel and runtimeOverrides are changed at runtime, e.g. on the
+	// /loglevel endpoint. runtimeLevel is nil, if the default level was not
+	// changed.
+	runtimeLevel     *slog.Level
+	runtimeOverrides map[string]slog.Level
+}
+
+func NewLevels(level slog.Level) *Levels {
+	return &Levels{
+		level:            level,
+		overrides:        make(map[string]slog.Level),
+		runtimeOverrides: make(map[string]slog.Level),
+	}
+}
+
+// Level returns the log level of the component.
+func (l *Levels) Level(component string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if level, ok := l.runtimeOverrides[component]; ok {
+		return level
+	}
+	if level, ok := l.overrides[component]; ok {
+		return level
+	}
+	return l.defaultLevel()
+}
+
+// defaultLevel returns the level of all components without an override. The
+// caller must hold the lock.
+func (l *Levels) defaultLevel() slog.Level {
+	if l.runtimeLevel != nil {
+		return *l.runtimeLevel
+	}
+	return l.level
+}
+
+// Configure replaces the configured default level and overrides, e.g. after
+// the config was reloaded. The levels changed at runtime are kept.
+func (l *Levels) Configure(level slog.Level, overrides map[string]slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.level = level
+	l.overrides = maps.Clone(overrides)
+	if l.overrides == nil {
+		l.overrides = make(map[string]slog.Level)
+	}
+}
+
+// SetDefault changes the log level of all components without an override at
+// runtime.
+func (l *Levels) SetDefault(level slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.runtimeLevel = &level
+}
+
+// Set overrides the log level of the component at runtime.
+func (l *Levels) Set(component string, level slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.runtimeOverrides[component] = level
+}
+
+// Reset removes the runtime override of the component, so the configured
+// level applies again.
+func (l *Levels) Reset(component string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.runtimeOverrides, component)
+}
+
+type levelsResponse struct {
+	Level     string            `json:"level"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+// ServeHTTP shows the effective log levels on GET requests. PUT requests change
+// the log level of the component query parameter, or the default level if it
+// is not set. DELETE requests remove the runtime override of the component.
+//
+//	curl -X PUT 'localhost:9189/loglevel?component=api-volume-service&level=debug'
+func (l *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	component := r.URL.Query().Get("component")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(r.URL.Query().Get("level"))); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if component == "" {
+			l.SetDefault(level)
+		} else {
+			l.Set(component, level)
+		}
+	case http.MethodDelete:
+		if component == "" {
+			http.Error(w, "missing component", http.StatusBadRequest)
+			return
+		}
+		l.Reset(component)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	l.mu.RLock()
+	resp := levelsResponse{Level: l.defaultLevel().String(), Overrides: make(map[string]string, len(l.overrides))}
+	for _, overrides := range []map[string]slog.Level{l.overrides, l.runtimeOverrides} {
+		for component, level := range overrides {
+			resp.Overrides[component] = level.String()
+		}
+	}
+	l.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Handler wraps a [slog.Handler] and drops records below the level of the
+// component of the logger.
+type Handler struct {
+	handler   slog.Handler
+	levels    *Levels
+	component string
+}
+
+// NewHandler creates a Handler. The level of the wrapped handler should be at
+// most the lowest level, which may be configured.
+func NewHandler(handler slog.Handler, levels *Levels) *Handler {
+	return &Handler{handler: handler, levels: levels}
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.levels.Level(h.component)
+}
+
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := h.component
+	for _, attr := range attrs {
+		if attr.Key == ComponentKey {
+			component = attr.Value.String()
+		}
+	}
+	return &Handler{handler: h.handler.WithAttrs(attrs), levels: h.levels, component: component}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{handler: h.handler.WithGroup(name), levels: h.levels, component: h.component}
+}
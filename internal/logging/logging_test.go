@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(levels *Levels) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return slog.New(NewHandler(handler, levels)), &buf
+}
+
+func TestHandlerComponentLevels(t *testing.T) {
+	levels := NewLevels(slog.LevelInfo)
+	levels.Configure(slog.LevelInfo, map[string]slog.Level{
+		"linux-mount-service": slog.LevelDebug,
+		"api-volume-service":  slog.LevelWarn,
+	})
+
+	logger, buf := newTestLogger(levels)
+
+	logger.Debug("default debug")
+	logger.Info("default info")
+	logger.With(ComponentKey, "linux-mount-service").Debug("mount debug")
+	logger.With(ComponentKey, "api-volume-service").Info("api info")
+	logger.With(ComponentKey, "api-volume-service").WithGroup("group").Warn("api warn")
+
+	output := buf.String()
+	assert.NotContains(t, output, "default debug")
+	assert.Contains(t, output, "default info")
+	assert.Contains(t, output, "mount debug")
+	assert.NotContains(t, output, "api info")
+	assert.Contains(t, output, "api warn")
+}
+
+func TestLevelsConfigureKeepsRuntimeLevels(t *testing.T) {
+	levels := NewLevels(slog.LevelInfo)
+	levels.Configure(slog.LevelInfo, map[string]slog.Level{"linux-mount-service": slog.LevelWarn})
+	levels.Set("api-volume-service", slog.LevelDebug)
+
+	// A config reload keeps the levels changed at runtime.
+	levels.Configure(slog.LevelWarn, nil)
+	assert.Equal(t, slog.LevelDebug, levels.Level("api-volume-service"))
+	assert.Equal(t, slog.LevelWarn, levels.Level("linux-mount-service"))
+	assert.Equal(t, slog.LevelWarn, levels.Level("other"))
+
+	levels.SetDefault(slog.LevelError)
+	levels.Configure(slog.LevelInfo, map[string]slog.Level{"linux-mount-service": slog.LevelDebug})
+	assert.Equal(t, slog.LevelError, levels.Level("other"))
+	assert.Equal(t, slog.LevelDebug, levels.Level("linux-mount-service"))
+
+	levels.Reset("api-volume-service")
+	assert.Equal(t, slog.LevelError, levels.Level("api-volume-service"))
+}
+
+func TestLevelsServeHTTP(t *testing.T) {
+	levels := NewLevels(slog.LevelInfo)
+
+	recorder := httptest.NewRecorder()
+	levels.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/loglevel?component=api-volume-service&level=debug", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"level":"INFO","overrides":{"api-volume-service":"DEBUG"}}`, recorder.Body.String())
+	assert.Equal(t, slog.LevelDebug, levels.Level("api-volume-service"))
+
+	recorder = httptest.NewRecorder()
+	levels.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/loglevel?level=warn", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, slog.LevelWarn, levels.Level("other"))
+
+	recorder = httptest.NewRecorder()
+	levels.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/loglevel?component=api-volume-service", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, slog.LevelWarn, levels.Level("api-volume-service"))
+
+	recorder = httptest.NewRecorder()
+	levels.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/loglevel?level=verbose", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
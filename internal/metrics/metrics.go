@@ -1,8 +1,10 @@
 package metrics
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
@@ -10,28 +12,120 @@ import (
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
 )
 
 // Metrics wraps the prometheus metrics gathering and serving.
 //
-// It exposes gRPC and Go Runtime metrics.
+// It exposes gRPC, Go Runtime, hcloud API rate limit and volume operation
+// metrics.
 type Metrics struct {
 	logger      *slog.Logger
 	addr        string
+	mux         *http.ServeMux
+	authMux     *http.ServeMux
+	ready       atomic.Pointer[func() bool]
+	server      atomic.Pointer[http.Server]
 	reg         *prometheus.Registry
 	grpcMetrics *grpcprom.ServerMetrics
 	goMetrics   prometheus.Collector
+
+	rateLimitLimit     *prometheus.GaugeVec
+	rateLimitRemaining *prometheus.GaugeVec
+	rateLimitDelayed   *prometheus.CounterVec
+
+	volumeOperationDuration *prometheus.HistogramVec
+	volumeOperationErrors   *prometheus.CounterVec
+	nodeCommandDuration     *prometheus.HistogramVec
+	luksOpenFailures        prometheus.Counter
+	apiTokenGeneration      *prometheus.GaugeVec
+
+	volumeUsedBytes      *prometheus.GaugeVec
+	volumeAvailableBytes *prometheus.GaugeVec
+	volumeUsedINodes     *prometheus.GaugeVec
+	volumeFreeINodes     *prometheus.GaugeVec
+	volumeReadOnly       *prometheus.GaugeVec
+	volumeEncrypted      *prometheus.GaugeVec
+	volumeInfo           *prometheus.GaugeVec
 }
 
+// volumeUsageLabels are the labels of the per-volume usage metrics of the node.
+var volumeUsageLabels = []string{"volume_id", "target_path"}
+
 func New(logger *slog.Logger, addr string) *Metrics {
 	metrics := &Metrics{
-		logger: logger,
-		addr:   addr,
-		reg:    prometheus.NewRegistry(),
+		logger:  logger,
+		addr:    addr,
+		mux:     http.NewServeMux(),
+		authMux: http.NewServeMux(),
+		reg:     prometheus.NewRegistry(),
 		grpcMetrics: grpcprom.NewServerMetrics(
 			grpcprom.WithServerHandlingTimeHistogram(),
 		),
 		goMetrics: collectors.NewGoCollector(),
+		rateLimitLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_api_rate_limit_limit",
+			Help: "Rate limit of the hcloud API, as reported by the last response.",
+		}, []string{"profile"}),
+		rateLimitRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_api_rate_limit_remaining",
+			Help: "Remaining rate limit budget of the hcloud API, as reported by the last response.",
+		}, []string{"profile"}),
+		rateLimitDelayed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hcloud_api_rate_limit_delayed_requests_total",
+			Help: "Number of hcloud API requests delayed because of a low rate limit budget.",
+		}, []string{"priority", "profile"}),
+		volumeOperationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "hcloud_csi_volume_operation_duration_seconds",
+			Help:    "Duration of volume operations by the controller, split into the phase of the API request and of waiting for the action.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32, 64, 128},
+		}, []string{"operation", "result", "phase"}),
+		volumeOperationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "hcloud_csi_volume_operation_errors_total",
+			Help: "Number of volume operations, which failed because the server was locked or the attach limit was reached.",
+		}, []string{"operation", "reason"}),
+		nodeCommandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "hcloud_csi_node_command_duration_seconds",
+			Help:    "Duration of commands run on the node, like mkfs, fsck and mount.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32, 64},
+		}, []string{"command", "result"}),
+		luksOpenFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hcloud_csi_node_luks_open_failures_total",
+			Help: "Number of LUKS devices, which could not be opened.",
+		}),
+		apiTokenGeneration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_csi_api_token_generation",
+			Help: "Generation of the hcloud API token, which is increased every time the token is reloaded with a new value.",
+		}, []string{"profile"}),
+		volumeUsedBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_volume_used_bytes",
+			Help: "Bytes used on the file system of a published volume.",
+		}, volumeUsageLabels),
+		volumeAvailableBytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_volume_available_bytes",
+			Help: "Bytes available on the file system of a published volume.",
+		}, volumeUsageLabels),
+		volumeUsedINodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_volume_used_inodes",
+			Help: "Inodes used on the file system of a published volume.",
+		}, volumeUsageLabels),
+		volumeFreeINodes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_volume_free_inodes",
+			Help: "Inodes available on the file system of a published volume.",
+		}, volumeUsageLabels),
+		volumeReadOnly: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_volume_read_only",
+			Help: "Whether a published volume is mounted read-only (1) or read-write (0).",
+		}, volumeUsageLabels),
+		volumeEncrypted: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_volume_encrypted",
+			Help: "Whether a published volume is encrypted with LUKS (1) or not (0).",
+		}, volumeUsageLabels),
+		volumeInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_volume_info",
+			Help: "Information about a published volume, like its file system type. The value is always 1.",
+		}, append(volumeUsageLabels, "fs_type")),
 	}
 
 	metrics.logger.Debug(
@@ -40,11 +134,28 @@ func New(logger *slog.Logger, addr string) *Metrics {
 
 	metrics.reg.MustRegister(metrics.goMetrics)
 	metrics.reg.MustRegister(metrics.grpcMetrics)
+	metrics.reg.MustRegister(metrics.rateLimitLimit)
+	metrics.reg.MustRegister(metrics.rateLimitRemaining)
+	metrics.reg.MustRegister(metrics.rateLimitDelayed)
+	metrics.reg.MustRegister(metrics.volumeOperationDuration)
+	metrics.reg.MustRegister(metrics.volumeOperationErrors)
+	metrics.reg.MustRegister(metrics.nodeCommandDuration)
+	metrics.reg.MustRegister(metrics.luksOpenFailures)
+	metrics.reg.MustRegister(metrics.apiTokenGeneration)
+	metrics.reg.MustRegister(metrics.volumeUsedBytes)
+	metrics.reg.MustRegister(metrics.volumeAvailableBytes)
+	metrics.reg.MustRegister(metrics.volumeUsedINodes)
+	metrics.reg.MustRegister(metrics.volumeFreeINodes)
+	metrics.reg.MustRegister(metrics.volumeReadOnly)
+	metrics.reg.MustRegister(metrics.volumeEncrypted)
+	metrics.reg.MustRegister(metrics.volumeInfo)
 
 	metrics.logger.Debug(
 		"registered metrics",
 	)
 
+	metrics.mux.Handle("/", promhttp.HandlerFor(metrics.reg, promhttp.HandlerOpts{}))
+
 	return metrics
 }
 
@@ -64,25 +175,188 @@ func (s *Metrics) InitializeMetrics(server *grpc.Server) {
 func (s *Metrics) Registry() *prometheus.Registry {
 	return s.reg
 }
-func (s *Metrics) Serve() {
-	httpServer := &http.Server{
-		Handler:      promhttp.HandlerFor(s.reg, promhttp.HandlerOpts{}),
-		Addr:         s.addr,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+
+// ObserveRateLimit records the rate limit budget of the hcloud API of the
+// default project.
+func (s *Metrics) ObserveRateLimit(limit, remaining int) {
+	s.ProfileRateLimit("").ObserveRateLimit(limit, remaining)
+}
+
+// ObserveRateLimitDelay records a hcloud API request of the default project
+// delayed because of a low rate limit budget.
+func (s *Metrics) ObserveRateLimitDelay(priority string) {
+	s.ProfileRateLimit("").ObserveRateLimitDelay(priority)
+}
+
+// ProfileRateLimitObserver records the rate limit metrics of the hcloud API of
+// a project profile, which are labeled with the name of the profile.
+type ProfileRateLimitObserver struct {
+	metrics *Metrics
+	profile string
+}
+
+// ProfileRateLimit returns the observer of the rate limit of a project
+// profile. The default project has an empty profile name.
+func (s *Metrics) ProfileRateLimit(profile string) *ProfileRateLimitObserver {
+	if s == nil {
+		return nil
 	}
+	return &ProfileRateLimitObserver{metrics: s, profile: profile}
+}
 
-	s.logger.Debug(
-		"starting prometheus http server",
-		"addr", s.addr,
-	)
+// ObserveRateLimit records the rate limit budget of the hcloud API.
+func (o *ProfileRateLimitObserver) ObserveRateLimit(limit, remaining int) {
+	if o == nil {
+		return
+	}
+	o.metrics.rateLimitLimit.WithLabelValues(o.profile).Set(float64(limit))
+	o.metrics.rateLimitRemaining.WithLabelValues(o.profile).Set(float64(remaining))
+}
+
+// ObserveRateLimitDelay records a hcloud API request delayed because of a low
+// rate limit budget.
+func (o *ProfileRateLimitObserver) ObserveRateLimitDelay(priority string) {
+	if o == nil {
+		return
+	}
+	o.metrics.rateLimitDelayed.WithLabelValues(priority, o.profile).Inc()
+}
+
+// ObserveVolumeOperation records the duration of a volume operation, split
+// into the time spent on the API request and on waiting for the action.
+func (s *Metrics) ObserveVolumeOperation(operation, result string, api, actionWait time.Duration) {
+	if s == nil {
+		return
+	}
+	s.volumeOperationDuration.WithLabelValues(operation, result, "api").Observe(api.Seconds())
+	if actionWait > 0 {
+		s.volumeOperationDuration.WithLabelValues(operation, result, "action_wait").Observe(actionWait.Seconds())
+	}
+}
+
+// ObserveVolumeOperationError records a volume operation, which failed for the
+// given reason, e.g. a locked server.
+func (s *Metrics) ObserveVolumeOperationError(operation, reason string) {
+	if s == nil {
+		return
+	}
+	s.volumeOperationErrors.WithLabelValues(operation, reason).Inc()
+}
+
+// ObserveNodeCommand records the duration of a command run on the node.
+func (s *Metrics) ObserveNodeCommand(command, result string, duration time.Duration) {
+	if s == nil {
+		return
+	}
+	s.nodeCommandDuration.WithLabelValues(command, result).Observe(duration.Seconds())
+}
 
-	go func() {
-		if err := httpServer.ListenAndServe(); err != nil {
-			s.logger.Error(
-				"Unable to start the prometheus http server",
-				"err", err,
-			)
+// ObserveLUKSOpenFailure records a LUKS device, which could not be opened.
+func (s *Metrics) ObserveLUKSOpenFailure() {
+	if s == nil {
+		return
+	}
+	s.luksOpenFailures.Inc()
+}
+
+// ObserveTokenGeneration records the generation of the hcloud API token of the
+// default project.
+func (s *Metrics) ObserveTokenGeneration(generation int64) {
+	s.ProfileToken("").ObserveTokenGeneration(generation)
+}
+
+// ProfileTokenObserver records the generation of the hcloud API token of a
+// project profile, which is labeled with the name of the profile.
+type ProfileTokenObserver struct {
+	metrics *Metrics
+	profile string
+}
+
+// ProfileToken returns the observer of the API token of a project profile.
+// The default project has an empty profile name.
+func (s *Metrics) ProfileToken(profile string) *ProfileTokenObserver {
+	if s == nil {
+		return nil
+	}
+	return &ProfileTokenObserver{metrics: s, profile: profile}
+}
+
+// ObserveTokenGeneration records the generation of the hcloud API token.
+func (o *ProfileTokenObserver) ObserveTokenGeneration(generation int64) {
+	if o == nil {
+		return
+	}
+	o.metrics.apiTokenGeneration.WithLabelValues(o.profile).Set(float64(generation))
+}
+
+// ObserveVolumeUsage replaces the usage metrics of the published volumes with
+// the result of the latest scan, so volumes, which are no longer published,
+// disappear.
+func (s *Metrics) ObserveVolumeUsage(usage []csi.VolumeUsage) {
+	if s == nil {
+		return
+	}
+	gauges := []*prometheus.GaugeVec{
+		s.volumeUsedBytes, s.volumeAvailableBytes, s.volumeUsedINodes, s.volumeFreeINodes,
+		s.volumeReadOnly, s.volumeEncrypted, s.volumeInfo,
+	}
+	for _, gauge := range gauges {
+		gauge.Reset()
+	}
+
+	for _, u := range usage {
+		s.volumeUsedBytes.WithLabelValues(u.VolumeID, u.TargetPath).Set(float64(u.UsedBytes))
+		s.volumeAvailableBytes.WithLabelValues(u.VolumeID, u.TargetPath).Set(float64(u.AvailableBytes))
+		s.volumeUsedINodes.WithLabelValues(u.VolumeID, u.TargetPath).Set(float64(u.UsedINodes))
+		s.volumeFreeINodes.WithLabelValues(u.VolumeID, u.TargetPath).Set(float64(u.FreeINodes))
+		s.volumeReadOnly.WithLabelValues(u.VolumeID, u.TargetPath).Set(boolToFloat(u.ReadOnly))
+		s.volumeEncrypted.WithLabelValues(u.VolumeID, u.TargetPath).Set(boolToFloat(u.Encrypted))
+		s.volumeInfo.WithLabelValues(u.VolumeID, u.TargetPath, u.FSType).Set(1)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// RegisterAttachedVolumes exposes the number of volumes attached to the node,
+// which is counted on every scrape, and the maximum number of volumes per node.
+func (s *Metrics) RegisterAttachedVolumes(count func() int, maxVolumes int) {
+	if s == nil {
+		return
+	}
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_attached_volumes",
+			Help: "Number of volumes attached to the node.",
+		}, func() float64 { return float64(count()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "hcloud_csi_node_max_volumes",
+			Help: "Maximum number of volumes, which can be attached to the node.",
+		}, func() float64 { return float64(maxVolumes) }),
+	}
+	for _, collector := range collectors {
+		// The gauges are registered once per process, later registrations keep
+		// the existing ones.
+		if err := s.reg.Register(collector); err != nil && !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			s.logger.Error("failed to register metric", "err", err)
 		}
-	}()
+	}
+}
+
+// Handle registers an additional handler on the metrics http server, e.g. for
+// debugging endpoints. Handlers can be registered after the server started.
+func (s *Metrics) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleAuthenticated registers a handler, which changes the driver or exposes
+// its configuration, e.g. /loglevel. It is only served, if the server requires
+// authentication with a token or client certificates, and is rejected with 403
+// otherwise.
+func (s *Metrics) HandleAuthenticated(pattern string, handler http.Handler) {
+	s.authMux.Handle(pattern, handler)
 }
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/tlsconfig"
+)
+
+// ServeOpts configure the security of the metrics http server. The zero value
+// serves plain HTTP without authentication.
+type ServeOpts struct {
+	// TLSCertFile and TLSKeyFile enable TLS. The files are reloaded once they
+	// change.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ClientCAFile enables authentication with client certificates issued by
+	// the CAs in the file. It requires TLS.
+	ClientCAFile string
+	// AuthToken enables authentication with a bearer token.
+	AuthToken string
+}
+
+// healthPaths are served without authentication, so they can be used for the
+// liveness and readiness probes of the container orchestrator.
+var healthPaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// SetReadinessCheck sets the function, which decides whether /readyz reports
+// the driver as ready. Until it is set, the driver is not ready.
+func (s *Metrics) SetReadinessCheck(ready func() bool) {
+	if s == nil {
+		return
+	}
+	s.ready.Store(&ready)
+}
+
+// Serve binds the address and serves the metrics, the additional handlers and
+// the health endpoints in the background. It fails, if the address cannot be
+// bound or the TLS files are invalid.
+func (s *Metrics) Serve(opts ServeOpts) error {
+	if opts.ClientCAFile != "" && opts.TLSCertFile == "" {
+		return errors.New("client certificate authentication requires TLS")
+	}
+
+	httpServer := &http.Server{
+		Handler:      s.handler(opts),
+		Addr:         s.addr,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+
+	if opts.TLSCertFile != "" || opts.TLSKeyFile != "" {
+		reloader, err := tlsconfig.NewReloader(s.logger, tlsconfig.Files{
+			CertFile: opts.TLSCertFile,
+			KeyFile:  opts.TLSKeyFile,
+			CAFile:   opts.ClientCAFile,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load TLS files of the metrics server: %w", err)
+		}
+		// Health endpoints are available without a client certificate, so it
+		// is verified if given and required in the handler.
+		httpServer.TLSConfig = reloader.ServerConfig(tls.VerifyClientCertIfGiven)
+	}
+
+	if opts.AuthToken == "" && opts.ClientCAFile == "" {
+		s.logger.Warn("the metrics http server does not require authentication, the endpoints which change the driver or expose its configuration are disabled")
+	}
+
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start the metrics http server: %w", err)
+	}
+
+	s.logger.Debug(
+		"starting prometheus http server",
+		"addr", listener.Addr().String(),
+		"tls", httpServer.TLSConfig != nil,
+	)
+
+	s.server.Store(httpServer)
+	go func() {
+		var err error
+		if httpServer.TLSConfig != nil {
+			err = httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = httpServer.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error(
+				"the prometheus http server stopped",
+				"err", err,
+			)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the server started by [Metrics.Serve] after the running
+// scrapes finished or the context is canceled.
+func (s *Metrics) Shutdown(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	httpServer := s.server.Load()
+	if httpServer == nil {
+		return nil
+	}
+	return httpServer.Shutdown(ctx)
+}
+
+func (s *Metrics) handler(opts ServeOpts) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if ready := s.ready.Load(); ready == nil || !(*ready)() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.Handle("/", s.mux)
+
+	authRequired := opts.AuthToken != "" || opts.ClientCAFile != ""
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authRequired && !healthPaths[r.URL.Path] && !authorized(r, opts) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if handler, pattern := s.authMux.Handler(r); pattern != "" {
+			if !authRequired {
+				http.Error(w, "this endpoint requires authentication of the metrics server", http.StatusForbidden)
+				return
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authorized checks whether the request has a verified client certificate or
+// the bearer token.
+func authorized(r *http.Request, opts ServeOpts) bool {
+	if opts.ClientCAFile != "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if opts.AuthToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(opts.AuthToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerAuth(t *testing.T) {
+	m := New(slog.New(slog.DiscardHandler), ":0")
+	handler := m.handler(ServeOpts{AuthToken: "secret"})
+
+	for _, tt := range []struct {
+		name   string
+		path   string
+		header string
+		status int
+	}{
+		{name: "metrics without token", path: "/metrics", status: http.StatusUnauthorized},
+		{name: "metrics with wrong token", path: "/metrics", header: "Bearer wrong", status: http.StatusUnauthorized},
+		{name: "metrics with token", path: "/metrics", header: "Bearer secret", status: http.StatusOK},
+		{name: "healthz without token", path: "/healthz", status: http.StatusOK},
+		{name: "readyz without token", path: "/readyz", status: http.StatusServiceUnavailable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+}
+
+func TestHandlerAuthenticatedEndpoints(t *testing.T) {
+	m := New(slog.New(slog.DiscardHandler), ":0")
+	m.HandleAuthenticated("/loglevel", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("info\n"))
+	}))
+
+	serve := func(handler http.Handler, header string) int {
+		req := httptest.NewRequest(http.MethodPut, "/loglevel", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Without authentication, the endpoint is not served at all.
+	assert.Equal(t, http.StatusForbidden, serve(m.handler(ServeOpts{}), ""))
+
+	handler := m.handler(ServeOpts{AuthToken: "secret"})
+	assert.Equal(t, http.StatusUnauthorized, serve(handler, ""))
+	assert.Equal(t, http.StatusOK, serve(handler, "Bearer secret"))
+}
+
+func TestHandlerReadyz(t *testing.T) {
+	m := New(slog.New(slog.DiscardHandler), ":0")
+	handler := m.handler(ServeOpts{})
+
+	ready := false
+	m.SetReadinessCheck(func() bool { return ready })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	ready = true
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServeFailsOnBoundPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	m := New(slog.New(slog.DiscardHandler), listener.Addr().String())
+	require.Error(t, m.Serve(ServeOpts{}))
+}
+
+func TestServeRequiresTLSForClientCA(t *testing.T) {
+	m := New(slog.New(slog.DiscardHandler), "127.0.0.1:0")
+	require.EqualError(t, m.Serve(ServeOpts{ClientCAFile: "ca.crt"}), "client certificate authentication requires TLS")
+}
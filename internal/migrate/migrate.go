@@ -0,0 +1,480 @@
+// Package migrate copies the content of a volume to another volume over the
+// network. It is used to migrate volumes between locations, by running a
+// [Receiver] on a server with the target volume attached and a [Sender] on a
+// server with the source volume attached.
+//
+// The connection is secured with mutual TLS. After the handshake, the sender
+// sends a header with the shared token and waits until the receiver accepted
+// it, before any data is sent. The receiver keeps accepting connections until
+// a sender authenticated.
+//
+// The data is streamed in chunks. Each chunk carries a SHA-256 checksum, which
+// is verified by the receiver. Chunks that only contain zeros are transferred
+// without payload. After all chunks were written, the receiver reads back the
+// target device and compares its checksum with the checksum of the source.
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultChunkSize is the size of the chunks the device is transferred in.
+	DefaultChunkSize = 4 * 1024 * 1024
+
+	protocolMagic   = "HCMIGR02"
+	maxStringLength = 1024
+
+	// handshakeTimeout bounds the TLS handshake and the authentication of a
+	// sender, so a stalled connection does not block the receiver.
+	handshakeTimeout = 30 * time.Second
+
+	frameData uint8 = 0
+	frameZero uint8 = 1
+	frameEnd  uint8 = 2
+
+	statusOK    uint8 = 0
+	statusError uint8 = 1
+)
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrTargetTooSmall   = errors.New("target device is smaller than source device")
+	ErrUnauthorized     = errors.New("invalid migration token")
+	ErrStringTooLong    = errors.New("string exceeds maximum length")
+)
+
+type header struct {
+	Size      uint64
+	ChunkSize uint32
+	Token     string
+}
+
+type frameHeader struct {
+	Offset   uint64
+	Length   uint32
+	Type     uint8
+	Checksum [sha256.Size]byte
+}
+
+// Sender streams the content of a device to a [Receiver].
+type Sender struct {
+	logger    *slog.Logger
+	chunkSize int
+	token     string
+	tlsConfig *tls.Config
+}
+
+// NewSender returns a sender, which authenticates with the token and the
+// client certificate of tlsConfig.
+func NewSender(logger *slog.Logger, token string, tlsConfig *tls.Config) *Sender {
+	return &Sender{
+		logger:    logger,
+		chunkSize: DefaultChunkSize,
+		token:     token,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Send streams the content of the device at devicePath to the receiver
+// listening at addr and waits until the receiver verified the written data.
+func (s *Sender) Send(ctx context.Context, devicePath string, addr string) error {
+	device, err := os.Open(devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to open source device: %w", err)
+	}
+	defer device.Close()
+
+	size, err := deviceSize(device)
+	if err != nil {
+		return err
+	}
+
+	dialer := tls.Dialer{Config: s.tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to receiver: %w", err)
+	}
+	defer conn.Close()
+	stopOnCancel(ctx, conn)
+
+	s.logger.Info(
+		"sending device",
+		"device-path", devicePath,
+		"receiver", addr,
+		"size", size,
+	)
+
+	if err := writeHeader(conn, header{Size: size, ChunkSize: uint32(s.chunkSize), Token: s.token}); err != nil { //nolint:gosec // G115: chunk size is a small constant
+		return err
+	}
+	if err := readStatus(conn); err != nil {
+		return fmt.Errorf("receiver rejected the transfer: %w", err)
+	}
+
+	total := sha256.New()
+	buf := make([]byte, s.chunkSize)
+	for offset := uint64(0); offset < size; {
+		n, err := io.ReadFull(device, buf[:min(uint64(s.chunkSize), size-offset)])
+		if err != nil {
+			return fmt.Errorf("failed to read source device at offset %d: %w", offset, err)
+		}
+		chunk := buf[:n]
+		total.Write(chunk)
+
+		frame := frameHeader{
+			Offset:   offset,
+			Length:   uint32(n), //nolint:gosec // G115: n is at most the chunk size
+			Type:     frameData,
+			Checksum: sha256.Sum256(chunk),
+		}
+		if isZero(chunk) {
+			frame.Type = frameZero
+		}
+		if err := binary.Write(conn, binary.BigEndian, frame); err != nil {
+			return fmt.Errorf("failed to send chunk at offset %d: %w", offset, err)
+		}
+		if frame.Type == frameData {
+			if _, err := conn.Write(chunk); err != nil {
+				return fmt.Errorf("failed to send chunk at offset %d: %w", offset, err)
+			}
+		}
+
+		offset += uint64(n)
+	}
+
+	end := frameHeader{Offset: size, Type: frameEnd}
+	copy(end.Checksum[:], total.Sum(nil))
+	if err := binary.Write(conn, binary.BigEndian, end); err != nil {
+		return fmt.Errorf("failed to send end of stream: %w", err)
+	}
+
+	if err := readStatus(conn); err != nil {
+		return fmt.Errorf("receiver failed: %w", err)
+	}
+
+	s.logger.Info(
+		"device sent and verified",
+		"device-path", devicePath,
+		"checksum", fmt.Sprintf("%x", end.Checksum),
+	)
+	return nil
+}
+
+// Receiver writes the content streamed by a [Sender] to a device.
+type Receiver struct {
+	logger    *slog.Logger
+	token     string
+	tlsConfig *tls.Config
+}
+
+// NewReceiver returns a receiver, which only accepts senders with the token
+// and a client certificate, which is verified with tlsConfig.
+func NewReceiver(logger *slog.Logger, token string, tlsConfig *tls.Config) *Receiver {
+	return &Receiver{
+		logger:    logger,
+		token:     token,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Receive accepts connections on the listener until a sender authenticated,
+// and writes the content streamed by that sender to the device at devicePath.
+func (r *Receiver) Receive(ctx context.Context, devicePath string, listener net.Listener) error {
+	stopOnCancel(ctx, listener)
+
+	r.logger.Info(
+		"waiting for sender",
+		"device-path", devicePath,
+		"addr", listener.Addr().String(),
+	)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		tlsConn, h, err := r.authenticate(ctx, conn)
+		if err != nil {
+			r.logger.Warn(
+				"rejected sender",
+				"sender", conn.RemoteAddr().String(),
+				"err", err,
+			)
+			_ = conn.Close()
+			continue
+		}
+
+		return r.serve(ctx, tlsConn, h, devicePath)
+	}
+}
+
+// authenticate runs the TLS handshake and verifies the token in the header
+// sent by the sender. The sender is told why it was rejected, if the handshake
+// succeeded.
+func (r *Receiver) authenticate(ctx context.Context, conn net.Conn) (*tls.Conn, header, error) {
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return nil, header{}, err
+	}
+
+	tlsConn := tls.Server(conn, r.tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, header{}, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+
+	h, err := readHeader(tlsConn)
+	if err == nil && subtle.ConstantTimeCompare([]byte(h.Token), []byte(r.token)) != 1 {
+		err = ErrUnauthorized
+	}
+	if err != nil {
+		_ = writeStatus(tlsConn, err)
+		return nil, header{}, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, header{}, err
+	}
+	return tlsConn, h, nil
+}
+
+// serve receives the data of an authenticated sender and sends the result.
+func (r *Receiver) serve(ctx context.Context, conn *tls.Conn, h header, devicePath string) error {
+	defer conn.Close()
+	stopOnCancel(ctx, conn)
+
+	receiveErr := r.receive(conn, h, devicePath)
+	if err := writeStatus(conn, receiveErr); err != nil {
+		return errors.Join(receiveErr, fmt.Errorf("failed to send result: %w", err))
+	}
+	return receiveErr
+}
+
+func (r *Receiver) receive(conn net.Conn, h header, devicePath string) error {
+	device, err := os.OpenFile(devicePath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open target device: %w", err)
+	}
+	defer device.Close()
+
+	size, err := deviceSize(device)
+	if err != nil {
+		return err
+	}
+	if size < h.Size {
+		return fmt.Errorf("%w: %d < %d", ErrTargetTooSmall, size, h.Size)
+	}
+
+	// Tell the sender to start streaming.
+	if err := writeStatus(conn, nil); err != nil {
+		return fmt.Errorf("failed to accept transfer: %w", err)
+	}
+
+	r.logger.Info(
+		"receiving device",
+		"device-path", devicePath,
+		"sender", conn.RemoteAddr().String(),
+		"size", h.Size,
+	)
+
+	buf := make([]byte, h.ChunkSize)
+	zero := make([]byte, h.ChunkSize)
+	for {
+		var frame frameHeader
+		if err := binary.Read(conn, binary.BigEndian, &frame); err != nil {
+			return fmt.Errorf("failed to read chunk: %w", err)
+		}
+		if frame.Type == frameEnd {
+			return r.verify(device, h.Size, frame.Checksum)
+		}
+		if frame.Length > h.ChunkSize || frame.Offset+uint64(frame.Length) > h.Size {
+			return fmt.Errorf("invalid chunk at offset %d with length %d", frame.Offset, frame.Length)
+		}
+
+		chunk := zero[:frame.Length]
+		if frame.Type == frameData {
+			chunk = buf[:frame.Length]
+			if _, err := io.ReadFull(conn, chunk); err != nil {
+				return fmt.Errorf("failed to read chunk at offset %d: %w", frame.Offset, err)
+			}
+		}
+		if sha256.Sum256(chunk) != frame.Checksum {
+			return fmt.Errorf("%w: chunk at offset %d", ErrChecksumMismatch, frame.Offset)
+		}
+
+		if _, err := device.WriteAt(chunk, int64(frame.Offset)); err != nil { //nolint:gosec // G115: offset is bounded by the device size
+			return fmt.Errorf("failed to write chunk at offset %d: %w", frame.Offset, err)
+		}
+	}
+}
+
+// verify reads back the written data and compares its checksum with the
+// checksum of the source device.
+func (r *Receiver) verify(device *os.File, size uint64, expected [sha256.Size]byte) error {
+	if err := device.Sync(); err != nil {
+		return fmt.Errorf("failed to sync target device: %w", err)
+	}
+
+	total := sha256.New()
+	if _, err := io.Copy(total, io.NewSectionReader(device, 0, int64(size))); err != nil { //nolint:gosec // G115: size is bounded by the device size
+		return fmt.Errorf("failed to read back target device: %w", err)
+	}
+
+	var actual [sha256.Size]byte
+	copy(actual[:], total.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("%w: expected %x, got %x", ErrChecksumMismatch, expected, actual)
+	}
+
+	r.logger.Info(
+		"device received and verified",
+		"device-path", device.Name(),
+		"checksum", fmt.Sprintf("%x", actual),
+	)
+	return nil
+}
+
+func deviceSize(device *os.File) (uint64, error) {
+	size, err := device.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine size of %s: %w", device.Name(), err)
+	}
+	if _, err := device.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to determine size of %s: %w", device.Name(), err)
+	}
+	return uint64(size), nil
+}
+
+func isZero(b []byte) bool {
+	for len(b) > 0 {
+		n := min(len(b), len(zeroPage))
+		if !bytes.Equal(b[:n], zeroPage[:n]) {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
+
+var zeroPage = make([]byte, 4096)
+
+func writeHeader(w io.Writer, h header) error {
+	if _, err := io.WriteString(w, protocolMagic); err != nil {
+		return fmt.Errorf("failed to send header: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, h.Size); err != nil {
+		return fmt.Errorf("failed to send header: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, h.ChunkSize); err != nil {
+		return fmt.Errorf("failed to send header: %w", err)
+	}
+	if err := writeString(w, h.Token); err != nil {
+		return fmt.Errorf("failed to send header: %w", err)
+	}
+	return nil
+}
+
+func readHeader(r io.Reader) (header, error) {
+	var h header
+
+	magic := make([]byte, len(protocolMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return h, fmt.Errorf("failed to read header: %w", err)
+	}
+	if string(magic) != protocolMagic {
+		return h, errors.New("unsupported migration protocol")
+	}
+	if err := binary.Read(r, binary.BigEndian, &h.Size); err != nil {
+		return h, fmt.Errorf("failed to read header: %w", err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &h.ChunkSize); err != nil {
+		return h, fmt.Errorf("failed to read header: %w", err)
+	}
+	if h.ChunkSize == 0 || h.ChunkSize > 64*DefaultChunkSize {
+		return h, fmt.Errorf("invalid chunk size %d", h.ChunkSize)
+	}
+	token, err := readString(r)
+	if err != nil {
+		return h, fmt.Errorf("failed to read header: %w", err)
+	}
+	h.Token = token
+	return h, nil
+}
+
+func writeString(w io.Writer, s string) error {
+	if len(s) > maxStringLength {
+		return fmt.Errorf("%w: %d > %d", ErrStringTooLong, len(s), maxStringLength)
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(s))); err != nil { //nolint:gosec // G115: s is at most maxStringLength long
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func readString(r io.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length > maxStringLength {
+		return "", fmt.Errorf("%w: %d > %d", ErrStringTooLong, length, maxStringLength)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// writeStatus sends the result of a step to the sender: ok, if err is nil,
+// and the error message otherwise.
+func writeStatus(w io.Writer, err error) error {
+	status, message := statusOK, "ok"
+	if err != nil {
+		status, message = statusError, err.Error()
+	}
+	// Messages are read with readString, which rejects long strings.
+	if len(message) > maxStringLength {
+		message = message[:maxStringLength]
+	}
+	if err := binary.Write(w, binary.BigEndian, status); err != nil {
+		return err
+	}
+	return writeString(w, message)
+}
+
+// readStatus reads a result sent with writeStatus and returns the error
+// message of the receiver, if the step failed.
+func readStatus(r io.Reader) error {
+	var status uint8
+	if err := binary.Read(r, binary.BigEndian, &status); err != nil {
+		return fmt.Errorf("failed to read result from receiver: %w", err)
+	}
+	message, err := readString(r)
+	if err != nil {
+		return fmt.Errorf("failed to read result from receiver: %w", err)
+	}
+	if status != statusOK {
+		return errors.New(message)
+	}
+	return nil
+}
+
+// stopOnCancel closes c when the context is canceled, to abort blocking reads
+// and writes.
+func stopOnCancel(ctx context.Context, c io.Closer) {
+	context.AfterFunc(ctx, func() { _ = c.Close() })
+}
@@ -0,0 +1,166 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTLS returns the server and client TLS configs of a self-signed
+// certificate, which is used by both sides and trusted as CA.
+func testTLS(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "migrate"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	server = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	client = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   "127.0.0.1",
+	}
+	return server, client
+}
+
+func writeDevice(t *testing.T, content []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "device")
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	return path
+}
+
+// startReceiver starts a receiver and returns its address and the channel,
+// which receives the result of Receive.
+func startReceiver(t *testing.T, target string, tlsConfig *tls.Config) (string, <-chan error) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewReceiver(slog.New(slog.DiscardHandler), "secret", tlsConfig).Receive(context.Background(), target, listener)
+	}()
+	return listener.Addr().String(), done
+}
+
+func send(source, addr, token string, tlsConfig *tls.Config) error {
+	sender := NewSender(slog.New(slog.DiscardHandler), token, tlsConfig)
+	sender.chunkSize = 64 * 1024
+	return sender.Send(context.Background(), source, addr)
+}
+
+func TestTransfer(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+
+	// Random data with a zero region and a partial last chunk.
+	content := make([]byte, 300*1024+17)
+	_, err := rand.Read(content[:100*1024])
+	require.NoError(t, err)
+	_, err = rand.Read(content[200*1024:])
+	require.NoError(t, err)
+
+	source := writeDevice(t, content)
+	target := writeDevice(t, bytes.Repeat([]byte{0xff}, len(content)+4096))
+
+	addr, done := startReceiver(t, target, serverTLS)
+	require.NoError(t, send(source, addr, "secret", clientTLS))
+	require.NoError(t, <-done)
+
+	written, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, content, written[:len(content)])
+}
+
+func TestTransferTargetTooSmall(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	source := writeDevice(t, make([]byte, 8192))
+	target := writeDevice(t, make([]byte, 4096))
+
+	addr, done := startReceiver(t, target, serverTLS)
+	sendErr := send(source, addr, "secret", clientTLS)
+	assert.ErrorIs(t, <-done, ErrTargetTooSmall)
+	assert.ErrorContains(t, sendErr, "target device is smaller than source device")
+}
+
+func TestTransferRejectsUnauthenticatedSenders(t *testing.T) {
+	serverTLS, clientTLS := testTLS(t)
+	_, otherClientTLS := testTLS(t)
+
+	content := make([]byte, 8192)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	source := writeDevice(t, content)
+	target := writeDevice(t, make([]byte, 8192))
+
+	addr, done := startReceiver(t, target, serverTLS)
+
+	sendErr := send(source, addr, "wrong", clientTLS)
+	assert.ErrorContains(t, sendErr, ErrUnauthorized.Error())
+
+	// The client certificate is not issued by the CA of the receiver.
+	otherClientTLS.RootCAs = clientTLS.RootCAs
+	assert.Error(t, send(source, addr, "secret", otherClientTLS))
+
+	// The receiver keeps waiting for an authenticated sender.
+	require.NoError(t, send(source, addr, "secret", clientTLS))
+	require.NoError(t, <-done)
+
+	written, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, content, written)
+}
+
+func TestReadStringTooLong(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.BigEndian, uint16(maxStringLength+1)))
+	buf.Write(make([]byte, maxStringLength+1))
+
+	_, err := readString(&buf)
+	assert.ErrorIs(t, err, ErrStringTooLong)
+
+	assert.ErrorIs(t, writeString(&buf, string(make([]byte, maxStringLength+1))), ErrStringTooLong)
+}
@@ -9,15 +9,17 @@ import (
 )
 
 type VolumeService struct {
-	CreateFunc        func(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error)
-	GetServerByIDFunc func(ctx context.Context, id int) (*hcloud.Server, error)
-	AllFunc           func(ctx context.Context) ([]*csi.Volume, error)
-	GetByIDFunc       func(ctx context.Context, id int64) (*csi.Volume, error)
-	GetByNameFunc     func(ctx context.Context, name string) (*csi.Volume, error)
-	DeleteFunc        func(ctx context.Context, volume *csi.Volume) error
-	AttachFunc        func(ctx context.Context, volume *csi.Volume, server *csi.Server) error
-	DetachFunc        func(ctx context.Context, volume *csi.Volume, server *csi.Server) error
-	ResizeFunc        func(ctx context.Context, volume *csi.Volume, size int) error
+	CreateFunc                func(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error)
+	GetServerByIDFunc         func(ctx context.Context, id int) (*hcloud.Server, error)
+	AllFunc                   func(ctx context.Context) ([]*csi.Volume, error)
+	GetByIDFunc               func(ctx context.Context, id int64) (*csi.Volume, error)
+	GetByNameFunc             func(ctx context.Context, name string) (*csi.Volume, error)
+	DeleteFunc                func(ctx context.Context, volume *csi.Volume) error
+	AttachFunc                func(ctx context.Context, volume *csi.Volume, server *csi.Server) error
+	DetachFunc                func(ctx context.Context, volume *csi.Volume, server *csi.Server) error
+	ResizeFunc                func(ctx context.Context, volume *csi.Volume, size int) error
+	UpdateLabelsFunc          func(ctx context.Context, volume *csi.Volume, labels map[string]string) error
+	CreateMigrationTargetFunc func(ctx context.Context, volume *csi.Volume, location string) (*csi.Volume, error)
 }
 
 func (s *VolumeService) All(ctx context.Context) ([]*csi.Volume, error) {
@@ -76,6 +78,20 @@ func (s *VolumeService) Resize(ctx context.Context, volume *csi.Volume, size int
 	return s.ResizeFunc(ctx, volume, size)
 }
 
+func (s *VolumeService) UpdateLabels(ctx context.Context, volume *csi.Volume, labels map[string]string) error {
+	if s.UpdateLabelsFunc == nil {
+		panic("not implemented")
+	}
+	return s.UpdateLabelsFunc(ctx, volume, labels)
+}
+
+func (s *VolumeService) CreateMigrationTarget(ctx context.Context, volume *csi.Volume, location string) (*csi.Volume, error) {
+	if s.CreateMigrationTargetFunc == nil {
+		panic("not implemented")
+	}
+	return s.CreateMigrationTargetFunc(ctx, volume, location)
+}
+
 type VolumeMountService struct {
 	PublishFunc    func(ctx context.Context, targetPath string, devicePath string, opts volumes.MountOpts) error
 	UnpublishFunc  func(ctx context.Context, targetPath string) error
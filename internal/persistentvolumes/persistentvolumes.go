@@ -0,0 +1,85 @@
+// Package persistentvolumes recovers the CreateVolume parameters of existing
+// volumes from the Kubernetes PersistentVolumes of the driver.
+package persistentvolumes
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The parameters, which the external-provisioner adds with
+// --extra-create-metadata.
+const (
+	parameterKeyPVCName      = "csi.storage.k8s.io/pvc/name"
+	parameterKeyPVCNamespace = "csi.storage.k8s.io/pvc/namespace"
+	parameterKeyPVName       = "csi.storage.k8s.io/pv/name"
+)
+
+// ParameterSource recovers the parameters of a volume from its
+// PersistentVolume: the parameters of the StorageClass, and the names of the
+// PersistentVolume and the PersistentVolumeClaim it is currently bound to, so
+// a renamed or restored claim is reflected.
+type ParameterSource struct {
+	client     kubernetes.Interface
+	driverName string
+}
+
+func NewParameterSource(client kubernetes.Interface, driverName string) *ParameterSource {
+	return &ParameterSource{
+		client:     client,
+		driverName: driverName,
+	}
+}
+
+// VolumeParameters returns the parameters of all PersistentVolumes of the
+// driver by their volume handle.
+func (s *ParameterSource) VolumeParameters(ctx context.Context) (map[string]map[string]string, error) {
+	pvs, err := s.client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes: %w", err)
+	}
+
+	// The StorageClasses are shared by many volumes, so each one is only
+	// fetched once. A deleted StorageClass is stored as nil.
+	storageClasses := make(map[string]*storagev1.StorageClass)
+
+	parameters := make(map[string]map[string]string)
+	for _, pv := range pvs.Items {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != s.driverName {
+			continue
+		}
+
+		volumeParameters := make(map[string]string)
+		if name := pv.Spec.StorageClassName; name != "" {
+			storageClass, ok := storageClasses[name]
+			if !ok {
+				storageClass, err = s.client.StorageV1().StorageClasses().Get(ctx, name, metav1.GetOptions{})
+				if apierrors.IsNotFound(err) {
+					storageClass, err = nil, nil
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to get storage class %s: %w", name, err)
+				}
+				storageClasses[name] = storageClass
+			}
+			if storageClass != nil {
+				maps.Copy(volumeParameters, storageClass.Parameters)
+			}
+		}
+
+		volumeParameters[parameterKeyPVName] = pv.Name
+		if claimRef := pv.Spec.ClaimRef; claimRef != nil {
+			volumeParameters[parameterKeyPVCName] = claimRef.Name
+			volumeParameters[parameterKeyPVCNamespace] = claimRef.Namespace
+		}
+
+		parameters[pv.Spec.CSI.VolumeHandle] = volumeParameters
+	}
+	return parameters, nil
+}
@@ -0,0 +1,57 @@
+package persistentvolumes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newPersistentVolume(name, driver, handle, storageClass string, claimRef *corev1.ObjectReference) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: handle},
+			},
+			StorageClassName: storageClass,
+			ClaimRef:         claimRef,
+		},
+	}
+}
+
+func TestVolumeParameters(t *testing.T) {
+	client := fake.NewClientset(
+		&storagev1.StorageClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "hcloud-volumes"},
+			Parameters: map[string]string{"labels": "team=storage"},
+		},
+		// Restored and bound to a claim with another name.
+		newPersistentVolume("pvc-1", "csi.hetzner.cloud", "1", "hcloud-volumes",
+			&corev1.ObjectReference{Namespace: "restored", Name: "data-restored"}),
+		// The StorageClass was deleted.
+		newPersistentVolume("pvc-2", "csi.hetzner.cloud", "team-a/2", "deleted", nil),
+		newPersistentVolume("pvc-3", "other.csi.driver", "3", "hcloud-volumes", nil),
+	)
+
+	source := NewParameterSource(client, "csi.hetzner.cloud")
+	parameters, err := source.VolumeParameters(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]map[string]string{
+		"1": {
+			"labels":                 "team=storage",
+			parameterKeyPVName:       "pvc-1",
+			parameterKeyPVCName:      "data-restored",
+			parameterKeyPVCNamespace: "restored",
+		},
+		"team-a/2": {
+			parameterKeyPVName: "pvc-2",
+		},
+	}, parameters)
+}
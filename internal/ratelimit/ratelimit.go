@@ -0,0 +1,204 @@
+// Package ratelimit keeps track of the rate limit budget of the hcloud API and
+// delays non-urgent requests when the budget is low, to keep budget available
+// for urgent requests, like attaching and detaching volumes.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Priority is the priority of an API request.
+type Priority int
+
+const (
+	// PriorityNormal is the priority of requests without an explicit priority.
+	PriorityNormal Priority = iota
+	// PriorityLow is the priority of background work, which can be delayed
+	// for a long time, e.g. reconcilers and listing volumes.
+	PriorityLow
+	// PriorityUrgent is the priority of requests blocking workloads, e.g.
+	// attaching and detaching volumes. They are never delayed.
+	PriorityUrgent
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityUrgent:
+		return "urgent"
+	default:
+		return "normal"
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context, in which API requests have the given priority.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFromContext returns the priority of API requests in the context.
+func PriorityFromContext(ctx context.Context) Priority {
+	priority, _ := ctx.Value(priorityKey{}).(Priority)
+	return priority
+}
+
+const (
+	// DefaultLowThreshold is the fraction of the rate limit, below which
+	// requests with low priority are delayed.
+	DefaultLowThreshold = 0.5
+	// DefaultNormalThreshold is the fraction of the rate limit, below which
+	// requests with normal priority are delayed. The remaining budget is
+	// reserved for urgent requests.
+	DefaultNormalThreshold = 0.1
+)
+
+// Observer is notified about the rate limit budget and delayed requests.
+type Observer interface {
+	ObserveRateLimit(limit, remaining int)
+	ObserveRateLimitDelay(priority string)
+}
+
+// Governor keeps track of the rate limit budget, based on the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers of the API responses.
+type Governor struct {
+	logger          *slog.Logger
+	observer        Observer
+	lowThreshold    float64
+	normalThreshold float64
+
+	mu         sync.Mutex
+	known      bool
+	limit      int
+	remaining  int
+	reset      time.Time
+	observedAt time.Time
+}
+
+func NewGovernor(logger *slog.Logger, observer Observer) *Governor {
+	return &Governor{
+		logger:          logger,
+		observer:        observer,
+		lowThreshold:    DefaultLowThreshold,
+		normalThreshold: DefaultNormalThreshold,
+	}
+}
+
+// Transport wraps the http.RoundTripper, to delay requests when the budget is
+// low and to track the budget from the responses.
+func (g *Governor) Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{governor: g, next: next}
+}
+
+type transport struct {
+	governor *Governor
+	next     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.governor.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.governor.Observe(resp.Header, time.Now())
+	}
+	return resp, err
+}
+
+// Wait blocks until a request with the priority of the context may be sent.
+func (g *Governor) Wait(ctx context.Context) error {
+	priority := PriorityFromContext(ctx)
+
+	delay := g.delay(priority, time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	g.logger.Debug(
+		"rate limit budget is low, delaying request",
+		"priority", priority.String(),
+		"delay", delay,
+	)
+	if g.observer != nil {
+		g.observer.ObserveRateLimitDelay(priority.String())
+	}
+
+	for delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		delay = g.delay(priority, time.Now())
+	}
+	return nil
+}
+
+// Observe updates the budget from the headers of an API response.
+func (g *Governor) Observe(header http.Header, now time.Time) {
+	limit, err := strconv.Atoi(header.Get("RateLimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get("RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	g.mu.Lock()
+	g.known = true
+	g.limit = limit
+	g.remaining = remaining
+	g.reset = time.Unix(reset, 0)
+	g.observedAt = now
+	g.mu.Unlock()
+
+	if g.observer != nil {
+		g.observer.ObserveRateLimit(limit, remaining)
+	}
+}
+
+// delay returns how long a request with the priority has to wait, until the
+// budget refilled above the threshold of the priority.
+func (g *Governor) delay(priority Priority, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.known || priority == PriorityUrgent || !now.Before(g.reset) {
+		return 0
+	}
+
+	fraction := g.normalThreshold
+	if priority == PriorityLow {
+		fraction = g.lowThreshold
+	}
+	threshold := float64(g.limit) * fraction
+
+	// The budget refills linearly until it is full at the reset time.
+	refillRate := float64(g.limit-g.remaining) / g.reset.Sub(g.observedAt).Seconds()
+	remaining := float64(g.remaining) + refillRate*now.Sub(g.observedAt).Seconds()
+	if remaining > threshold {
+		return 0
+	}
+	if refillRate <= 0 {
+		return g.reset.Sub(now)
+	}
+
+	delay := time.Duration((threshold - remaining + 1) / refillRate * float64(time.Second))
+	return min(delay, g.reset.Sub(now))
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rateLimitHeader(limit, remaining int, reset time.Time) http.Header {
+	header := http.Header{}
+	header.Set("RateLimit-Limit", strconv.Itoa(limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return header
+}
+
+type testObserver struct {
+	limit, remaining int
+	delayed          map[string]int
+}
+
+func (o *testObserver) ObserveRateLimit(limit, remaining int) {
+	o.limit, o.remaining = limit, remaining
+}
+
+func (o *testObserver) ObserveRateLimitDelay(priority string) {
+	o.delayed[priority]++
+}
+
+func TestGovernorDelay(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	testCases := []struct {
+		name      string
+		header    http.Header
+		priority  Priority
+		wantDelay time.Duration
+	}{
+		{
+			name:      "unknown budget",
+			header:    http.Header{},
+			priority:  PriorityLow,
+			wantDelay: 0,
+		},
+		{
+			name:      "full budget",
+			header:    rateLimitHeader(3600, 3600, now),
+			priority:  PriorityLow,
+			wantDelay: 0,
+		},
+		{
+			name:      "low priority above threshold",
+			header:    rateLimitHeader(3600, 2000, now.Add(1600*time.Second)),
+			priority:  PriorityLow,
+			wantDelay: 0,
+		},
+		{
+			name:      "low priority below threshold",
+			header:    rateLimitHeader(3600, 1000, now.Add(2600*time.Second)),
+			priority:  PriorityLow,
+			wantDelay: 801 * time.Second,
+		},
+		{
+			name:      "normal priority below low threshold",
+			header:    rateLimitHeader(3600, 1000, now.Add(2600*time.Second)),
+			priority:  PriorityNormal,
+			wantDelay: 0,
+		},
+		{
+			name:      "normal priority in reserved budget",
+			header:    rateLimitHeader(3600, 100, now.Add(3500*time.Second)),
+			priority:  PriorityNormal,
+			wantDelay: 261 * time.Second,
+		},
+		{
+			name:      "urgent priority in reserved budget",
+			header:    rateLimitHeader(3600, 0, now.Add(3600*time.Second)),
+			priority:  PriorityUrgent,
+			wantDelay: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			governor := NewGovernor(slog.New(slog.DiscardHandler), nil)
+			governor.Observe(tc.header, now)
+
+			assert.Equal(t, tc.wantDelay, governor.delay(tc.priority, now))
+		})
+	}
+}
+
+func TestGovernorDelayRefills(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	governor := NewGovernor(slog.New(slog.DiscardHandler), nil)
+	governor.Observe(rateLimitHeader(3600, 1000, now.Add(2600*time.Second)), now)
+
+	assert.Equal(t, 801*time.Second, governor.delay(PriorityLow, now))
+	assert.Equal(t, 1*time.Second, governor.delay(PriorityLow, now.Add(800*time.Second)))
+	assert.Equal(t, time.Duration(0), governor.delay(PriorityLow, now.Add(801*time.Second)))
+}
+
+func TestTransport(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		for key, values := range rateLimitHeader(3600, 10, reset) {
+			w.Header()[key] = values
+		}
+	}))
+	defer server.Close()
+
+	observer := &testObserver{delayed: map[string]int{}}
+	governor := NewGovernor(slog.New(slog.DiscardHandler), observer)
+	client := &http.Client{Transport: governor.Transport(http.DefaultTransport)}
+
+	do := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// The first request reveals the low budget.
+	require.NoError(t, do(context.Background()))
+	assert.Equal(t, 3600, observer.limit)
+	assert.Equal(t, 10, observer.remaining)
+
+	// Low priority requests are delayed.
+	ctx, cancel := context.WithTimeout(WithPriority(context.Background(), PriorityLow), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, do(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 1, observer.delayed["low"])
+
+	// Urgent requests use the reserved budget.
+	require.NoError(t, do(WithPriority(context.Background(), PriorityUrgent)))
+}
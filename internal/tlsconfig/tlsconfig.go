@@ -0,0 +1,149 @@
+// Package tlsconfig builds TLS configs from PEM files, which are reloaded once
+// they change on disk, e.g. after a certificate was renewed.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Files are the paths of the PEM files of a TLS config.
+type Files struct {
+	CertFile string
+	KeyFile  string
+	// CAFile contains the certificates of the CAs, which are trusted to issue
+	// certificates of the peers. It is optional for servers.
+	CAFile string
+}
+
+// Reloader holds the certificate and CAs loaded from Files. Before every
+// handshake it checks the modification time of the files and reloads them,
+// if they changed. If reloading fails, the previous certificate is kept.
+type Reloader struct {
+	logger *slog.Logger
+	files  Files
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	caPool   *x509.CertPool
+	modTimes [3]time.Time
+}
+
+// NewReloader loads the files and fails, if they are invalid.
+func NewReloader(logger *slog.Logger, files Files) (*Reloader, error) {
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, errors.New("certificate and key file are required")
+	}
+
+	r := &Reloader{logger: logger, files: files}
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTimes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ServerConfig returns a server TLS config, which uses the current certificate
+// and verifies client certificates against the current CAs according to
+// clientAuth. The optional nextProtos are offered for ALPN, e.g. h2 for gRPC.
+func (r *Reloader) ServerConfig(clientAuth tls.ClientAuthType, nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, caPool := r.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    caPool,
+				ClientAuth:   clientAuth,
+				NextProtos:   nextProtos,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns a client TLS config, which presents the current
+// certificate and verifies the certificate of the server against the CAs. The
+// CAs are read once, as clients are expected to be short-lived.
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	_, caPool := r.current()
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		RootCAs:    caPool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+	}
+}
+
+// current returns the certificate and CAs after reloading them, if the files
+// changed.
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, err := r.stat()
+	if err != nil {
+		r.logger.Warn("failed to check TLS files for changes", "err", err)
+	} else if modTimes != r.modTimes {
+		if err := r.load(modTimes); err != nil {
+			r.logger.Error("failed to reload TLS files, keeping the previous certificate", "err", err)
+			// Do not retry on every handshake, until the files change again.
+			r.modTimes = modTimes
+		} else {
+			r.logger.Info("reloaded TLS files", "cert-file", r.files.CertFile)
+		}
+	}
+	return r.cert, r.caPool
+}
+
+func (r *Reloader) stat() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, path := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *Reloader) load(modTimes [3]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	var caPool *x509.CertPool
+	if r.files.CAFile != "" {
+		data, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in CA file %s", r.files.CAFile)
+		}
+	}
+
+	r.cert = &cert
+	r.caPool = caPool
+	r.modTimes = modTimes
+	return nil
+}
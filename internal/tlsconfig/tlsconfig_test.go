@@ -0,0 +1,156 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate and its key with the given
+// common name.
+func writeCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	files := Files{
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+	}
+	start := time.Now().Add(-time.Minute)
+	writeCert(t, files.CertFile, files.KeyFile, "first", start)
+
+	reloader, err := NewReloader(slog.New(slog.DiscardHandler), files)
+	require.NoError(t, err)
+
+	cert, _ := reloader.current()
+	assert.Equal(t, "first", commonName(t, cert))
+
+	t.Run("reloads changed files", func(t *testing.T) {
+		writeCert(t, files.CertFile, files.KeyFile, "second", start.Add(time.Second))
+
+		cert, _ := reloader.current()
+		assert.Equal(t, "second", commonName(t, cert))
+	})
+
+	t.Run("keeps certificate on invalid files", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(files.KeyFile, []byte("invalid"), 0o600))
+
+		cert, _ := reloader.current()
+		assert.Equal(t, "second", commonName(t, cert))
+	})
+}
+
+func TestNewReloaderInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewReloader(slog.New(slog.DiscardHandler), Files{CertFile: filepath.Join(dir, "tls.crt")})
+	require.EqualError(t, err, "certificate and key file are required")
+
+	_, err = NewReloader(slog.New(slog.DiscardHandler), Files{
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+	})
+	require.Error(t, err)
+}
+
+func TestServerConfigMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	files := Files{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+		CAFile:   filepath.Join(dir, "client.crt"),
+	}
+	writeCert(t, files.CertFile, files.KeyFile, "server", time.Now())
+	writeCert(t, files.CAFile, filepath.Join(dir, "client.key"), "client", time.Now())
+
+	reloader, err := NewReloader(slog.New(slog.DiscardHandler), files)
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.ServerConfig(tls.RequireAndVerifyClientCert, "h2"))
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	dial := func(certificates []tls.Certificate) (*tls.Conn, error) {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			Certificates:       certificates,
+			InsecureSkipVerify: true, //nolint:gosec // The server certificate is not under test.
+			NextProtos:         []string{"h2"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The server verifies the client certificate after the client
+		// finished the handshake, so the error is returned by the first read.
+		_, err = conn.Read(make([]byte, 1))
+		return conn, err
+	}
+
+	t.Run("without client certificate", func(t *testing.T) {
+		_, err := dial(nil)
+		require.ErrorContains(t, err, "certificate required")
+	})
+
+	t.Run("with client certificate", func(t *testing.T) {
+		clientCert, err := tls.LoadX509KeyPair(files.CAFile, filepath.Join(dir, "client.key"))
+		require.NoError(t, err)
+
+		conn, err := dial([]tls.Certificate{clientCert})
+		require.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, "h2", conn.ConnectionState().NegotiatedProtocol)
+		conn.Close()
+	})
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/utils/exec"
+)
+
+// Exec wraps the exec interface and starts a span as child of ctx for every
+// command run with it. It is used for libraries like k8s.io/mount-utils, which
+// run commands like mkfs, blkid and fsck without a context.
+func Exec(ctx context.Context, next exec.Interface) exec.Interface {
+	return &tracingExec{Interface: next, ctx: ctx}
+}
+
+// StartCommand starts a span for running the command.
+func StartCommand(ctx context.Context, name string, args ...string) (context.Context, trace.Span) {
+	return Start(ctx, "exec "+filepath.Base(name),
+		attribute.String("process.executable.name", filepath.Base(name)),
+		attribute.String("process.command_args", strings.Join(args, " ")),
+	)
+}
+
+type tracingExec struct {
+	exec.Interface
+	ctx context.Context
+}
+
+func (e *tracingExec) Command(cmd string, args ...string) exec.Cmd {
+	return &tracingCmd{Cmd: e.Interface.Command(cmd, args...), ctx: e.ctx, name: cmd, args: args}
+}
+
+func (e *tracingExec) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return &tracingCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...), ctx: ctx, name: cmd, args: args}
+}
+
+type tracingCmd struct {
+	exec.Cmd
+	ctx  context.Context
+	name string
+	args []string
+	span trace.Span
+}
+
+func (c *tracingCmd) Run() error {
+	_, span := StartCommand(c.ctx, c.name, c.args...)
+	err := c.Cmd.Run()
+	End(span, err)
+	return err
+}
+
+func (c *tracingCmd) CombinedOutput() ([]byte, error) {
+	_, span := StartCommand(c.ctx, c.name, c.args...)
+	output, err := c.Cmd.CombinedOutput()
+	End(span, err)
+	return output, err
+}
+
+func (c *tracingCmd) Output() ([]byte, error) {
+	_, span := StartCommand(c.ctx, c.name, c.args...)
+	output, err := c.Cmd.Output()
+	End(span, err)
+	return output, err
+}
+
+func (c *tracingCmd) Start() error {
+	_, c.span = StartCommand(c.ctx, c.name, c.args...)
+	err := c.Cmd.Start()
+	if err != nil {
+		End(c.span, err)
+		c.span = nil
+	}
+	return err
+}
+
+func (c *tracingCmd) Wait() error {
+	err := c.Cmd.Wait()
+	if c.span != nil {
+		End(c.span, err)
+		c.span = nil
+	}
+	return err
+}
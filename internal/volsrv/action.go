@@ -0,0 +1,198 @@
+package volsrv
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/hetznercloud/csi-driver/internal/ratelimit"
+	"github.com/hetznercloud/csi-driver/internal/tracing"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// actionWatcherBatchSize is the maximum number of action IDs requested at once.
+const actionWatcherBatchSize = 25
+
+type actionResult struct {
+	action *hcloud.Action
+	err    error
+}
+
+// ActionWatcher waits for actions to complete. Instead of polling every action
+// on its own, the IDs of all outstanding actions are batched into a single
+// poll loop, which wakes up the waiting callers once their action completed.
+//
+// The poll loop only runs while callers are waiting. It polls right away when
+// it starts or a caller starts waiting for another action, and then every
+// interval. Callers usually start waiting once their action is expected to
+// be completed, so it is detected without waiting for the next interval. The
+// loop is stopped as soon as the last caller stopped waiting.
+type ActionWatcher struct {
+	logger   *slog.Logger
+	client   *hcloud.Client
+	interval time.Duration
+
+	mu      sync.Mutex
+	waiters map[int64][]chan actionResult
+	// pollNow requests a poll of the running loop before the next interval.
+	pollNow chan struct{}
+	// stop cancels the context of the poll loop. It is nil, if the loop is not
+	// running.
+	stop context.CancelFunc
+}
+
+func NewActionWatcher(logger *slog.Logger, client *hcloud.Client, interval time.Duration) *ActionWatcher {
+	return &ActionWatcher{
+		logger:   logger,
+		client:   client,
+		interval: interval,
+		waiters:  make(map[int64][]chan actionResult),
+		pollNow:  make(chan struct{}, 1),
+	}
+}
+
+// Wait blocks until the action completed or the context is canceled. It returns
+// the completed action, and an error if the action failed.
+func (w *ActionWatcher) Wait(ctx context.Context, action *hcloud.Action) (result *hcloud.Action, err error) {
+	if action.Status != hcloud.ActionStatusRunning {
+		return action, actionError(action)
+	}
+
+	ctx, span := tracing.Start(ctx, "hcloud action wait",
+		attribute.Int64("hcloud.action.id", action.ID),
+		attribute.String("hcloud.action.command", action.Command),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	done := make(chan actionResult, 1)
+
+	w.mu.Lock()
+	w.waiters[action.ID] = append(w.waiters[action.ID], done)
+	if w.stop == nil {
+		var loopCtx context.Context
+		loopCtx, w.stop = context.WithCancel(context.Background())
+		go w.run(loopCtx)
+	} else if len(w.waiters[action.ID]) == 1 {
+		select {
+		case w.pollNow <- struct{}{}:
+		default:
+		}
+	}
+	w.mu.Unlock()
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return result.action, actionError(result.action)
+	case <-ctx.Done():
+		w.remove(action.ID, done)
+		return nil, fmt.Errorf("%w: action %d is still running", ctx.Err(), action.ID)
+	}
+}
+
+func (w *ActionWatcher) remove(id int64, done chan actionResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.waiters[id] = slices.DeleteFunc(w.waiters[id], func(c chan actionResult) bool { return c == done })
+	if len(w.waiters[id]) == 0 {
+		delete(w.waiters, id)
+	}
+	w.stopIfIdle()
+}
+
+// stopIfIdle stops the poll loop, if no caller is waiting anymore. The caller
+// must hold the lock.
+func (w *ActionWatcher) stopIfIdle() {
+	if len(w.waiters) == 0 && w.stop != nil {
+		w.stop()
+		w.stop = nil
+	}
+}
+
+func (w *ActionWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.mu.Lock()
+		ids := slices.Sorted(maps.Keys(w.waiters))
+		w.mu.Unlock()
+
+		for chunk := range slices.Chunk(ids, actionWatcherBatchSize) {
+			w.poll(ctx, chunk)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.pollNow:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *ActionWatcher) poll(ctx context.Context, ids []int64) {
+	// The callers waiting for actions are blocked, so polling is urgent.
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityUrgent)
+	ctx, cancel := context.WithTimeout(ctx, max(w.interval, 10*time.Second))
+	defer cancel()
+
+	actions, err := w.client.Action.AllWithOpts(ctx, hcloud.ActionListOpts{ID: ids})
+	if err != nil {
+		if ctx.Err() != nil {
+			// The loop was stopped, as no caller is waiting anymore.
+			return
+		}
+		// The waiting callers are bound by their context, so we keep polling.
+		w.logger.Info(
+			"failed to poll actions",
+			"action-ids", ids,
+			"err", err,
+		)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	found := make(map[int64]bool, len(actions))
+	for _, action := range actions {
+		found[action.ID] = true
+		if action.Status == hcloud.ActionStatusRunning {
+			continue
+		}
+		w.notify(action.ID, actionResult{action: action})
+	}
+
+	for _, id := range ids {
+		if !found[id] {
+			w.notify(id, actionResult{err: fmt.Errorf("action %d not found", id)})
+		}
+	}
+	w.stopIfIdle()
+}
+
+// notify wakes up all callers waiting for the action. The caller must hold the
+// lock.
+func (w *ActionWatcher) notify(id int64, result actionResult) {
+	for _, done := range w.waiters[id] {
+		done <- result
+	}
+	delete(w.waiters, id)
+}
+
+func actionError(action *hcloud.Action) error {
+	if action.Status == hcloud.ActionStatusError {
+		return action.Error()
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package volsrv
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+// fakeActionAPI serves the actions endpoint of the hcloud API. The statuses of
+// the actions are decided by the resolve func, based on the IDs of the request.
+type fakeActionAPI struct {
+	mu       sync.Mutex
+	requests [][]int64
+	resolve  func(id int64, ids []int64) string
+}
+
+func (f *fakeActionAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.URL.Path != "/actions" {
+		http.NotFound(w, r)
+		return
+	}
+
+	ids := make([]int64, 0)
+	for _, value := range r.URL.Query()["id"] {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, ids)
+	f.mu.Unlock()
+
+	resp := schema.ActionListResponse{Actions: []schema.Action{}}
+	for _, id := range ids {
+		status := f.resolve(id, ids)
+		if status == "" {
+			continue
+		}
+		action := schema.Action{ID: id, Status: status}
+		if status == "error" {
+			action.Error = &schema.ActionError{Code: "action_failed", Message: "Action failed"}
+		}
+		resp.Actions = append(resp.Actions, action)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func makeTestActionWatcher(t *testing.T, api *fakeActionAPI) *ActionWatcher {
+	t.Helper()
+
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client := hcloud.NewClient(
+		hcloud.WithEndpoint(server.URL),
+		hcloud.WithRetryOpts(hcloud.RetryOpts{BackoffFunc: hcloud.ConstantBackoff(0), MaxRetries: 3}),
+	)
+	return NewActionWatcher(slog.New(slog.DiscardHandler), client, 5*time.Millisecond)
+}
+
+func TestActionWatcherBatchesActions(t *testing.T) {
+	api := &fakeActionAPI{
+		// Only complete the actions once they are polled together.
+		resolve: func(_ int64, ids []int64) string {
+			if len(ids) == 3 {
+				return "success"
+			}
+			return "running"
+		},
+	}
+	watcher := makeTestActionWatcher(t, api)
+
+	var wg sync.WaitGroup
+	for id := range int64(3) {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := watcher.Wait(ctx, &hcloud.Action{ID: id + 1, Status: hcloud.ActionStatusRunning})
+			if assert.NoError(t, err) {
+				assert.Equal(t, hcloud.ActionStatusSuccess, result.Status)
+			}
+		})
+	}
+	wg.Wait()
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	assert.True(t, slices.ContainsFunc(api.requests, func(ids []int64) bool {
+		return slices.Equal(ids, []int64{1, 2, 3})
+	}), "expected a single request for all actions, got %v", api.requests)
+}
+
+func TestActionWatcherPollsNewActionRightAway(t *testing.T) {
+	api := &fakeActionAPI{
+		resolve: func(id int64, _ []int64) string {
+			if id == 1 {
+				return "running"
+			}
+			return "success"
+		},
+	}
+	watcher := makeTestActionWatcher(t, api)
+	watcher.interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_, _ = watcher.Wait(ctx, &hcloud.Action{ID: 1, Status: hcloud.ActionStatusRunning})
+	}()
+	require.Eventually(t, func() bool {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		return len(api.requests) == 1
+	}, time.Second, time.Millisecond)
+
+	// The loop is already running, the new action is polled without waiting
+	// for the next interval.
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	_, err := watcher.Wait(waitCtx, &hcloud.Action{ID: 2, Status: hcloud.ActionStatusRunning})
+	require.NoError(t, err)
+}
+
+func TestActionWatcherActionError(t *testing.T) {
+	api := &fakeActionAPI{
+		resolve: func(_ int64, _ []int64) string { return "error" },
+	}
+	watcher := makeTestActionWatcher(t, api)
+
+	_, err := watcher.Wait(context.Background(), &hcloud.Action{ID: 1, Status: hcloud.ActionStatusRunning})
+	var actionErr hcloud.ActionError
+	require.ErrorAs(t, err, &actionErr)
+	assert.Equal(t, "action_failed", actionErr.Code)
+}
+
+func TestActionWatcherActionNotFound(t *testing.T) {
+	api := &fakeActionAPI{
+		resolve: func(_ int64, _ []int64) string { return "" },
+	}
+	watcher := makeTestActionWatcher(t, api)
+
+	_, err := watcher.Wait(context.Background(), &hcloud.Action{ID: 1, Status: hcloud.ActionStatusRunning})
+	assert.EqualError(t, err, "action 1 not found")
+}
+
+func TestActionWatcherCompletedAction(t *testing.T) {
+	api := &fakeActionAPI{}
+	watcher := makeTestActionWatcher(t, api)
+
+	result, err := watcher.Wait(context.Background(), &hcloud.Action{ID: 1, Status: hcloud.ActionStatusSuccess})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.ID)
+	assert.Empty(t, api.requests)
+}
+
+func TestActionWatcherContextCanceled(t *testing.T) {
+	api := &fakeActionAPI{
+		resolve: func(_ int64, _ []int64) string { return "running" },
+	}
+	watcher := makeTestActionWatcher(t, api)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := watcher.Wait(ctx, &hcloud.Action{ID: 1, Status: hcloud.ActionStatusRunning})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The poll loop stops once no caller is waiting anymore.
+	assert.Eventually(t, func() bool {
+		watcher.mu.Lock()
+		defer watcher.mu.Unlock()
+		return watcher.stop == nil
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,60 @@
+package volsrv
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	actionDelayMin = 500 * time.Millisecond
+	actionDelayMax = 10 * time.Second
+
+	// actionDelayWeight is the weight of a new observation in the moving average.
+	actionDelayWeight = 0.2
+	// actionDelayFraction is the fraction of the average duration to wait before
+	// polling the action for the first time.
+	actionDelayFraction = 0.75
+)
+
+// actionDelay estimates how long to wait before polling an action for the
+// first time, based on an exponentially weighted moving average of the
+// durations of previous actions of the same kind.
+type actionDelay struct {
+	mu      sync.Mutex
+	average time.Duration
+}
+
+func newActionDelay(initial time.Duration) *actionDelay {
+	return &actionDelay{average: initial}
+}
+
+// Delay returns the time to wait before polling the action.
+func (d *actionDelay) Delay() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delay := time.Duration(float64(d.average) * actionDelayFraction)
+	return min(max(delay, actionDelayMin), actionDelayMax)
+}
+
+// Observe records the duration of a finished action.
+func (d *actionDelay) Observe(duration time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.average += time.Duration(actionDelayWeight * float64(duration-d.average))
+}
+
+// Wait waits for the current delay or until the context is canceled.
+func (d *actionDelay) Wait(ctx context.Context) error {
+	timer := time.NewTimer(d.Delay())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,28 @@
+package volsrv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionDelay(t *testing.T) {
+	delay := newActionDelay(4 * time.Second)
+	assert.Equal(t, 3*time.Second, delay.Delay())
+
+	for range 20 {
+		delay.Observe(time.Second)
+	}
+	assert.InDelta(t, 750*time.Millisecond, delay.Delay(), float64(50*time.Millisecond))
+
+	for range 20 {
+		delay.Observe(100 * time.Millisecond)
+	}
+	assert.Equal(t, actionDelayMin, delay.Delay())
+
+	for range 50 {
+		delay.Observe(time.Minute)
+	}
+	assert.Equal(t, actionDelayMax, delay.Delay())
+}
@@ -0,0 +1,155 @@
+package volsrv
+
+import (
+	"context"
+	"errors"
+	"maps"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+// The plan* methods implement the mutating calls in dry-run mode. They run the
+// same checks as the real calls against the planned state of the volumes, but
+// record the operation in the plan instead of sending it to the API.
+
+func (s *VolumeService) planCreate(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error) {
+	if _, err := s.GetByName(ctx, opts.Name); err == nil {
+		return nil, volumes.ErrVolumeAlreadyExists
+	} else if !errors.Is(err, volumes.ErrVolumeNotFound) {
+		return nil, err
+	}
+
+	volume := s.plan.create(opts)
+	s.logger.Info(
+		"dry run: would create volume",
+		"volume-id", volume.ID,
+		"volume-name", volume.Name,
+		"volume-size", volume.Size,
+		"volume-location", volume.Location,
+	)
+	return volume, nil
+}
+
+func (s *VolumeService) planDelete(ctx context.Context, volume *csi.Volume) error {
+	current, err := s.GetByID(ctx, volume.ID)
+	if err != nil {
+		return err
+	}
+	if current.Server != nil {
+		return volumes.ErrAttached
+	}
+
+	s.plan.delete(current)
+	s.logger.Info(
+		"dry run: would delete volume",
+		"volume-id", volume.ID,
+	)
+	return nil
+}
+
+func (s *VolumeService) planAttach(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+	current, err := s.GetByID(ctx, volume.ID)
+	if err != nil {
+		return err
+	}
+
+	hcloudServer, _, err := s.client.Server.GetByID(ctx, server.ID)
+	if err != nil {
+		return err
+	}
+	if hcloudServer == nil {
+		return volumes.ErrServerNotFound
+	}
+
+	if current.Server != nil {
+		if current.Server.ID == server.ID {
+			*volume = *current
+			return nil
+		}
+		return volumes.ErrAttached
+	}
+
+	s.plan.update(
+		PlannedOperation{Operation: "attach", VolumeID: volume.ID, ServerID: server.ID},
+		current,
+		func(v *csi.Volume) { v.Server = &csi.Server{ID: server.ID} },
+	)
+	*volume = *current
+	volume.Server = &csi.Server{ID: server.ID}
+	s.logger.Info(
+		"dry run: would attach volume",
+		"volume-id", volume.ID,
+		"server-id", server.ID,
+	)
+	return nil
+}
+
+func (s *VolumeService) planDetach(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+	current, err := s.GetByID(ctx, volume.ID)
+	if err != nil {
+		return err
+	}
+	if current.Server == nil {
+		return volumes.ErrNotAttached
+	}
+	if server != nil && current.Server.ID != server.ID {
+		return volumes.ErrAttached
+	}
+
+	s.plan.update(
+		PlannedOperation{Operation: "detach", VolumeID: volume.ID, ServerID: current.Server.ID},
+		current,
+		func(v *csi.Volume) { v.Server = nil },
+	)
+	s.logger.Info(
+		"dry run: would detach volume",
+		"volume-id", volume.ID,
+		"server-id", current.Server.ID,
+	)
+	return nil
+}
+
+func (s *VolumeService) planResize(ctx context.Context, volume *csi.Volume, size int) error {
+	current, err := s.GetByID(ctx, volume.ID)
+	if err != nil {
+		return err
+	}
+	if current.Size >= size {
+		return volumes.ErrVolumeSizeAlreadyReached
+	}
+
+	s.plan.update(
+		PlannedOperation{Operation: "resize", VolumeID: volume.ID, Size: size},
+		current,
+		func(v *csi.Volume) { v.Size = size },
+	)
+	*volume = *current
+	volume.Size = size
+	s.logger.Info(
+		"dry run: would resize volume",
+		"volume-id", volume.ID,
+		"current-size", current.Size,
+		"requested-size", size,
+	)
+	return nil
+}
+
+func (s *VolumeService) planUpdateLabels(ctx context.Context, volume *csi.Volume, labels map[string]string) error {
+	current, err := s.GetByID(ctx, volume.ID)
+	if err != nil {
+		return err
+	}
+
+	s.plan.update(
+		PlannedOperation{Operation: "update_labels", VolumeID: volume.ID, Labels: maps.Clone(labels)},
+		current,
+		func(v *csi.Volume) { v.Labels = maps.Clone(labels) },
+	)
+	s.logger.Info(
+		"dry run: would update volume labels",
+		"volume-id", volume.ID,
+		"labels", labels,
+	)
+	return nil
+}
@@ -0,0 +1,99 @@
+package volsrv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	// Only reads are sent to the API.
+	volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+		{
+			Method: "GET", Path: "/volumes?name=pvc-123",
+			Status: 200,
+			JSON:   schema.VolumeListResponse{Volumes: []schema.Volume{}},
+		},
+		{
+			Method: "GET", Path: "/servers/2",
+			Status: 200,
+			JSON:   schema.ServerGetResponse{Server: schema.Server{ID: 2}},
+		},
+		{
+			Method: "GET", Path: "/volumes?page=1&per_page=50",
+			Status: 200,
+			JSON: schema.VolumeListResponse{
+				Volumes: []schema.Volume{{ID: 1, Name: "pvc-existing", Size: 10}},
+			},
+		},
+	})
+	defer cleanup()
+
+	plan := NewPlan()
+	volumeService.plan = plan
+
+	volume, err := volumeService.Create(ctx, volumes.CreateOpts{Name: "pvc-123", MinSize: 10, Location: "fsn1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(syntheticVolumeIDBase), volume.ID)
+	assert.Equal(t, fmt.Sprintf("/dev/disk/by-id/scsi-0HC_Volume_%d", volume.ID), volume.LinuxDevice)
+
+	_, err = volumeService.Create(ctx, volumes.CreateOpts{Name: "pvc-123", MinSize: 10, Location: "fsn1"})
+	assert.Equal(t, volumes.ErrVolumeAlreadyExists, err)
+
+	require.NoError(t, volumeService.Attach(ctx, volume, &csi.Server{ID: 2}))
+
+	volume, err = volumeService.GetByName(ctx, "pvc-123")
+	require.NoError(t, err)
+	require.NotNil(t, volume.Server)
+	assert.Equal(t, int64(2), volume.Server.ID)
+
+	assert.Equal(t, volumes.ErrAttached, volumeService.Delete(ctx, volume))
+	require.NoError(t, volumeService.Resize(ctx, volume, 20))
+	require.NoError(t, volumeService.Detach(ctx, volume, nil))
+	assert.Equal(t, volumes.ErrNotAttached, volumeService.Detach(ctx, volume, nil))
+
+	all, err := volumeService.All(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, 20, all[1].Size)
+
+	require.NoError(t, volumeService.Delete(ctx, volume))
+	_, err = volumeService.GetByID(ctx, volume.ID)
+	assert.Equal(t, volumes.ErrVolumeNotFound, err)
+
+	operations := make([]string, 0)
+	for _, op := range plan.Operations() {
+		operations = append(operations, op.Operation)
+	}
+	assert.Equal(t, []string{"create", "attach", "resize", "detach", "delete"}, operations)
+}
+
+func TestPlanServeHTTP(t *testing.T) {
+	plan := NewPlan()
+	plan.create(volumes.CreateOpts{Name: "pvc-123", MinSize: 10, Location: "fsn1"})
+
+	recorder := httptest.NewRecorder()
+	plan.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/plan", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var body struct {
+		Operations []PlannedOperation `json:"operations"`
+	}
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+	require.Len(t, body.Operations, 1)
+	assert.Equal(t, "create", body.Operations[0].Operation)
+	assert.Equal(t, "pvc-123", body.Operations[0].VolumeName)
+}
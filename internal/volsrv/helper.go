@@ -1,18 +1,24 @@
 package volsrv
 
 import (
+	"strings"
+
 	"github.com/hetznercloud/csi-driver/internal/csi"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
 
+const maxVolumeNameLength = 63
+
 func toDomainVolume(hcloudVolume *hcloud.Volume) *csi.Volume {
 	return &csi.Volume{
 		ID:          hcloudVolume.ID,
 		Name:        hcloudVolume.Name,
 		Size:        hcloudVolume.Size,
 		Location:    hcloudVolume.Location.Name,
+		NetworkZone: string(hcloudVolume.Location.NetworkZone),
 		LinuxDevice: hcloudVolume.LinuxDevice,
 		Server:      toDomainServer(hcloudVolume.Server),
+		Labels:      hcloudVolume.Labels,
 	}
 }
 
@@ -24,3 +30,13 @@ func toDomainServer(hcloudServer *hcloud.Server) *csi.Server {
 		ID: hcloudServer.ID,
 	}
 }
+
+// migrationTargetName appends the location to the volume name, truncating the
+// volume name to keep the result within the allowed length.
+func migrationTargetName(name string, location string) string {
+	suffix := "-" + location
+	if len(name)+len(suffix) > maxVolumeNameLength {
+		name = strings.TrimRight(name[:maxVolumeNameLength-len(suffix)], "-._")
+	}
+	return name + suffix
+}
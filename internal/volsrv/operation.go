@@ -0,0 +1,90 @@
+package volsrv
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/audit"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// Observer records metrics of the volume operations.
+type Observer interface {
+	// ObserveVolumeOperation records the duration of an operation, split into
+	// the time spent on the API request and on waiting for the action.
+	ObserveVolumeOperation(operation, result string, api, actionWait time.Duration)
+	// ObserveVolumeOperationError records an operation, which failed because
+	// the server was locked or the attach limit was reached.
+	ObserveVolumeOperationError(operation, reason string)
+}
+
+// operation tracks a mutating call to the API. Once it finished, it is
+// recorded in the audit log and the metrics.
+type operation struct {
+	event audit.Event
+	start time.Time
+	// waitStart is set, once the API request returned and the action is
+	// awaited.
+	waitStart time.Time
+}
+
+func startOperation(event audit.Event) *operation {
+	return &operation{event: event, start: time.Now()}
+}
+
+// waiting marks the end of the API request and the start of waiting for the
+// action.
+func (o *operation) waiting() {
+	o.waitStart = time.Now()
+}
+
+// finishOperation completes the event with the outcome of the operation and
+// records it in the audit log and the metrics.
+func (s *VolumeService) finishOperation(ctx context.Context, op *operation, action *hcloud.Action, err error) {
+	now := time.Now()
+	event := op.event
+
+	event.DurationSeconds = now.Sub(op.start).Seconds()
+	if action != nil {
+		event.ActionID = action.ID
+	}
+	if err != nil {
+		event.Result = audit.ResultFailure
+		event.Error = err.Error()
+		event.After = nil
+	} else {
+		event.Result = audit.ResultSuccess
+	}
+	s.auditLog.Record(ctx, event)
+
+	if s.observer == nil {
+		return
+	}
+	apiDuration, waitDuration := now.Sub(op.start), time.Duration(0)
+	if !op.waitStart.IsZero() {
+		apiDuration, waitDuration = op.waitStart.Sub(op.start), now.Sub(op.waitStart)
+	}
+	s.observer.ObserveVolumeOperation(event.Operation, event.Result, apiDuration, waitDuration)
+
+	switch {
+	case hcloud.IsError(err, hcloud.ErrorCodeLocked):
+		s.observer.ObserveVolumeOperationError(event.Operation, "locked_server")
+	case hcloud.IsError(err, hcloud.ErrorCode("limit_exceeded_error")):
+		s.observer.ObserveVolumeOperationError(event.Operation, "attach_limit_reached")
+	}
+}
+
+func auditVolumeState(volume *hcloud.Volume) *audit.VolumeState {
+	state := &audit.VolumeState{
+		Size:   volume.Size,
+		Labels: maps.Clone(volume.Labels),
+	}
+	if volume.Location != nil {
+		state.Location = volume.Location.Name
+	}
+	if volume.Server != nil {
+		state.ServerID = volume.Server.ID
+	}
+	return state
+}
@@ -0,0 +1,187 @@
+package volsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+const (
+	// syntheticVolumeIDBase is the first ID of volumes created in dry-run mode,
+	// far above the IDs of real volumes.
+	syntheticVolumeIDBase = 1 << 48
+
+	// maxPlannedOperations is the number of operations kept in a plan, older
+	// operations are dropped.
+	maxPlannedOperations = 1000
+)
+
+// PlannedOperation is an operation, which the [VolumeService] would have sent
+// to the API, if it was not in dry-run mode.
+type PlannedOperation struct {
+	Time       time.Time         `json:"time"`
+	Operation  string            `json:"operation"`
+	VolumeID   int64             `json:"volume_id,omitempty"`
+	VolumeName string            `json:"volume_name,omitempty"`
+	ServerID   int64             `json:"server_id,omitempty"`
+	Size       int               `json:"size,omitempty"`
+	Location   string            `json:"location,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// Plan records the operations of a [VolumeService] in dry-run mode. It also
+// keeps the volumes as they would be after the planned operations, so that
+// later lookups and CSI flows see the planned state instead of the real one.
+//
+// Plan implements [http.Handler] and serves the planned operations as JSON.
+type Plan struct {
+	mu         sync.Mutex
+	operations []PlannedOperation
+	volumes    map[int64]*csi.Volume
+	deleted    map[int64]bool
+	nextID     int64
+}
+
+func NewPlan() *Plan {
+	return &Plan{
+		volumes: make(map[int64]*csi.Volume),
+		deleted: make(map[int64]bool),
+		nextID:  syntheticVolumeIDBase,
+	}
+}
+
+// Operations returns the planned operations, oldest first.
+func (p *Plan) Operations() []PlannedOperation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.operations)
+}
+
+func (p *Plan) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		Operations []PlannedOperation `json:"operations"`
+	}{Operations: p.Operations()})
+}
+
+// create records the creation of a volume and returns the synthetic volume.
+func (p *Plan) create(opts volumes.CreateOpts) *csi.Volume {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	volume := &csi.Volume{
+		ID:       p.nextID,
+		Name:     opts.Name,
+		Size:     opts.MinSize,
+		Location: opts.Location,
+		// The device path of real volumes, so a planned publish returns the
+		// same publish context.
+		LinuxDevice: fmt.Sprintf("/dev/disk/by-id/scsi-0HC_Volume_%d", p.nextID),
+		Labels:      maps.Clone(opts.Labels),
+	}
+	p.nextID++
+	p.volumes[volume.ID] = volume
+
+	p.record(PlannedOperation{
+		Operation:  "create",
+		VolumeID:   volume.ID,
+		VolumeName: volume.Name,
+		Size:       volume.Size,
+		Location:   volume.Location,
+		Labels:     maps.Clone(volume.Labels),
+	})
+	return volume.Copy()
+}
+
+// update records an operation, which changes the given volume.
+func (p *Plan) update(op PlannedOperation, volume *csi.Volume, mutate func(v *csi.Volume)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	updated := volume.Copy()
+	mutate(updated)
+	p.volumes[volume.ID] = updated
+	p.record(op)
+}
+
+// delete records the deletion of the volume.
+func (p *Plan) delete(volume *csi.Volume) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.volumes, volume.ID)
+	p.deleted[volume.ID] = true
+	p.record(PlannedOperation{Operation: "delete", VolumeID: volume.ID, VolumeName: volume.Name})
+}
+
+func (p *Plan) record(op PlannedOperation) {
+	op.Time = time.Now()
+	if len(p.operations) >= maxPlannedOperations {
+		p.operations = slices.Delete(p.operations, 0, 1)
+	}
+	p.operations = append(p.operations, op)
+}
+
+// lookup returns the planned state of the volume. It returns false, if the
+// plan does not affect the volume, and a nil volume if it was deleted.
+func (p *Plan) lookup(id int64) (*csi.Volume, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.deleted[id] {
+		return nil, true
+	}
+	if volume, ok := p.volumes[id]; ok {
+		return volume.Copy(), true
+	}
+	return nil, false
+}
+
+// lookupName returns the planned state of the volume with the given name, if
+// the plan affects it.
+func (p *Plan) lookupName(name string) (*csi.Volume, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, volume := range p.volumes {
+		if volume.Name == name {
+			return volume.Copy(), true
+		}
+	}
+	return nil, false
+}
+
+// overlay applies the plan to volumes returned by the API and adds the
+// volumes created by the plan.
+func (p *Plan) overlay(apiVolumes []*csi.Volume) []*csi.Volume {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]*csi.Volume, 0, len(apiVolumes))
+	for _, volume := range apiVolumes {
+		if p.deleted[volume.ID] {
+			continue
+		}
+		if planned, ok := p.volumes[volume.ID]; ok {
+			volume = planned.Copy()
+		}
+		result = append(result, volume)
+	}
+	for _, id := range slices.Sorted(maps.Keys(p.volumes)) {
+		if id >= syntheticVolumeIDBase {
+			result = append(result, p.volumes[id].Copy())
+		}
+	}
+	return result
+}
@@ -2,23 +2,55 @@ package volsrv
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"maps"
+	"strconv"
 	"time"
 
+	"github.com/hetznercloud/csi-driver/internal/audit"
 	"github.com/hetznercloud/csi-driver/internal/csi"
 	"github.com/hetznercloud/csi-driver/internal/volumes"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
 
 type VolumeService struct {
-	logger *slog.Logger
-	client *hcloud.Client
+	logger        *slog.Logger
+	client        *hcloud.Client
+	actionWatcher *ActionWatcher
+	attachDelay   *actionDelay
+
+	// plan is set in dry-run mode, mutating calls are recorded in it instead
+	// of being sent to the API.
+	plan *Plan
+
+	auditLog *audit.Logger
+	observer Observer
 }
 
-func NewVolumeService(logger *slog.Logger, client *hcloud.Client) *VolumeService {
+// NewVolumeService creates a VolumeService. If a plan is given, the service
+// runs in dry-run mode: it still reads from the API, but records mutating
+// calls in the plan and returns their expected results. Changes to volumes are
+// recorded in the audit log and the metrics of the observer, which both may be
+// nil.
+func NewVolumeService(
+	logger *slog.Logger,
+	client *hcloud.Client,
+	actionWatcher *ActionWatcher,
+	plan *Plan,
+	auditLog *audit.Logger,
+	observer Observer,
+) *VolumeService {
 	return &VolumeService{
-		logger: logger,
-		client: client,
+		logger:        logger,
+		client:        client,
+		actionWatcher: actionWatcher,
+		plan:          plan,
+		auditLog:      auditLog,
+		observer:      observer,
+		// Attaching a volume takes a few seconds, so we wait before polling
+		// the action status. The delay adapts to the observed durations.
+		attachDelay: newActionDelay(4 * time.Second),
 	}
 }
 
@@ -33,13 +65,20 @@ func (s *VolumeService) All(ctx context.Context) ([]*csi.Volume, error) {
 	}
 
 	volumes := make([]*csi.Volume, 0, len(hcloudVolumes))
-	for i, hcloudVolume := range hcloudVolumes {
-		volumes[i] = toDomainVolume(hcloudVolume)
+	for _, hcloudVolume := range hcloudVolumes {
+		volumes = append(volumes, toDomainVolume(hcloudVolume))
+	}
+	if s.plan != nil {
+		volumes = s.plan.overlay(volumes)
 	}
 	return volumes, nil
 }
 
 func (s *VolumeService) Create(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error) {
+	if s.plan != nil {
+		return s.planCreate(ctx, opts)
+	}
+
 	s.logger.Info(
 		"creating volume",
 		"volume-name", opts.Name,
@@ -47,6 +86,9 @@ func (s *VolumeService) Create(ctx context.Context, opts volumes.CreateOpts) (*c
 		"volume-location", opts.Location,
 	)
 
+	event := audit.Event{Operation: "create", VolumeName: opts.Name}
+	op := startOperation(event)
+
 	result, _, err := s.client.Volume.Create(ctx, hcloud.VolumeCreateOpts{
 		Name:     opts.Name,
 		Size:     opts.MinSize,
@@ -55,6 +97,7 @@ func (s *VolumeService) Create(ctx context.Context, opts volumes.CreateOpts) (*c
 	})
 
 	if err != nil {
+		s.finishOperation(ctx, op, nil, err)
 		s.logger.Info(
 			"failed to create volume",
 			"volume-name", opts.Name,
@@ -63,10 +106,16 @@ func (s *VolumeService) Create(ctx context.Context, opts volumes.CreateOpts) (*c
 		if hcloud.IsError(err, hcloud.ErrorCode("uniqueness_error")) {
 			return nil, volumes.ErrVolumeAlreadyExists
 		}
+		if hcloud.IsError(err, hcloud.ErrorCodeResourceUnavailable, hcloud.ErrorCodeNoSpaceLeftInLocation) {
+			return nil, volumes.ErrResourceUnavailable
+		}
 		return nil, err
 	}
 
-	if err := s.client.Action.WaitFor(ctx, result.Action); err != nil {
+	op.event.VolumeID = result.Volume.ID
+	op.waiting()
+	if _, err := s.actionWatcher.Wait(ctx, result.Action); err != nil {
+		s.finishOperation(ctx, op, result.Action, err)
 		s.logger.Info(
 			"failed to create volume",
 			"volume-name", opts.Name,
@@ -76,10 +125,22 @@ func (s *VolumeService) Create(ctx context.Context, opts volumes.CreateOpts) (*c
 		return nil, err
 	}
 
+	op.event.After = auditVolumeState(result.Volume)
+	s.finishOperation(ctx, op, result.Action, nil)
+
 	return toDomainVolume(result.Volume), nil
 }
 
 func (s *VolumeService) GetByID(ctx context.Context, id int64) (*csi.Volume, error) {
+	if s.plan != nil {
+		if volume, ok := s.plan.lookup(id); ok {
+			if volume == nil {
+				return nil, volumes.ErrVolumeNotFound
+			}
+			return volume, nil
+		}
+	}
+
 	hcloudVolume, _, err := s.client.Volume.GetByID(ctx, id)
 	if err != nil {
 		s.logger.Info(
@@ -100,6 +161,12 @@ func (s *VolumeService) GetByID(ctx context.Context, id int64) (*csi.Volume, err
 }
 
 func (s *VolumeService) GetByName(ctx context.Context, name string) (*csi.Volume, error) {
+	if s.plan != nil {
+		if volume, ok := s.plan.lookupName(name); ok {
+			return volume, nil
+		}
+	}
+
 	hcloudVolume, _, err := s.client.Volume.GetByName(ctx, name)
 	if err != nil {
 		s.logger.Info(
@@ -116,10 +183,20 @@ func (s *VolumeService) GetByName(ctx context.Context, name string) (*csi.Volume
 		)
 		return nil, volumes.ErrVolumeNotFound
 	}
+	if s.plan != nil {
+		// The volume might have been deleted by the plan.
+		if _, ok := s.plan.lookup(hcloudVolume.ID); ok {
+			return nil, volumes.ErrVolumeNotFound
+		}
+	}
 	return toDomainVolume(hcloudVolume), nil
 }
 
 func (s *VolumeService) Delete(ctx context.Context, volume *csi.Volume) error {
+	if s.plan != nil {
+		return s.planDelete(ctx, volume)
+	}
+
 	s.logger.Info(
 		"deleting volume",
 		"volume-id", volume.ID,
@@ -150,7 +227,17 @@ func (s *VolumeService) Delete(ctx context.Context, volume *csi.Volume) error {
 		return volumes.ErrAttached
 	}
 
-	if _, err := s.client.Volume.Delete(ctx, hcloudVolume); err != nil {
+	event := audit.Event{
+		Operation:  "delete",
+		VolumeID:   volume.ID,
+		VolumeName: hcloudVolume.Name,
+		Before:     auditVolumeState(hcloudVolume),
+	}
+	op := startOperation(event)
+
+	_, err = s.client.Volume.Delete(ctx, hcloudVolume)
+	s.finishOperation(ctx, op, nil, err)
+	if err != nil {
 		s.logger.Info(
 			"failed to delete volume",
 			"volume-id", volume.ID,
@@ -170,6 +257,10 @@ func (s *VolumeService) Delete(ctx context.Context, volume *csi.Volume) error {
 }
 
 func (s *VolumeService) Attach(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+	if s.plan != nil {
+		return s.planAttach(ctx, volume, server)
+	}
+
 	s.logger.Info(
 		"attaching volume",
 		"volume-id", volume.ID,
@@ -193,32 +284,14 @@ func (s *VolumeService) Attach(ctx context.Context, volume *csi.Volume, server *
 		return volumes.ErrVolumeNotFound
 	}
 
-	hcloudServer, _, err := s.client.Server.GetByID(ctx, server.ID)
-	if err != nil {
-		s.logger.Info(
-			"failed to get server",
-			"volume-id", volume.ID,
-			"server-id", server.ID,
-			"err", err,
-		)
-		return err
-	}
-	if hcloudServer == nil {
-		s.logger.Info(
-			"server to attach volume to not found",
-			"volume-id", volume.ID,
-			"server-id", server.ID,
-		)
-		return volumes.ErrServerNotFound
-	}
-
 	if hcloudVolume.Server != nil {
-		if hcloudVolume.Server.ID == hcloudServer.ID {
+		if hcloudVolume.Server.ID == server.ID {
 			s.logger.Info(
 				"volume is already attached to this server",
 				"volume-id", volume.ID,
 				"server-id", server.ID,
 			)
+			*volume = *toDomainVolume(hcloudVolume)
 			return nil
 		}
 		s.logger.Info(
@@ -229,8 +302,19 @@ func (s *VolumeService) Attach(ctx context.Context, volume *csi.Volume, server *
 		return volumes.ErrAttached
 	}
 
-	action, _, err := s.client.Volume.Attach(ctx, hcloudVolume, hcloudServer)
+	event := audit.Event{
+		Operation:  "attach",
+		VolumeID:   volume.ID,
+		VolumeName: hcloudVolume.Name,
+		ServerID:   server.ID,
+		Before:     auditVolumeState(hcloudVolume),
+	}
+	op := startOperation(event)
+
+	// The server is not looked up before, the API rejects unknown servers.
+	action, _, err := s.client.Volume.Attach(ctx, hcloudVolume, &hcloud.Server{ID: server.ID})
 	if err != nil {
+		s.finishOperation(ctx, op, nil, err)
 		s.logger.Info(
 			"failed to attach volume",
 			"volume-id", volume.ID,
@@ -246,10 +330,14 @@ func (s *VolumeService) Attach(ctx context.Context, volume *csi.Volume, server *
 		if hcloud.IsError(err, hcloud.ErrorCode("volume_already_attached")) {
 			return volumes.ErrAttached
 		}
+		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			return volumes.ErrServerNotFound
+		}
 		return err
 	}
-	time.Sleep(3 * time.Second) // We know that the Attach action will take some time, so we wait 3 seconds before starting polling the action status. Within these 3 seconds the volume attach action may be already finished.
-	if err := s.client.Action.WaitFor(ctx, action); err != nil {
+	op.waiting()
+	if err := s.waitForAction(ctx, s.attachDelay, action); err != nil {
+		s.finishOperation(ctx, op, action, err)
 		s.logger.Info(
 			"failed to attach volume",
 			"volume-id", volume.ID,
@@ -258,10 +346,21 @@ func (s *VolumeService) Attach(ctx context.Context, volume *csi.Volume, server *
 		)
 		return err
 	}
+
+	op.event.After = auditVolumeState(hcloudVolume)
+	op.event.After.ServerID = server.ID
+	s.finishOperation(ctx, op, action, nil)
+
+	*volume = *toDomainVolume(hcloudVolume)
+	volume.Server = &csi.Server{ID: server.ID}
 	return nil
 }
 
 func (s *VolumeService) Detach(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+	if s.plan != nil {
+		return s.planDetach(ctx, volume, server)
+	}
+
 	if server != nil {
 		s.logger.Info(
 			"detaching volume from server",
@@ -320,8 +419,18 @@ func (s *VolumeService) Detach(ctx context.Context, volume *csi.Volume, server *
 		return volumes.ErrAttached
 	}
 
+	event := audit.Event{
+		Operation:  "detach",
+		VolumeID:   volume.ID,
+		VolumeName: hcloudVolume.Name,
+		ServerID:   hcloudVolume.Server.ID,
+		Before:     auditVolumeState(hcloudVolume),
+	}
+	op := startOperation(event)
+
 	action, _, err := s.client.Volume.Detach(ctx, hcloudVolume)
 	if err != nil {
+		s.finishOperation(ctx, op, nil, err)
 		s.logger.Info(
 			"failed to detach volume",
 			"volume-id", volume.ID,
@@ -333,7 +442,10 @@ func (s *VolumeService) Detach(ctx context.Context, volume *csi.Volume, server *
 		return err
 	}
 
-	if err := s.client.Action.WaitFor(ctx, action); err != nil {
+	op.waiting()
+	// Detaching is usually quick, so the action is watched right away.
+	if _, err := s.actionWatcher.Wait(ctx, action); err != nil {
+		s.finishOperation(ctx, op, action, err)
 		s.logger.Info(
 			"failed to detach volume",
 			"volume-id", volume.ID,
@@ -341,10 +453,18 @@ func (s *VolumeService) Detach(ctx context.Context, volume *csi.Volume, server *
 		)
 		return err
 	}
+
+	op.event.After = auditVolumeState(hcloudVolume)
+	op.event.After.ServerID = 0
+	s.finishOperation(ctx, op, action, nil)
 	return nil
 }
 
 func (s *VolumeService) Resize(ctx context.Context, volume *csi.Volume, size int) error {
+	if s.plan != nil {
+		return s.planResize(ctx, volume, size)
+	}
+
 	logger := s.logger.With("volume-id", volume.ID, "requested-size", size)
 
 	logger.Info(
@@ -368,15 +488,144 @@ func (s *VolumeService) Resize(ctx context.Context, volume *csi.Volume, size int
 		return volumes.ErrVolumeSizeAlreadyReached
 	}
 
+	event := audit.Event{
+		Operation:  "resize",
+		VolumeID:   volume.ID,
+		VolumeName: hcloudVolume.Name,
+		Before:     auditVolumeState(hcloudVolume),
+	}
+	op := startOperation(event)
+
 	action, _, err := s.client.Volume.Resize(ctx, hcloudVolume, size)
 	if err != nil {
+		s.finishOperation(ctx, op, nil, err)
 		logger.Info("failed to resize volume", "err", err)
 		return err
 	}
 
-	if err = s.client.Action.WaitFor(ctx, action); err != nil {
+	op.waiting()
+	if _, err = s.actionWatcher.Wait(ctx, action); err != nil {
+		s.finishOperation(ctx, op, action, err)
 		logger.Info("failed to resize volume", "err", err)
 		return err
 	}
+
+	op.event.After = auditVolumeState(hcloudVolume)
+	op.event.After.Size = size
+	s.finishOperation(ctx, op, action, nil)
+
+	*volume = *toDomainVolume(hcloudVolume)
+	volume.Size = size
+	return nil
+}
+
+func (s *VolumeService) UpdateLabels(ctx context.Context, volume *csi.Volume, labels map[string]string) error {
+	if s.plan != nil {
+		return s.planUpdateLabels(ctx, volume, labels)
+	}
+
+	s.logger.Info(
+		"updating volume labels",
+		"volume-id", volume.ID,
+		"labels", labels,
+	)
+
+	event := audit.Event{
+		Operation:  "update_labels",
+		VolumeID:   volume.ID,
+		VolumeName: volume.Name,
+	}
+	if volume.Labels != nil {
+		event.Before = &audit.VolumeState{Labels: maps.Clone(volume.Labels)}
+	}
+	op := startOperation(event)
+
+	hcloudVolume, _, err := s.client.Volume.Update(ctx, &hcloud.Volume{ID: volume.ID}, hcloud.VolumeUpdateOpts{
+		Labels: labels,
+	})
+	if err == nil && hcloudVolume != nil {
+		op.event.After = auditVolumeState(hcloudVolume)
+	}
+	s.finishOperation(ctx, op, nil, err)
+	if err != nil {
+		s.logger.Info(
+			"failed to update volume labels",
+			"volume-id", volume.ID,
+			"err", err,
+		)
+		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			return volumes.ErrVolumeNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateMigrationTarget creates an empty volume with the size and labels of the
+// given volume in another location. The target volume is labeled with the ID of
+// the source volume, so repeated calls return the already created target. The
+// request name label is not copied, as the target was not created by a
+// CreateVolume request and must not be returned for the request of the source.
+func (s *VolumeService) CreateMigrationTarget(ctx context.Context, volume *csi.Volume, location string) (*csi.Volume, error) {
+	source, err := s.GetByID(ctx, volume.ID)
+	if err != nil {
+		return nil, err
+	}
+	if source.Location == location {
+		return nil, volumes.ErrSameLocation
+	}
+
+	sourceID := strconv.FormatInt(source.ID, 10)
+	labels := maps.Clone(source.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	delete(labels, volumes.LabelKeyMigratedTo)
+	delete(labels, volumes.LabelKeyRequestName)
+	labels[volumes.LabelKeyMigratedFrom] = sourceID
+
+	name := migrationTargetName(source.Name, location)
+
+	s.logger.Info(
+		"creating migration target volume",
+		"volume-id", source.ID,
+		"target-volume-name", name,
+		"target-location", location,
+	)
+
+	target, err := s.Create(ctx, volumes.CreateOpts{
+		Name:     name,
+		MinSize:  source.Size,
+		Location: location,
+		Labels:   labels,
+	})
+	if errors.Is(err, volumes.ErrVolumeAlreadyExists) {
+		existing, getErr := s.GetByName(ctx, name)
+		if getErr != nil {
+			return nil, getErr
+		}
+		if existing.Labels[volumes.LabelKeyMigratedFrom] != sourceID || existing.Location != location {
+			return nil, volumes.ErrVolumeAlreadyExists
+		}
+		return existing, nil
+	}
+	return target, err
+}
+
+// waitForAction waits for the estimated duration of the action before handing
+// it to the action watcher, and records the duration of the action once it
+// succeeded.
+func (s *VolumeService) waitForAction(ctx context.Context, delay *actionDelay, action *hcloud.Action) error {
+	if err := delay.Wait(ctx); err != nil {
+		return err
+	}
+
+	result, err := s.actionWatcher.Wait(ctx, action)
+	if err != nil {
+		return err
+	}
+	if !result.Started.IsZero() && !result.Finished.IsZero() {
+		delay.Observe(result.Finished.Sub(result.Started))
+	}
 	return nil
 }
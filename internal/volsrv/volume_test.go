@@ -1,13 +1,20 @@
 package volsrv
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
 	"log/slog"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/hetznercloud/csi-driver/internal/audit"
 	"github.com/hetznercloud/csi-driver/internal/csi"
 	"github.com/hetznercloud/csi-driver/internal/volumes"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
@@ -28,7 +35,8 @@ func makeTestVolumeService(t *testing.T, requests []mockutil.Request) (*VolumeSe
 		hcloud.WithPollOpts(hcloud.PollOpts{BackoffFunc: hcloud.ConstantBackoff(0)}),
 	)
 
-	volumeService := NewVolumeService(slog.New(slog.DiscardHandler), testClient)
+	actionWatcher := NewActionWatcher(slog.New(slog.DiscardHandler), testClient, time.Millisecond)
+	volumeService := NewVolumeService(slog.New(slog.DiscardHandler), testClient, actionWatcher, nil, nil, nil)
 
 	return volumeService, testServer.Close
 }
@@ -91,3 +99,271 @@ func TestResize(t *testing.T) {
 		})
 	})
 }
+
+func TestCreate(t *testing.T) {
+	t.Run("ErrResourceUnavailable", func(t *testing.T) {
+		volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+			{
+				Method: "POST", Path: "/volumes",
+				Status: 412,
+				JSON: schema.ErrorResponse{
+					Error: schema.Error{Code: "no_space_left_in_location"},
+				},
+			},
+		})
+		defer cleanup()
+
+		_, err := volumeService.Create(context.Background(), volumes.CreateOpts{Name: "pvc-123", MinSize: 10, Location: "fsn1"})
+		assert.Equal(t, volumes.ErrResourceUnavailable, err)
+	})
+}
+
+func TestAll(t *testing.T) {
+	volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+		{
+			Method: "GET", Path: "/volumes?page=1&per_page=50",
+			Status: 200,
+			JSON: schema.VolumeListResponse{
+				Volumes: []schema.Volume{
+					{ID: 1, Name: "pvc-123", Size: 10, Location: schema.Location{Name: "fsn1"}},
+					{ID: 2, Name: "pvc-456", Size: 20, Location: schema.Location{Name: "nbg1"}},
+				},
+			},
+		},
+	})
+	defer cleanup()
+
+	vols, err := volumeService.All(context.Background())
+	require.NoError(t, err)
+	require.Len(t, vols, 2)
+	assert.Equal(t, "nbg1", vols[1].Location)
+}
+
+func TestUpdateLabels(t *testing.T) {
+	t.Run("happy", func(t *testing.T) {
+		volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+			{
+				Method: "PUT", Path: "/volumes/1",
+				Want: func(t *testing.T, r *http.Request) {
+					body, err := io.ReadAll(r.Body)
+					assert.NoError(t, err)
+					assert.JSONEq(t, `{"labels":{"managed-by":"csi-driver"}}`, string(body))
+				},
+				Status: 200,
+				JSON: schema.VolumeUpdateResponse{
+					Volume: schema.Volume{ID: 1, Name: "pvc-123", Size: 10},
+				},
+			},
+		})
+		defer cleanup()
+
+		err := volumeService.UpdateLabels(context.Background(), &csi.Volume{ID: 1}, map[string]string{"managed-by": "csi-driver"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+			{
+				Method: "PUT", Path: "/volumes/1",
+				Status: 404,
+				JSON: schema.ErrorResponse{
+					Error: schema.Error{Code: "not_found"},
+				},
+			},
+		})
+		defer cleanup()
+
+		err := volumeService.UpdateLabels(context.Background(), &csi.Volume{ID: 1}, map[string]string{})
+		assert.Equal(t, volumes.ErrVolumeNotFound, err)
+	})
+}
+
+func TestCreateMigrationTarget(t *testing.T) {
+	sourceVolume := schema.Volume{
+		ID:       1,
+		Name:     "pvc-123",
+		Size:     20,
+		Location: schema.Location{Name: "fsn1"},
+		Labels:   map[string]string{"managed-by": "csi-driver", "request-name": "pvc-123"},
+	}
+
+	t.Run("happy", func(t *testing.T) {
+		volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+			{
+				Method: "GET", Path: "/volumes/1",
+				Status: 200,
+				JSON:   schema.VolumeGetResponse{Volume: sourceVolume},
+			},
+			{
+				Method: "POST", Path: "/volumes",
+				Want: func(t *testing.T, r *http.Request) {
+					body, err := io.ReadAll(r.Body)
+					assert.NoError(t, err)
+					assert.JSONEq(t, `{"name":"pvc-123-nbg1","size":20,"location":"nbg1","labels":{"managed-by":"csi-driver","migrated-from":"1"}}`, string(body))
+				},
+				Status: 201,
+				JSON: schema.VolumeCreateResponse{
+					Volume: schema.Volume{ID: 2, Name: "pvc-123-nbg1", Size: 20, Location: schema.Location{Name: "nbg1"}},
+					Action: &schema.Action{ID: 3, Status: "success"},
+				},
+			},
+		})
+		defer cleanup()
+
+		target, err := volumeService.CreateMigrationTarget(context.Background(), &csi.Volume{ID: 1}, "nbg1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), target.ID)
+		assert.Equal(t, "nbg1", target.Location)
+	})
+
+	t.Run("existing target", func(t *testing.T) {
+		volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+			{
+				Method: "GET", Path: "/volumes/1",
+				Status: 200,
+				JSON:   schema.VolumeGetResponse{Volume: sourceVolume},
+			},
+			{
+				Method: "POST", Path: "/volumes",
+				Status: 409,
+				JSON: schema.ErrorResponse{
+					Error: schema.Error{Code: "uniqueness_error"},
+				},
+			},
+			{
+				Method: "GET", Path: "/volumes?name=pvc-123-nbg1",
+				Status: 200,
+				JSON: schema.VolumeListResponse{
+					Volumes: []schema.Volume{
+						{
+							ID:       2,
+							Name:     "pvc-123-nbg1",
+							Size:     20,
+							Location: schema.Location{Name: "nbg1"},
+							Labels:   map[string]string{"migrated-from": "1"},
+						},
+					},
+				},
+			},
+		})
+		defer cleanup()
+
+		target, err := volumeService.CreateMigrationTarget(context.Background(), &csi.Volume{ID: 1}, "nbg1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), target.ID)
+	})
+
+	t.Run("same location", func(t *testing.T) {
+		volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+			{
+				Method: "GET", Path: "/volumes/1",
+				Status: 200,
+				JSON:   schema.VolumeGetResponse{Volume: sourceVolume},
+			},
+		})
+		defer cleanup()
+
+		_, err := volumeService.CreateMigrationTarget(context.Background(), &csi.Volume{ID: 1}, "fsn1")
+		assert.Equal(t, volumes.ErrSameLocation, err)
+	})
+}
+
+func TestMigrationTargetName(t *testing.T) {
+	assert.Equal(t, "pvc-123-nbg1", migrationTargetName("pvc-123", "nbg1"))
+
+	name := migrationTargetName("pvc-0123456789-0123456789-0123456789-0123456789-0123456789-", "nbg1")
+	assert.Equal(t, "pvc-0123456789-0123456789-0123456789-0123456789-0123456789-nbg1", name)
+	assert.LessOrEqual(t, len(name), maxVolumeNameLength)
+}
+
+func TestAttach(t *testing.T) {
+	volumeService, cleanup := makeTestVolumeService(t, []mockutil.Request{
+		{
+			Method: "GET", Path: "/volumes/1",
+			Status: 200,
+			JSON: schema.VolumeGetResponse{
+				Volume: schema.Volume{ID: 1, Name: "pvc-123", Size: 10},
+			},
+		},
+		{
+			Method: "POST", Path: "/volumes/1/actions/attach",
+			Status: 201,
+			JSON: schema.VolumeActionAttachVolumeResponse{
+				Action: schema.Action{ID: 3, Status: "running"},
+			},
+		},
+		{
+			Method: "GET", Path: "/actions?id=3&page=1",
+			Status: 200,
+			JSON: schema.ActionListResponse{
+				Actions: []schema.Action{
+					{
+						ID:       3,
+						Status:   "success",
+						Started:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+						Finished: hcloud.Ptr(time.Date(2025, 1, 1, 0, 0, 2, 0, time.UTC)),
+					},
+				},
+			},
+		},
+	})
+	defer cleanup()
+
+	var auditBuf bytes.Buffer
+	volumeService.auditLog = audit.NewLogger(slog.New(slog.DiscardHandler), &auditBuf)
+	volumeService.attachDelay = newActionDelay(0)
+
+	ctx := audit.WithRequest(context.Background(), audit.Request{Method: "ControllerPublishVolume", NodeID: "2"})
+	volume := &csi.Volume{ID: 1}
+	err := volumeService.Attach(ctx, volume, &csi.Server{ID: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "pvc-123", volume.Name)
+	assert.Equal(t, &csi.Server{ID: 2}, volume.Server)
+
+	var event audit.Event
+	require.NoError(t, json.Unmarshal(auditBuf.Bytes(), &event))
+	assert.Equal(t, "attach", event.Operation)
+	assert.Equal(t, "ControllerPublishVolume", event.Request.Method)
+	assert.Equal(t, int64(3), event.ActionID)
+	assert.Equal(t, audit.ResultSuccess, event.Result)
+	assert.Equal(t, int64(0), event.Before.ServerID)
+	assert.Equal(t, int64(2), event.After.ServerID)
+
+	// The observed duration of 2s is taken into account for the next attach.
+	assert.Equal(t, 400*time.Millisecond, volumeService.attachDelay.average)
+}
+
+type fakeObserver struct {
+	operations []string
+	errors     []string
+}
+
+func (o *fakeObserver) ObserveVolumeOperation(operation, result string, _, _ time.Duration) {
+	o.operations = append(o.operations, operation+"/"+result)
+}
+
+func (o *fakeObserver) ObserveVolumeOperationError(operation, reason string) {
+	o.errors = append(o.errors, operation+"/"+reason)
+}
+
+func TestFinishOperationObserver(t *testing.T) {
+	observer := &fakeObserver{}
+	volumeService := NewVolumeService(slog.New(slog.DiscardHandler), nil, nil, nil, nil, observer)
+	ctx := context.Background()
+
+	op := startOperation(audit.Event{Operation: "attach"})
+	op.waiting()
+	volumeService.finishOperation(ctx, op, nil, nil)
+
+	op = startOperation(audit.Event{Operation: "attach"})
+	volumeService.finishOperation(ctx, op, nil, hcloud.Error{Code: hcloud.ErrorCodeLocked})
+
+	op = startOperation(audit.Event{Operation: "attach"})
+	volumeService.finishOperation(ctx, op, nil, hcloud.Error{Code: "limit_exceeded_error"})
+
+	op = startOperation(audit.Event{Operation: "delete"})
+	volumeService.finishOperation(ctx, op, nil, io.EOF)
+
+	assert.Equal(t, []string{"attach/success", "attach/failure", "attach/failure", "delete/failure"}, observer.operations)
+	assert.Equal(t, []string{"attach/locked_server", "attach/attach_limit_reached"}, observer.errors)
+}
@@ -0,0 +1,262 @@
+package volumes
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/ratelimit"
+)
+
+// CachingService wraps a volume service and caches the volumes returned by
+// GetByID, GetByName and All for a short time, to save API calls when the same
+// volume is looked up repeatedly by the controller.
+//
+// Only the lookups of the callers are cached. The wrapped service still looks
+// up the current volume before mutating it, as deciding on a cached state
+// could e.g. skip a required attach. Attach and Resize cache the volume they
+// return, so the lookup following them, e.g. in ControllerPublishVolume, does
+// not need another API call. Other mutating calls update or invalidate the
+// cached volume. Lookups by name after a conflicting Create bypass the cache,
+// as they decide whether the existing volume belongs to the request. The
+// cache can be seeded with all volumes of the project by running
+// [CachingService.Run].
+type CachingService struct {
+	logger        *slog.Logger
+	volumeService Service
+	ttl           time.Duration
+
+	mu         sync.Mutex
+	volumes    map[int64]cacheEntry
+	names      map[string]int64
+	generation uint64
+}
+
+type cacheEntry struct {
+	volume  *csi.Volume
+	expires time.Time
+}
+
+func NewCachingService(logger *slog.Logger, volumeService Service, ttl time.Duration) *CachingService {
+	return &CachingService{
+		logger:        logger,
+		volumeService: volumeService,
+		ttl:           ttl,
+		volumes:       make(map[int64]cacheEntry),
+		names:         make(map[string]int64),
+	}
+}
+
+// Run seeds the cache with all volumes every interval until the context is
+// canceled.
+func (s *CachingService) Run(ctx context.Context, interval time.Duration) {
+	ctx = ratelimit.WithPriority(ctx, ratelimit.PriorityLow)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.All(ctx); err != nil {
+			s.logger.Info("failed to seed volume cache", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *CachingService) Create(ctx context.Context, opts CreateOpts) (*csi.Volume, error) {
+	generation := s.currentGeneration()
+	volume, err := s.volumeService.Create(ctx, opts)
+	if err != nil {
+		if errors.Is(err, ErrVolumeAlreadyExists) {
+			s.invalidateName(opts.Name)
+		}
+		return nil, err
+	}
+	s.store(generation, volume)
+	return volume, nil
+}
+
+func (s *CachingService) All(ctx context.Context) ([]*csi.Volume, error) {
+	generation := s.currentGeneration()
+	volumes, err := s.volumeService.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.store(generation, volumes...)
+	return volumes, nil
+}
+
+func (s *CachingService) GetByID(ctx context.Context, id int64) (*csi.Volume, error) {
+	if volume, ok := s.lookup(id); ok {
+		return volume, nil
+	}
+
+	generation := s.currentGeneration()
+	volume, err := s.volumeService.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.store(generation, volume)
+	return volume, nil
+}
+
+func (s *CachingService) GetByName(ctx context.Context, name string) (*csi.Volume, error) {
+	s.mu.Lock()
+	id, ok := s.names[name]
+	s.mu.Unlock()
+	if ok {
+		if volume, ok := s.lookup(id); ok && volume.Name == name {
+			return volume, nil
+		}
+	}
+
+	generation := s.currentGeneration()
+	volume, err := s.volumeService.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.store(generation, volume)
+	return volume, nil
+}
+
+func (s *CachingService) Delete(ctx context.Context, volume *csi.Volume) error {
+	defer s.invalidate(volume.ID)
+	return s.volumeService.Delete(ctx, volume)
+}
+
+func (s *CachingService) Attach(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+	if err := s.volumeService.Attach(ctx, volume, server); err != nil {
+		s.invalidate(volume.ID)
+		return err
+	}
+	s.replace(volume)
+	return nil
+}
+
+func (s *CachingService) Detach(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+	if err := s.volumeService.Detach(ctx, volume, server); err != nil {
+		s.invalidate(volume.ID)
+		return err
+	}
+	s.update(volume.ID, func(v *csi.Volume) { v.Server = nil })
+	return nil
+}
+
+func (s *CachingService) Resize(ctx context.Context, volume *csi.Volume, size int) error {
+	if err := s.volumeService.Resize(ctx, volume, size); err != nil {
+		s.invalidate(volume.ID)
+		return err
+	}
+	s.replace(volume)
+	return nil
+}
+
+func (s *CachingService) UpdateLabels(ctx context.Context, volume *csi.Volume, labels map[string]string) error {
+	if err := s.volumeService.UpdateLabels(ctx, volume, labels); err != nil {
+		s.invalidate(volume.ID)
+		return err
+	}
+	s.update(volume.ID, func(v *csi.Volume) { v.Labels = maps.Clone(labels) })
+	return nil
+}
+
+func (s *CachingService) CreateMigrationTarget(ctx context.Context, volume *csi.Volume, location string) (*csi.Volume, error) {
+	generation := s.currentGeneration()
+	target, err := s.volumeService.CreateMigrationTarget(ctx, volume, location)
+	if err != nil {
+		return nil, err
+	}
+	s.store(generation, target)
+	return target, nil
+}
+
+func (s *CachingService) currentGeneration() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation
+}
+
+// lookup returns a copy of the cached volume, if it did not expire yet.
+func (s *CachingService) lookup(id int64) (*csi.Volume, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.volumes[id]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.volume.Copy(), true
+}
+
+// store caches the volumes, unless the cache was invalidated since the
+// generation, as the volumes might be outdated in that case.
+func (s *CachingService) store(generation uint64, volumes ...*csi.Volume) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return
+	}
+
+	expires := time.Now().Add(s.ttl)
+	for _, volume := range volumes {
+		if old, ok := s.volumes[volume.ID]; ok {
+			delete(s.names, old.volume.Name)
+		}
+		s.volumes[volume.ID] = cacheEntry{volume: volume.Copy(), expires: expires}
+		s.names[volume.Name] = volume.ID
+	}
+}
+
+// replace caches the volume returned by a mutating call. Lookups, which were
+// started before, must not overwrite it.
+func (s *CachingService) replace(volume *csi.Volume) {
+	s.mu.Lock()
+	s.generation++
+	generation := s.generation
+	s.mu.Unlock()
+
+	s.store(generation, volume)
+}
+
+// update applies a mutation to the cached volume, if it is cached.
+func (s *CachingService) update(id int64, mutate func(v *csi.Volume)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	if entry, ok := s.volumes[id]; ok {
+		mutate(entry.volume)
+	}
+}
+
+// invalidateName removes the volume with the name from the cache.
+func (s *CachingService) invalidateName(name string) {
+	s.mu.Lock()
+	id, ok := s.names[name]
+	s.mu.Unlock()
+
+	if ok {
+		s.invalidate(id)
+	}
+}
+
+func (s *CachingService) invalidate(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	if entry, ok := s.volumes[id]; ok {
+		delete(s.names, entry.volume.Name)
+		delete(s.volumes, id)
+	}
+}
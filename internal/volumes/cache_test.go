@@ -0,0 +1,184 @@
+package volumes_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/mock"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+var _ volumes.Service = (*volumes.CachingService)(nil)
+
+func newCountingVolumeService() (*mock.VolumeService, *int) {
+	calls := 0
+	return &mock.VolumeService{
+		GetByIDFunc: func(ctx context.Context, id int64) (*csi.Volume, error) {
+			calls++
+			return &csi.Volume{ID: id, Name: "vol", Size: 10}, nil
+		},
+		GetByNameFunc: func(ctx context.Context, name string) (*csi.Volume, error) {
+			calls++
+			return &csi.Volume{ID: 1, Name: name, Size: 10}, nil
+		},
+	}, &calls
+}
+
+func TestCachingServiceGetByID(t *testing.T) {
+	volumeService, calls := newCountingVolumeService()
+	service := volumes.NewCachingService(slog.New(slog.DiscardHandler), volumeService, time.Minute)
+
+	for range 3 {
+		volume, err := service.GetByID(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if volume.ID != 1 {
+			t.Errorf("unexpected volume: %v", volume)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("expected 1 call, got %d", *calls)
+	}
+
+	// Lookups by name are served from the same cache.
+	if _, err := service.GetByName(context.Background(), "vol"); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 1 {
+		t.Errorf("expected 1 call, got %d", *calls)
+	}
+}
+
+func TestCachingServiceExpires(t *testing.T) {
+	volumeService, calls := newCountingVolumeService()
+	service := volumes.NewCachingService(slog.New(slog.DiscardHandler), volumeService, time.Millisecond)
+
+	if _, err := service.GetByID(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := service.GetByID(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("expected 2 calls, got %d", *calls)
+	}
+}
+
+func TestCachingServiceAttachUpdatesVolume(t *testing.T) {
+	volumeService, calls := newCountingVolumeService()
+	volumeService.AttachFunc = func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+		*volume = csi.Volume{ID: volume.ID, Name: "vol", Size: 10, Server: &csi.Server{ID: server.ID}}
+		return nil
+	}
+	service := volumes.NewCachingService(slog.New(slog.DiscardHandler), volumeService, time.Minute)
+
+	// The volume was not looked up before, the attached volume is cached.
+	if err := service.Attach(context.Background(), &csi.Volume{ID: 1}, &csi.Server{ID: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	volume, err := service.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if volume.Server == nil || volume.Server.ID != 2 {
+		t.Errorf("expected volume to be attached to server 2, got %v", volume.Server)
+	}
+	if *calls != 0 {
+		t.Errorf("expected no calls, got %d", *calls)
+	}
+}
+
+func TestCachingServiceCreateConflictBypassesCache(t *testing.T) {
+	volumeService, calls := newCountingVolumeService()
+	volumeService.CreateFunc = func(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error) {
+		return nil, volumes.ErrVolumeAlreadyExists
+	}
+	service := volumes.NewCachingService(slog.New(slog.DiscardHandler), volumeService, time.Minute)
+
+	if _, err := service.GetByName(context.Background(), "vol"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Create(context.Background(), volumes.CreateOpts{Name: "vol"}); !errors.Is(err, volumes.ErrVolumeAlreadyExists) {
+		t.Fatalf("expected ErrVolumeAlreadyExists, got %v", err)
+	}
+
+	// The idempotency check looks up the existing volume in the API.
+	if _, err := service.GetByName(context.Background(), "vol"); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("expected 2 calls, got %d", *calls)
+	}
+}
+
+func TestCachingServiceFailedMutationInvalidates(t *testing.T) {
+	volumeService, calls := newCountingVolumeService()
+	volumeService.ResizeFunc = func(ctx context.Context, volume *csi.Volume, size int) error {
+		return errors.New("resize failed")
+	}
+	service := volumes.NewCachingService(slog.New(slog.DiscardHandler), volumeService, time.Minute)
+
+	if _, err := service.GetByID(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Resize(context.Background(), &csi.Volume{ID: 1}, 20); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := service.GetByID(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("expected 2 calls, got %d", *calls)
+	}
+}
+
+func TestCachingServiceDeleteInvalidates(t *testing.T) {
+	volumeService, calls := newCountingVolumeService()
+	volumeService.DeleteFunc = func(ctx context.Context, volume *csi.Volume) error {
+		return nil
+	}
+	service := volumes.NewCachingService(slog.New(slog.DiscardHandler), volumeService, time.Minute)
+
+	if _, err := service.GetByID(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Delete(context.Background(), &csi.Volume{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.GetByID(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Errorf("expected 2 calls, got %d", *calls)
+	}
+}
+
+func TestCachingServiceSeededByAll(t *testing.T) {
+	volumeService, calls := newCountingVolumeService()
+	volumeService.AllFunc = func(ctx context.Context) ([]*csi.Volume, error) {
+		return []*csi.Volume{{ID: 1, Name: "vol-1"}, {ID: 2, Name: "vol-2"}}, nil
+	}
+	service := volumes.NewCachingService(slog.New(slog.DiscardHandler), volumeService, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service.Run(ctx, time.Hour)
+
+	volume, err := service.GetByName(context.Background(), "vol-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if volume.ID != 2 {
+		t.Errorf("unexpected volume: %v", volume)
+	}
+	if *calls != 0 {
+		t.Errorf("expected 0 calls, got %d", *calls)
+	}
+}
@@ -7,16 +7,19 @@ import (
 	"log/slog"
 	"os/exec"
 	"strings"
+
+	"github.com/hetznercloud/csi-driver/internal/tracing"
 )
 
 const cryptsetupExecuable = "cryptsetup"
 
 type CryptSetup struct {
-	logger *slog.Logger
+	logger   *slog.Logger
+	observer NodeObserver
 }
 
-func NewCryptSetup(logger *slog.Logger) *CryptSetup {
-	return &CryptSetup{logger: logger}
+func NewCryptSetup(logger *slog.Logger, observer NodeObserver) *CryptSetup {
+	return &CryptSetup{logger: logger, observer: observer}
 }
 
 func (cs *CryptSetup) IsActive(ctx context.Context, luksDeviceName string) (bool, error) {
@@ -35,7 +38,14 @@ func (cs *CryptSetup) Format(ctx context.Context, devicePath string, passphrase
 		"formatting LUKS device",
 		"devicePath", devicePath,
 	)
-	output, _, err := commandWithStdin(ctx, passphrase, cryptsetupExecuable, "luksFormat", "--type", "luks1", devicePath)
+	// Interrupting luksFormat, e.g. because the request was canceled, can
+	// leave a corrupted LUKS header.
+	done, err := startUninterruptible("cryptsetup luksFormat " + devicePath)
+	if err != nil {
+		return fmt.Errorf("unable to format device %s with LUKS: %w", devicePath, err)
+	}
+	defer done()
+	output, _, err := commandWithStdin(context.WithoutCancel(ctx), passphrase, cryptsetupExecuable, "luksFormat", "--type", "luks1", devicePath)
 	if err != nil {
 		return fmt.Errorf("unable to format device %s with LUKS: %s", devicePath, output)
 	}
@@ -55,8 +65,16 @@ func (cs *CryptSetup) Open(ctx context.Context, devicePath string, luksDeviceNam
 		"devicePath", devicePath,
 		"luksDeviceName", luksDeviceName,
 	)
-	output, _, err := commandWithStdin(ctx, passphrase, cryptsetupExecuable, "luksOpen", "--allow-discards", devicePath, luksDeviceName)
+	done, err := startUninterruptible("cryptsetup luksOpen " + devicePath)
+	if err != nil {
+		return fmt.Errorf("unable to open LUKS device %s: %w", devicePath, err)
+	}
+	defer done()
+	output, _, err := commandWithStdin(context.WithoutCancel(ctx), passphrase, cryptsetupExecuable, "luksOpen", "--allow-discards", devicePath, luksDeviceName)
 	if err != nil {
+		if cs.observer != nil {
+			cs.observer.ObserveLUKSOpenFailure()
+		}
 		return fmt.Errorf("unable to open LUKS device %s: %s", devicePath, output)
 	}
 	return nil
@@ -107,6 +125,13 @@ func command(ctx context.Context, name string, args ...string) (string, int, err
 }
 
 func commandWithStdin(ctx context.Context, stdin string, name string, args ...string) (string, int, error) {
+	ctx, span := tracing.StartCommand(ctx, name, args...)
+	output, code, err := runCommand(ctx, stdin, name, args...)
+	tracing.End(span, err)
+	return output, code, err
+}
+
+func runCommand(ctx context.Context, stdin string, name string, args ...string) (string, int, error) {
 	cmd := exec.CommandContext(ctx, name, args...)
 	if stdin != "" {
 		cmd.Stdin = strings.NewReader(stdin)
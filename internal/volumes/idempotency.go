@@ -61,6 +61,15 @@ func (s *IdempotentService) Create(ctx context.Context, opts CreateOpts) (*csi.V
 			)
 			return nil, ErrVolumeAlreadyExists
 		}
+		if requestName, ok := opts.Labels[LabelKeyRequestName]; ok && existingVolume.Labels[LabelKeyRequestName] != requestName {
+			s.logger.Info(
+				"existing volume was created for a different request",
+				"name", opts.Name,
+				"request-name", requestName,
+				"actual-request-name", existingVolume.Labels[LabelKeyRequestName],
+			)
+			return nil, ErrVolumeAlreadyExists
+		}
 		if existingVolume.Size < opts.MinSize {
 			s.logger.Info(
 				"existing volume is too small",
@@ -86,7 +95,7 @@ func (s *IdempotentService) Create(ctx context.Context, opts CreateOpts) (*csi.V
 				"location", opts.Location,
 				"actual-location", existingVolume.Location,
 			)
-			return nil, ErrVolumeAlreadyExists
+			return nil, ErrVolumeInOtherLocation
 		}
 		return existingVolume, nil
 	}
@@ -167,3 +176,11 @@ func (s *IdempotentService) Resize(ctx context.Context, volume *csi.Volume, size
 		return err
 	}
 }
+
+func (s *IdempotentService) UpdateLabels(ctx context.Context, volume *csi.Volume, labels map[string]string) error {
+	return s.volumeService.UpdateLabels(ctx, volume, labels)
+}
+
+func (s *IdempotentService) CreateMigrationTarget(ctx context.Context, volume *csi.Volume, location string) (*csi.Volume, error) {
+	return s.volumeService.CreateMigrationTarget(ctx, volume, location)
+}
@@ -105,6 +105,40 @@ func TestIdempotentServiceCreateExistingError(t *testing.T) {
 	}
 }
 
+func TestIdempotentServiceCreateExistingWithRequestName(t *testing.T) {
+	existingVolume := &csi.Volume{
+		ID:       1,
+		Name:     "default-data-1a2b3c4d",
+		Size:     10,
+		Location: "loc",
+		Labels:   map[string]string{volumes.LabelKeyRequestName: "pvc-123"},
+	}
+
+	volumeService := &mock.VolumeService{
+		CreateFunc: func(ctx context.Context, opts volumes.CreateOpts) (*csi.Volume, error) {
+			return nil, volumes.ErrVolumeAlreadyExists
+		},
+		GetByNameFunc: func(ctx context.Context, name string) (*csi.Volume, error) {
+			return existingVolume, nil
+		},
+	}
+
+	service := volumes.NewIdempotentService(slog.New(slog.DiscardHandler), volumeService)
+
+	volume, err := service.Create(context.Background(), volumes.CreateOpts{
+		Name:     "default-data-1a2b3c4d",
+		MinSize:  10,
+		Location: "loc",
+		Labels:   map[string]string{volumes.LabelKeyRequestName: "pvc-123"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if volume != existingVolume {
+		t.Error("unexpected volume")
+	}
+}
+
 func TestIdempotentServiceCreateExistingNotFitting(t *testing.T) {
 	testCases := []struct {
 		Name           string
@@ -137,6 +171,16 @@ func TestIdempotentServiceCreateExistingNotFitting(t *testing.T) {
 				Location: "wrong",
 			},
 		},
+		{
+			Name: "different request name",
+			ExistingVolume: &csi.Volume{
+				ID:       1,
+				Name:     "vol",
+				Size:     10,
+				Location: "loc",
+				Labels:   map[string]string{volumes.LabelKeyRequestName: "pvc-other"},
+			},
+		},
 	}
 
 	volumeService := &mock.VolumeService{
@@ -158,6 +202,7 @@ func TestIdempotentServiceCreateExistingNotFitting(t *testing.T) {
 				MinSize:  10,
 				MaxSize:  20,
 				Location: "loc",
+				Labels:   map[string]string{volumes.LabelKeyRequestName: "pvc-123"},
 			})
 			if volume != nil || err == nil {
 				t.Fatal("expected to fail")
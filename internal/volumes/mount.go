@@ -11,10 +11,12 @@ import (
 	"time"
 
 	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sys/unix"
 	"k8s.io/mount-utils"
 	"k8s.io/utils/exec"
 
+	"github.com/hetznercloud/csi-driver/internal/tracing"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 )
 
@@ -48,25 +50,29 @@ type LinuxMountService struct {
 	cryptSetup *CryptSetup
 }
 
-func NewLinuxMountService(logger *slog.Logger) *LinuxMountService {
+// NewLinuxMountService creates a LinuxMountService. The durations of mkfs, fsck
+// and mount are recorded in the metrics of the observer, which may be nil.
+func NewLinuxMountService(logger *slog.Logger, observer NodeObserver) *LinuxMountService {
 	return &LinuxMountService{
 		logger: logger,
 		mounter: &mount.SafeFormatAndMount{
-			Interface: mount.New(""),
-			Exec:      exec.New(),
+			Interface: &observedMounter{Interface: mount.New(""), observer: observer},
+			Exec:      &observedExec{Interface: exec.New(), observer: observer},
 		},
-		cryptSetup: NewCryptSetup(logger),
+		cryptSetup: NewCryptSetup(logger, observer),
 	}
 }
 
 func (s *LinuxMountService) Publish(ctx context.Context, targetPath string, devicePath string, opts MountOpts) error {
+	mounter := s.tracedMounter(ctx)
+
 	// Ensure device is ready via stat syscall. Otherwise, `blkid` might return
 	// exit code 2, which is the same exit code as for an unformatted device.
 	if err := s.waitDeviceReady(ctx, devicePath); err != nil {
 		return fmt.Errorf("device %q not ready: %w", devicePath, err)
 	}
 
-	isMountPoint, err := s.mounter.IsMountPoint(targetPath)
+	isMountPoint, err := mounter.IsMountPoint(targetPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			isMountPoint = false
@@ -111,7 +117,7 @@ func (s *LinuxMountService) Publish(ctx context.Context, targetPath string, devi
 	}
 
 	if opts.EncryptionPassphrase != "" {
-		existingFSType, err := s.mounter.GetDiskFormat(devicePath)
+		existingFSType, err := mounter.GetDiskFormat(devicePath)
 		if err != nil {
 			return fmt.Errorf("unable to detect existing disk format of %s: %w", devicePath, err)
 		}
@@ -145,7 +151,10 @@ func (s *LinuxMountService) Publish(ctx context.Context, targetPath string, devi
 	)
 
 	if opts.BlockVolume {
-		return s.mounter.MountSensitive(devicePath, targetPath, opts.FSType, mountOptions, opts.Additional)
+		_, span := tracing.Start(ctx, "mount", attribute.String("device-path", devicePath))
+		err := mounter.MountSensitive(devicePath, targetPath, opts.FSType, mountOptions, opts.Additional)
+		tracing.End(span, err)
+		return err
 	}
 
 	formatOptions := make([]string, 0)
@@ -160,7 +169,32 @@ func (s *LinuxMountService) Publish(ctx context.Context, targetPath string, devi
 		formatOptions = append(formatOptions, "-c", fmt.Sprintf("options=%s", XFSDefaultConfigPath))
 	}
 
-	return s.mounter.FormatAndMountSensitiveWithFormatOptions(devicePath, targetPath, opts.FSType, mountOptions, opts.Additional, formatOptions)
+	// Formatting and checking the filesystem are traced as child spans by the
+	// mounter.
+	_, span := tracing.Start(ctx, "format and mount",
+		attribute.String("device-path", devicePath),
+		attribute.String("fs-type", opts.FSType),
+	)
+	// The mounter runs mkfs without a context, so it is not canceled with the
+	// request, but a shutdown must wait for it.
+	done, err := startUninterruptible("format and mount " + devicePath)
+	if err != nil {
+		tracing.End(span, err)
+		return err
+	}
+	err = mounter.FormatAndMountSensitiveWithFormatOptions(devicePath, targetPath, opts.FSType, mountOptions, opts.Additional, formatOptions)
+	done()
+	tracing.End(span, err)
+	return err
+}
+
+// tracedMounter returns the mounter of the service, which traces the commands
+// it runs, like mkfs and fsck, as children of the span in ctx.
+func (s *LinuxMountService) tracedMounter(ctx context.Context) *mount.SafeFormatAndMount {
+	return &mount.SafeFormatAndMount{
+		Interface: s.mounter.Interface,
+		Exec:      tracing.Exec(ctx, s.mounter.Exec),
+	}
 }
 
 // waitDeviceReady ensures the device at devicePath exists. This is done by ensuring a stat
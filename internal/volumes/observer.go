@@ -0,0 +1,116 @@
+package volumes
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/mount-utils"
+	"k8s.io/utils/exec"
+)
+
+// volumeDevicePrefix is the prefix of the device paths of attached volumes.
+const volumeDevicePrefix = "/dev/disk/by-id/scsi-0HC_Volume_"
+
+// NodeObserver records metrics of the operations on the node.
+type NodeObserver interface {
+	// ObserveNodeCommand records the duration of a command like mkfs, fsck or
+	// mount.
+	ObserveNodeCommand(command, result string, duration time.Duration)
+	// ObserveLUKSOpenFailure records a LUKS device, which could not be opened.
+	ObserveLUKSOpenFailure()
+}
+
+// CountAttachedVolumes returns the number of volumes attached to the node.
+func CountAttachedVolumes() int {
+	return len(attachedVolumeDevices())
+}
+
+// attachedVolumeDevices returns the IDs of the volumes attached to the node,
+// keyed by their device paths in /dev/disk/by-id.
+func attachedVolumeDevices() map[string]string {
+	matches, _ := filepath.Glob(volumeDevicePrefix + "*")
+	devices := make(map[string]string, len(matches))
+	for _, match := range matches {
+		volumeID := strings.TrimPrefix(match, volumeDevicePrefix)
+		if strings.Contains(volumeID, "-part") {
+			continue
+		}
+		devices[match] = volumeID
+	}
+	return devices
+}
+
+func observeCommand(observer NodeObserver, command string, start time.Time, err error) {
+	if observer == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	observer.ObserveNodeCommand(command, result, time.Since(start))
+}
+
+// commandName returns the name of the command for the metrics, e.g. mkfs for
+// /sbin/mkfs.ext4.
+func commandName(cmd string) string {
+	name, _, _ := strings.Cut(filepath.Base(cmd), ".")
+	return name
+}
+
+// observedExec records the durations of the commands run by libraries like
+// k8s.io/mount-utils.
+type observedExec struct {
+	exec.Interface
+	observer NodeObserver
+}
+
+func (e *observedExec) Command(cmd string, args ...string) exec.Cmd {
+	return &observedCmd{Cmd: e.Interface.Command(cmd, args...), observer: e.observer, name: commandName(cmd)}
+}
+
+func (e *observedExec) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return &observedCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...), observer: e.observer, name: commandName(cmd)}
+}
+
+type observedCmd struct {
+	exec.Cmd
+	observer NodeObserver
+	name     string
+}
+
+func (c *observedCmd) Run() error {
+	start := time.Now()
+	err := c.Cmd.Run()
+	observeCommand(c.observer, c.name, start, err)
+	return err
+}
+
+func (c *observedCmd) CombinedOutput() ([]byte, error) {
+	start := time.Now()
+	output, err := c.Cmd.CombinedOutput()
+	observeCommand(c.observer, c.name, start, err)
+	return output, err
+}
+
+func (c *observedCmd) Output() ([]byte, error) {
+	start := time.Now()
+	output, err := c.Cmd.Output()
+	observeCommand(c.observer, c.name, start, err)
+	return output, err
+}
+
+// observedMounter records the durations of mounting volumes.
+type observedMounter struct {
+	mount.Interface
+	observer NodeObserver
+}
+
+func (m *observedMounter) MountSensitive(source string, target string, fstype string, options []string, sensitiveOptions []string) error {
+	start := time.Now()
+	err := m.Interface.MountSensitive(source, target, fstype, options, sensitiveOptions)
+	observeCommand(m.observer, "mount", start, err)
+	return err
+}
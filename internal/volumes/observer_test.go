@@ -0,0 +1,57 @@
+package volumes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+type fakeNodeObserver struct {
+	commands []string
+}
+
+func (o *fakeNodeObserver) ObserveNodeCommand(command, result string, _ time.Duration) {
+	o.commands = append(o.commands, command+"/"+result)
+}
+
+func (o *fakeNodeObserver) ObserveLUKSOpenFailure() {}
+
+func TestObservedExec(t *testing.T) {
+	fake := &testingexec.FakeExec{}
+	fake.CommandScript = []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd {
+			return &testingexec.FakeCmd{CombinedOutputScript: []testingexec.FakeAction{
+				func() ([]byte, []byte, error) { return nil, nil, nil },
+			}}
+		},
+		func(cmd string, args ...string) exec.Cmd {
+			return &testingexec.FakeCmd{CombinedOutputScript: []testingexec.FakeAction{
+				func() ([]byte, []byte, error) { return nil, nil, errors.New("failed") },
+			}}
+		},
+	}
+
+	observer := &fakeNodeObserver{}
+	e := &observedExec{Interface: fake, observer: observer}
+
+	if _, err := e.Command("/sbin/mkfs.ext4", "/dev/sdb").CombinedOutput(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := e.CommandContext(context.Background(), "fsck", "-a", "/dev/sdb").CombinedOutput(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	expected := []string{"mkfs/success", "fsck/failure"}
+	if len(observer.commands) != len(expected) {
+		t.Fatalf("expected commands %v, got %v", expected, observer.commands)
+	}
+	for i := range expected {
+		if observer.commands[i] != expected[i] {
+			t.Errorf("expected commands %v, got %v", expected, observer.commands)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 	"k8s.io/mount-utils"
 	"k8s.io/utils/exec"
+
+	"github.com/hetznercloud/csi-driver/internal/tracing"
 )
 
 // ResizeService resizes volumes.
@@ -17,18 +19,15 @@ type ResizeService interface {
 // LinuxResizeService resizes volumes on a Linux system.
 type LinuxResizeService struct {
 	logger     *slog.Logger
-	resizer    *mount.ResizeFs
+	exec       exec.Interface
 	cryptSetup *CryptSetup
 }
 
-func NewLinuxResizeService(logger *slog.Logger) *LinuxResizeService {
+func NewLinuxResizeService(logger *slog.Logger, observer NodeObserver) *LinuxResizeService {
 	return &LinuxResizeService{
-		logger: logger,
-		resizer: mount.NewResizeFs(mount.SafeFormatAndMount{
-			Interface: mount.New(""),
-			Exec:      exec.New(),
-		}.Exec),
-		cryptSetup: NewCryptSetup(logger),
+		logger:     logger,
+		exec:       &observedExec{Interface: exec.New(), observer: observer},
+		cryptSetup: NewCryptSetup(logger, observer),
 	}
 }
 
@@ -57,7 +56,9 @@ func (l *LinuxResizeService) Resize(ctx context.Context, volumePath string) erro
 		devicePath = luksDevicePath
 	}
 
-	if _, err := l.resizer.Resize(devicePath, volumePath); err != nil {
+	// The resize2fs or xfs_growfs commands are traced as children of ctx.
+	resizer := mount.NewResizeFs(tracing.Exec(ctx, l.exec))
+	if _, err := resizer.Resize(devicePath, volumePath); err != nil {
 		return err
 	}
 	return nil
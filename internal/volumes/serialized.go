@@ -0,0 +1,233 @@
+package volumes
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// serializedMaxRetries is the number of times an operation is retried when the
+// server is locked.
+const serializedMaxRetries = 5
+
+// SerializedService wraps a volume service and serializes attach and detach
+// operations per server.
+//
+// The API locks a server while a volume is attached or detached, so concurrent
+// operations on the same server fail with [ErrLockedServer]. Instead, the
+// operations are queued per server, and operations still failing because the
+// server is locked (e.g. by a reboot) are retried with a backoff. Identical
+// operations already in progress are coalesced, the callers share the result.
+// An operation is canceled once all of its callers gave up, so it never
+// outlives the requests waiting for it.
+//
+// Detaching a volume from any server uses the server of the volume, if it is
+// known. Otherwise it is queued per volume instead of per server, as looking up
+// the server would need an extra API call. It is still retried, if the server
+// is locked.
+type SerializedService struct {
+	logger        *slog.Logger
+	volumeService Service
+	backoff       hcloud.BackoffFunc
+
+	mu       sync.Mutex
+	queues   map[queueKey]*serverQueue
+	inflight map[operationKey]*operation
+}
+
+// queueKey identifies the queue of a server. The volume ID is only set, if the
+// server of an operation is unknown.
+type queueKey struct {
+	serverID int64
+	volumeID int64
+}
+
+type serverQueue struct {
+	lock  chan struct{}
+	users int
+}
+
+type operationKey struct {
+	kind     string
+	volumeID int64
+	serverID int64
+}
+
+type operation struct {
+	done chan struct{}
+	err  error
+
+	// callers is the number of callers waiting for the result. The operation
+	// is canceled, once it drops to zero.
+	callers int
+	cancel  context.CancelFunc
+}
+
+func NewSerializedService(logger *slog.Logger, volumeService Service, backoff hcloud.BackoffFunc) *SerializedService {
+	return &SerializedService{
+		logger:        logger,
+		volumeService: volumeService,
+		backoff:       backoff,
+		queues:        make(map[queueKey]*serverQueue),
+		inflight:      make(map[operationKey]*operation),
+	}
+}
+
+func (s *SerializedService) Create(ctx context.Context, opts CreateOpts) (*csi.Volume, error) {
+	return s.volumeService.Create(ctx, opts)
+}
+
+func (s *SerializedService) All(ctx context.Context) ([]*csi.Volume, error) {
+	return s.volumeService.All(ctx)
+}
+
+func (s *SerializedService) GetByID(ctx context.Context, id int64) (*csi.Volume, error) {
+	return s.volumeService.GetByID(ctx, id)
+}
+
+func (s *SerializedService) GetByName(ctx context.Context, name string) (*csi.Volume, error) {
+	return s.volumeService.GetByName(ctx, name)
+}
+
+func (s *SerializedService) Delete(ctx context.Context, volume *csi.Volume) error {
+	return s.volumeService.Delete(ctx, volume)
+}
+
+func (s *SerializedService) Attach(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+	key := operationKey{kind: "attach", volumeID: volume.ID, serverID: server.ID}
+	return s.run(ctx, key, queueKey{serverID: server.ID}, func(ctx context.Context) error {
+		return s.volumeService.Attach(ctx, volume, server)
+	})
+}
+
+func (s *SerializedService) Detach(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+	queue := queueKey{volumeID: volume.ID}
+	switch {
+	case server != nil:
+		queue = queueKey{serverID: server.ID}
+	case volume.Server != nil:
+		queue = queueKey{serverID: volume.Server.ID}
+	}
+
+	key := operationKey{kind: "detach", volumeID: volume.ID}
+	if server != nil {
+		key.serverID = server.ID
+	}
+	return s.run(ctx, key, queue, func(ctx context.Context) error {
+		return s.volumeService.Detach(ctx, volume, server)
+	})
+}
+
+func (s *SerializedService) Resize(ctx context.Context, volume *csi.Volume, size int) error {
+	return s.volumeService.Resize(ctx, volume, size)
+}
+
+func (s *SerializedService) UpdateLabels(ctx context.Context, volume *csi.Volume, labels map[string]string) error {
+	return s.volumeService.UpdateLabels(ctx, volume, labels)
+}
+
+func (s *SerializedService) CreateMigrationTarget(ctx context.Context, volume *csi.Volume, location string) (*csi.Volume, error) {
+	return s.volumeService.CreateMigrationTarget(ctx, volume, location)
+}
+
+// run executes fn in the queue, or waits for the result of an identical
+// operation already in progress. The operation is shared by all callers, so it
+// keeps running until the last of them gave up.
+func (s *SerializedService) run(ctx context.Context, key operationKey, qkey queueKey, fn func(ctx context.Context) error) error {
+	s.mu.Lock()
+	op, ok := s.inflight[key]
+	if ok {
+		s.logger.Debug(
+			"waiting for identical operation in progress",
+			"operation", key.kind,
+			"volume-id", key.volumeID,
+			"server-id", key.serverID,
+		)
+		op.callers++
+	} else {
+		var opCtx context.Context
+		op = &operation{done: make(chan struct{}), callers: 1}
+		opCtx, op.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		s.inflight[key] = op
+
+		queue, ok := s.queues[qkey]
+		if !ok {
+			queue = &serverQueue{lock: make(chan struct{}, 1)}
+			s.queues[qkey] = queue
+		}
+		queue.users++
+
+		go func() {
+			defer op.cancel()
+			op.err = s.runQueued(opCtx, queue, key, fn)
+
+			s.mu.Lock()
+			if s.inflight[key] == op {
+				delete(s.inflight, key)
+			}
+			queue.users--
+			if queue.users == 0 {
+				delete(s.queues, qkey)
+			}
+			s.mu.Unlock()
+
+			close(op.done)
+		}()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-op.done:
+		return op.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		op.callers--
+		if op.callers == 0 {
+			// New callers must not join the canceled operation.
+			op.cancel()
+			if s.inflight[key] == op {
+				delete(s.inflight, key)
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *SerializedService) runQueued(ctx context.Context, queue *serverQueue, key operationKey, fn func(ctx context.Context) error) error {
+	select {
+	case queue.lock <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-queue.lock }()
+
+	for retries := 0; ; retries++ {
+		err := fn(ctx)
+		if !errors.Is(err, ErrLockedServer) || retries >= serializedMaxRetries {
+			return err
+		}
+
+		backoff := s.backoff(retries)
+		s.logger.Info(
+			"server is locked, retrying",
+			"operation", key.kind,
+			"volume-id", key.volumeID,
+			"server-id", key.serverID,
+			"backoff", backoff,
+		)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package volumes_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+	"github.com/hetznercloud/csi-driver/internal/mock"
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+var _ volumes.Service = (*volumes.SerializedService)(nil)
+
+func TestSerializedServiceAttachSerializesPerServer(t *testing.T) {
+	var mu sync.Mutex
+	running := map[int64]int{}
+	maxRunning := map[int64]int{}
+
+	volumeService := &mock.VolumeService{
+		AttachFunc: func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+			mu.Lock()
+			running[server.ID]++
+			maxRunning[server.ID] = max(maxRunning[server.ID], running[server.ID])
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			running[server.ID]--
+			mu.Unlock()
+			return nil
+		},
+	}
+
+	service := volumes.NewSerializedService(slog.New(slog.DiscardHandler), volumeService, hcloud.ConstantBackoff(0))
+
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Go(func() {
+			err := service.Attach(context.Background(), &csi.Volume{ID: int64(i)}, &csi.Server{ID: int64(i % 2)})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if maxRunning[0] != 1 || maxRunning[1] != 1 {
+		t.Errorf("expected operations to be serialized per server, got %v", maxRunning)
+	}
+}
+
+func TestSerializedServiceAttachCoalesces(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	volumeService := &mock.VolumeService{
+		AttachFunc: func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+			calls.Add(1)
+			<-release
+			return nil
+		},
+	}
+
+	service := volumes.NewSerializedService(slog.New(slog.DiscardHandler), volumeService, hcloud.ConstantBackoff(0))
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Go(func() {
+			err := service.Attach(context.Background(), &csi.Volume{ID: 1}, &csi.Server{ID: 2})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Give the second caller time to join the operation in progress.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 attach call, got %d", calls.Load())
+	}
+}
+
+func TestSerializedServiceAttachRetriesLockedServer(t *testing.T) {
+	var calls int
+	volumeService := &mock.VolumeService{
+		AttachFunc: func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+			calls++
+			if calls < 3 {
+				return volumes.ErrLockedServer
+			}
+			return nil
+		},
+	}
+
+	service := volumes.NewSerializedService(slog.New(slog.DiscardHandler), volumeService, hcloud.ConstantBackoff(0))
+
+	if err := service.Attach(context.Background(), &csi.Volume{ID: 1}, &csi.Server{ID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attach calls, got %d", calls)
+	}
+}
+
+func TestSerializedServiceAttachGivesUpOnLockedServer(t *testing.T) {
+	volumeService := &mock.VolumeService{
+		AttachFunc: func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+			return volumes.ErrLockedServer
+		},
+	}
+
+	service := volumes.NewSerializedService(slog.New(slog.DiscardHandler), volumeService, hcloud.ConstantBackoff(0))
+
+	err := service.Attach(context.Background(), &csi.Volume{ID: 1}, &csi.Server{ID: 2})
+	if !errors.Is(err, volumes.ErrLockedServer) {
+		t.Fatalf("expected ErrLockedServer, got %v", err)
+	}
+}
+
+func TestSerializedServiceAttachIgnoresCanceledCaller(t *testing.T) {
+	var once sync.Once
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	volumeService := &mock.VolumeService{
+		AttachFunc: func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+			once.Do(func() { close(started) })
+			<-release
+			return ctx.Err()
+		},
+	}
+
+	service := volumes.NewSerializedService(slog.New(slog.DiscardHandler), volumeService, hcloud.ConstantBackoff(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		first <- service.Attach(ctx, &csi.Volume{ID: 1}, &csi.Server{ID: 2})
+	}()
+	<-started
+
+	second := make(chan error)
+	go func() {
+		second <- service.Attach(context.Background(), &csi.Volume{ID: 1}, &csi.Server{ID: 2})
+	}()
+	// Give the second caller time to join the operation in progress.
+	time.Sleep(10 * time.Millisecond)
+
+	// The first caller gives up, the operation continues for the second one.
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("expected operation to succeed, got %v", err)
+	}
+}
+
+func TestSerializedServiceAttachCanceledWithLastCaller(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+
+	volumeService := &mock.VolumeService{
+		AttachFunc: func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+			close(started)
+			<-ctx.Done()
+			close(canceled)
+			return ctx.Err()
+		},
+	}
+
+	service := volumes.NewSerializedService(slog.New(slog.DiscardHandler), volumeService, hcloud.ConstantBackoff(0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- service.Attach(ctx, &csi.Volume{ID: 1}, &csi.Server{ID: 2})
+	}()
+	<-started
+
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("expected the operation to be canceled")
+	}
+}
+
+func TestSerializedServiceDetachFromUnknownServerQueuesPerVolume(t *testing.T) {
+	var running atomic.Int32
+	release := make(chan struct{})
+
+	volumeService := &mock.VolumeService{
+		DetachFunc: func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+			running.Add(1)
+			<-release
+			return nil
+		},
+	}
+
+	service := volumes.NewSerializedService(slog.New(slog.DiscardHandler), volumeService, hcloud.ConstantBackoff(0))
+
+	var wg sync.WaitGroup
+	for i := range 2 {
+		wg.Go(func() {
+			if err := service.Detach(context.Background(), &csi.Volume{ID: int64(i)}, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for running.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if running.Load() != 2 {
+		t.Errorf("expected detaches of unrelated volumes to run concurrently, got %d", running.Load())
+	}
+}
+
+func TestSerializedServiceDetachFromAnyServer(t *testing.T) {
+	var detached bool
+	volumeService := &mock.VolumeService{
+		DetachFunc: func(ctx context.Context, volume *csi.Volume, server *csi.Server) error {
+			if server != nil {
+				t.Errorf("expected no server, got %v", server)
+			}
+			detached = true
+			return nil
+		},
+	}
+
+	service := volumes.NewSerializedService(slog.New(slog.DiscardHandler), volumeService, hcloud.ConstantBackoff(0))
+
+	if err := service.Detach(context.Background(), &csi.Volume{ID: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !detached {
+		t.Error("expected volume to be detached")
+	}
+}
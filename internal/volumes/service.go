@@ -3,6 +3,7 @@ package volumes
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/hetznercloud/csi-driver/internal/csi"
 )
@@ -16,6 +17,25 @@ var (
 	ErrAttachLimitReached       = errors.New("max number of attachments per server reached")
 	ErrLockedServer             = errors.New("server is locked")
 	ErrVolumeSizeAlreadyReached = errors.New("volume size is already larger or equal than the requested size")
+	ErrResourceUnavailable      = errors.New("resource is currently unavailable in location")
+	ErrSameLocation             = errors.New("volume is already in the requested location")
+
+	// ErrVolumeInOtherLocation is returned, when a volume with the same name
+	// already exists in another location, e.g. created by a previous attempt
+	// in a fallback location. It matches ErrVolumeAlreadyExists.
+	ErrVolumeInOtherLocation = fmt.Errorf("%w in another location", ErrVolumeAlreadyExists)
+)
+
+// LabelKeyRequestName is the label used to track the volume name requested by
+// the container orchestration system, when the volume was created with a
+// different name.
+const LabelKeyRequestName = "request-name"
+
+// LabelKeyMigratedFrom and LabelKeyMigratedTo link the source and target volume
+// of a migration to another location.
+const (
+	LabelKeyMigratedFrom = "migrated-from"
+	LabelKeyMigratedTo   = "migrated-to"
 )
 
 type Service interface {
@@ -23,10 +43,14 @@ type Service interface {
 	GetByID(ctx context.Context, id int64) (*csi.Volume, error)
 	GetByName(ctx context.Context, name string) (*csi.Volume, error)
 	Delete(ctx context.Context, volume *csi.Volume) error
+	// Attach updates the volume to its state after it was attached.
 	Attach(ctx context.Context, volume *csi.Volume, server *csi.Server) error
 	Detach(ctx context.Context, volume *csi.Volume, server *csi.Server) error
+	// Resize updates the volume to its state after it was resized.
 	Resize(ctx context.Context, volume *csi.Volume, size int) error
 	All(ctx context.Context) ([]*csi.Volume, error)
+	UpdateLabels(ctx context.Context, volume *csi.Volume, labels map[string]string) error
+	CreateMigrationTarget(ctx context.Context, volume *csi.Volume, location string) (*csi.Volume, error)
 }
 
 // CreateOpts specifies the options for creating a volume.
@@ -0,0 +1,68 @@
+package volumes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Tool is a command, which the node plugin needs to publish and resize
+// volumes.
+type Tool struct {
+	Name string
+	// VersionArgs print the version of the tool. The version is not checked,
+	// if they are empty.
+	VersionArgs []string
+}
+
+// RequiredTools are the tools, which must be installed on the node.
+var RequiredTools = []Tool{
+	{Name: cryptsetupExecuable, VersionArgs: []string{"--version"}},
+	{Name: "mkfs.ext4", VersionArgs: []string{"-V"}},
+	{Name: "mkfs.xfs", VersionArgs: []string{"-V"}},
+	{Name: "blkid", VersionArgs: []string{"-V"}},
+	// resize2fs has no version flag, it is part of e2fsprogs like mkfs.ext4.
+	{Name: "resize2fs"},
+	{Name: "xfs_growfs", VersionArgs: []string{"-V"}},
+	// mount, umount and fsck are used by k8s.io/mount-utils. They may be
+	// provided by busybox, which has no version flag.
+	{Name: "mount"},
+	{Name: "umount"},
+	{Name: "fsck"},
+}
+
+// ToolVersion is an installed tool and its version.
+type ToolVersion struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Version string `json:"version,omitempty"`
+}
+
+// CheckTools looks up the tools and their versions. It returns the tools,
+// which were found, and an error for each tool, which is missing or could not
+// report its version.
+func CheckTools(ctx context.Context, tools []Tool) ([]ToolVersion, error) {
+	var found []ToolVersion
+	var errs []error
+	for _, tool := range tools {
+		path, err := exec.LookPath(tool.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s not found: %w", tool.Name, err))
+			continue
+		}
+
+		version := ToolVersion{Name: tool.Name, Path: path}
+		if len(tool.VersionArgs) > 0 {
+			output, err := exec.CommandContext(ctx, path, tool.VersionArgs...).CombinedOutput()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get version of %s: %w", tool.Name, err))
+				continue
+			}
+			version.Version, _, _ = strings.Cut(strings.TrimSpace(string(output)), "\n")
+		}
+		found = append(found, version)
+	}
+	return found, errors.Join(errs...)
+}
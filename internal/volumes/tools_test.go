@@ -0,0 +1,34 @@
+package volumes_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hetznercloud/csi-driver/internal/volumes"
+)
+
+func TestCheckTools(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"cryptsetup 2.7.0\"\necho \"more output\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "cryptsetup"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	versions, err := volumes.CheckTools(context.Background(), []volumes.Tool{
+		{Name: "cryptsetup", VersionArgs: []string{"--version"}},
+		{Name: "mkfs.ext4", VersionArgs: []string{"-V"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "mkfs.ext4 not found") {
+		t.Errorf("expected error about missing mkfs.ext4, got %v", err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("expected one tool, got %v", versions)
+	}
+	if versions[0].Version != "cryptsetup 2.7.0" {
+		t.Errorf("unexpected version: %q", versions[0].Version)
+	}
+}
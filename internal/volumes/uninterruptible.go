@@ -0,0 +1,99 @@
+package volumes
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrShuttingDown is returned instead of starting a command, which must not be
+// interrupted, once the driver is shutting down.
+var ErrShuttingDown = errors.New("driver is shutting down")
+
+// uninterruptible tracks the running commands, which must not be interrupted,
+// e.g. luksFormat or mkfs. Killing them could leave a corrupted LUKS header or
+// file system on the volume.
+var uninterruptible struct {
+	mu           sync.Mutex
+	nextID       uint64
+	running      map[uint64]string
+	shuttingDown bool
+}
+
+// startUninterruptible marks the start of a command, which must not be
+// interrupted, e.g. "mkfs /dev/sdb". The returned function marks its end. It
+// fails with ErrShuttingDown, once RefuseUninterruptibleCommands was called, as
+// the shutdown may not wait for the command anymore.
+func startUninterruptible(command string) (func(), error) {
+	uninterruptible.mu.Lock()
+	defer uninterruptible.mu.Unlock()
+
+	if uninterruptible.shuttingDown {
+		return nil, ErrShuttingDown
+	}
+	if uninterruptible.running == nil {
+		uninterruptible.running = make(map[uint64]string)
+	}
+	id := uninterruptible.nextID
+	uninterruptible.nextID++
+	uninterruptible.running[id] = command
+	return func() {
+		uninterruptible.mu.Lock()
+		defer uninterruptible.mu.Unlock()
+		delete(uninterruptible.running, id)
+	}, nil
+}
+
+// RefuseUninterruptibleCommands prevents new commands, which must not be
+// interrupted, from starting and returns the number of running ones. Request
+// handlers may keep running after their requests were canceled, so a shutdown
+// must call it before waiting for the running commands.
+func RefuseUninterruptibleCommands() int64 {
+	uninterruptible.mu.Lock()
+	defer uninterruptible.mu.Unlock()
+
+	uninterruptible.shuttingDown = true
+	return int64(len(uninterruptible.running))
+}
+
+// RunningUninterruptibleCommands returns the number of running commands, which
+// must not be interrupted.
+func RunningUninterruptibleCommands() int64 {
+	uninterruptible.mu.Lock()
+	defer uninterruptible.mu.Unlock()
+
+	return int64(len(uninterruptible.running))
+}
+
+// UninterruptibleCommands returns the sorted running commands, which must not
+// be interrupted.
+func UninterruptibleCommands() []string {
+	uninterruptible.mu.Lock()
+	defer uninterruptible.mu.Unlock()
+
+	commands := make([]string, 0, len(uninterruptible.running))
+	for _, command := range uninterruptible.running {
+		commands = append(commands, command)
+	}
+	slices.Sort(commands)
+	return commands
+}
+
+// WaitForUninterruptibleCommands waits until all commands, which must not be
+// interrupted, finished, or the context is canceled. The process should not
+// exit before, e.g. during a shutdown.
+func WaitForUninterruptibleCommands(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for RunningUninterruptibleCommands() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package volumes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitForUninterruptibleCommands(t *testing.T) {
+	done, err := startUninterruptible("mkfs /dev/sdb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := RunningUninterruptibleCommands(); n != 1 {
+		t.Fatalf("expected 1 running command, got %d", n)
+	}
+	if commands := UninterruptibleCommands(); len(commands) != 1 || commands[0] != "mkfs /dev/sdb" {
+		t.Fatalf("unexpected running commands: %v", commands)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := WaitForUninterruptibleCommands(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, done)
+	if err := WaitForUninterruptibleCommands(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := RunningUninterruptibleCommands(); n != 0 {
+		t.Fatalf("expected no running commands, got %d", n)
+	}
+}
+
+func TestRefuseUninterruptibleCommands(t *testing.T) {
+	t.Cleanup(func() { uninterruptible.shuttingDown = false })
+
+	done, err := startUninterruptible("cryptsetup luksFormat /dev/sdb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := RefuseUninterruptibleCommands(); n != 1 {
+		t.Fatalf("expected 1 running command, got %d", n)
+	}
+	if _, err := startUninterruptible("mkfs /dev/sdc"); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("expected ErrShuttingDown, got %v", err)
+	}
+
+	done()
+	if n := RunningUninterruptibleCommands(); n != 0 {
+		t.Fatalf("expected no running commands, got %d", n)
+	}
+}
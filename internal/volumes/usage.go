@@ -0,0 +1,134 @@
+package volumes
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"k8s.io/mount-utils"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+)
+
+const mountInfoPath = "/proc/self/mountinfo"
+
+// UsageObserver receives the usage of all published volumes after each scan.
+type UsageObserver interface {
+	ObserveVolumeUsage(usage []csi.VolumeUsage)
+}
+
+// volumeDevice is a device in the mount table, which belongs to a volume.
+type volumeDevice struct {
+	volumeID  string
+	encrypted bool
+}
+
+// UsageScanner periodically scans the mount table for published volumes and
+// reports their usage. Unlike NodeGetVolumeStats, which is only called by the
+// kubelet, this works for every container orchestrator.
+type UsageScanner struct {
+	logger   *slog.Logger
+	stats    StatsService
+	observer UsageObserver
+
+	mounts  func() ([]mount.MountInfo, error)
+	devices func() map[string]volumeDevice
+}
+
+func NewUsageScanner(logger *slog.Logger, stats StatsService, observer UsageObserver) *UsageScanner {
+	return &UsageScanner{
+		logger:   logger,
+		stats:    stats,
+		observer: observer,
+		mounts:   func() ([]mount.MountInfo, error) { return mount.ParseMountInfo(mountInfoPath) },
+		devices:  volumeDevices,
+	}
+}
+
+// Run scans the volume usage every interval until the context is canceled.
+func (s *UsageScanner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		usage, err := s.Scan()
+		if err != nil {
+			s.logger.Error("failed to scan volume usage", "err", err)
+		} else {
+			s.observer.ObserveVolumeUsage(usage)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan returns the usage of the volumes in the mount table. Volumes published
+// as block devices are skipped, as they have no file system to inspect.
+func (s *UsageScanner) Scan() ([]csi.VolumeUsage, error) {
+	mounts, err := s.mounts()
+	if err != nil {
+		return nil, err
+	}
+	devices := s.devices()
+
+	var result []csi.VolumeUsage
+	for _, m := range mounts {
+		device, ok := devices[m.Source]
+		if !ok {
+			// The mount table may contain the resolved path of the device,
+			// e.g. /dev/dm-0 instead of /dev/mapper/<name>.
+			resolved, err := filepath.EvalSymlinks(m.Source)
+			if err != nil {
+				continue
+			}
+			if device, ok = devices[resolved]; !ok {
+				continue
+			}
+		}
+
+		usage := csi.VolumeUsage{
+			VolumeID:   device.volumeID,
+			TargetPath: m.MountPoint,
+			FSType:     m.FsType,
+			ReadOnly:   slices.Contains(m.MountOptions, "ro"),
+			Encrypted:  device.encrypted,
+		}
+		_, usage.AvailableBytes, usage.UsedBytes, err = s.stats.ByteFilesystemStats(m.MountPoint)
+		if err != nil {
+			s.logger.Warn("failed to get volume usage", "volume-id", device.volumeID, "target-path", m.MountPoint, "err", err)
+			continue
+		}
+		_, usage.UsedINodes, usage.FreeINodes, err = s.stats.INodeFilesystemStats(m.MountPoint)
+		if err != nil {
+			s.logger.Warn("failed to get volume inodes", "volume-id", device.volumeID, "target-path", m.MountPoint, "err", err)
+			continue
+		}
+		result = append(result, usage)
+	}
+	return result, nil
+}
+
+// volumeDevices returns the devices of the attached volumes, keyed by all
+// paths they might appear with in the mount table: the by-id path, the
+// resolved device path, and the same for the opened LUKS device.
+func volumeDevices() map[string]volumeDevice {
+	devices := make(map[string]volumeDevice)
+	add := func(path string, device volumeDevice) {
+		devices[path] = device
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			devices[resolved] = device
+		}
+	}
+
+	for path, volumeID := range attachedVolumeDevices() {
+		add(path, volumeDevice{volumeID: volumeID})
+		add(GenerateLUKSDevicePath(GenerateLUKSDeviceName(path)), volumeDevice{volumeID: volumeID, encrypted: true})
+	}
+	return devices
+}
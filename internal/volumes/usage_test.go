@@ -0,0 +1,67 @@
+package volumes
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"k8s.io/mount-utils"
+
+	"github.com/hetznercloud/csi-driver/internal/csi"
+)
+
+type fakeStatsService struct{}
+
+func (fakeStatsService) ByteFilesystemStats(volumePath string) (int64, int64, int64, error) {
+	if volumePath == "/broken" {
+		return 0, 0, 0, errors.New("statfs failed")
+	}
+	return 100, 60, 40, nil
+}
+
+func (fakeStatsService) INodeFilesystemStats(string) (int64, int64, int64, error) {
+	return 10, 3, 7, nil
+}
+
+func TestUsageScannerScan(t *testing.T) {
+	scanner := NewUsageScanner(slog.New(slog.DiscardHandler), fakeStatsService{}, nil)
+	scanner.mounts = func() ([]mount.MountInfo, error) {
+		return []mount.MountInfo{
+			{Source: "/dev/sda1", MountPoint: "/", FsType: "ext4"},
+			{Source: "/dev/sdb", MountPoint: "/var/lib/kubelet/pods/a/volumes/pvc-1", FsType: "ext4", MountOptions: []string{"rw", "relatime"}},
+			{Source: "/dev/mapper/scsi-0HC_Volume_2", MountPoint: "/var/lib/kubelet/pods/b/volumes/pvc-2", FsType: "xfs", MountOptions: []string{"ro"}},
+			{Source: "/dev/sdd", MountPoint: "/broken", FsType: "ext4"},
+		}, nil
+	}
+	scanner.devices = func() map[string]volumeDevice {
+		return map[string]volumeDevice{
+			"/dev/sdb":                      {volumeID: "1"},
+			"/dev/mapper/scsi-0HC_Volume_2": {volumeID: "2", encrypted: true},
+			"/dev/sdd":                      {volumeID: "3"},
+		}
+	}
+
+	usage, err := scanner.Scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []csi.VolumeUsage{
+		{
+			VolumeID: "1", TargetPath: "/var/lib/kubelet/pods/a/volumes/pvc-1", FSType: "ext4",
+			UsedBytes: 40, AvailableBytes: 60, UsedINodes: 3, FreeINodes: 7,
+		},
+		{
+			VolumeID: "2", TargetPath: "/var/lib/kubelet/pods/b/volumes/pvc-2", FSType: "xfs", ReadOnly: true, Encrypted: true,
+			UsedBytes: 40, AvailableBytes: 60, UsedINodes: 3, FreeINodes: 7,
+		},
+	}
+	if len(usage) != len(expected) {
+		t.Fatalf("expected usage %+v, got %+v", expected, usage)
+	}
+	for i := range expected {
+		if usage[i] != expected[i] {
+			t.Errorf("expected usage %+v, got %+v", expected[i], usage[i])
+		}
+	}
+}
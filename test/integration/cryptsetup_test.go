@@ -16,7 +16,7 @@ func TestCryptSetup(t *testing.T) {
 	}
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	cryptSetup := volumes.NewCryptSetup(logger)
+	cryptSetup := volumes.NewCryptSetup(logger, nil)
 	name := "fake"
 	device, err := createFakeDevice(name, 32)
 	if err != nil {
@@ -16,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/hetznercloud/csi-driver/internal/app"
+	"github.com/hetznercloud/csi-driver/internal/config"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/kit/randutil"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/metadata"
@@ -55,27 +56,35 @@ func TestGetServerLocation(t *testing.T) {
 
 	t.Run("location env", func(t *testing.T) {
 		t.Setenv("HCLOUD_VOLUME_DEFAULT_LOCATION", "hel1")
-		loc, err := app.GetServerLocation(t.Context(), slog.New(slog.DiscardHandler), metadataClient, client, false)
+		cfg, err := config.Load("")
+		require.NoError(t, err)
+		loc, err := app.GetServerLocation(t.Context(), slog.New(slog.DiscardHandler), cfg, metadataClient, client, false)
 		require.NoError(t, err)
 		assert.Equal(t, "hel1", loc)
 	})
 
 	t.Run("server ID env", func(t *testing.T) {
 		t.Setenv("HCLOUD_SERVER_ID", strconv.FormatInt(result.Server.ID, 10))
-		loc, err := app.GetServerLocation(t.Context(), slog.New(slog.DiscardHandler), metadataClient, client, true)
+		cfg, err := config.Load("")
+		require.NoError(t, err)
+		loc, err := app.GetServerLocation(t.Context(), slog.New(slog.DiscardHandler), cfg, metadataClient, client, true)
 		require.NoError(t, err)
 		assert.Equal(t, "hel1", loc)
 	})
 
 	t.Run("node name env", func(t *testing.T) {
 		t.Setenv("KUBE_NODE_NAME", serverName)
-		loc, err := app.GetServerLocation(t.Context(), slog.New(slog.DiscardHandler), metadataClient, client, true)
+		cfg, err := config.Load("")
+		require.NoError(t, err)
+		loc, err := app.GetServerLocation(t.Context(), slog.New(slog.DiscardHandler), cfg, metadataClient, client, true)
 		require.NoError(t, err)
 		assert.Equal(t, "hel1", loc)
 	})
 
 	t.Run("metadata service", func(t *testing.T) {
-		loc, err := app.GetServerLocation(t.Context(), slog.New(slog.DiscardHandler), metadataClient, client, false)
+		cfg, err := config.Load("")
+		require.NoError(t, err)
+		loc, err := app.GetServerLocation(t.Context(), slog.New(slog.DiscardHandler), cfg, metadataClient, client, false)
 		require.NoError(t, err)
 		assert.Equal(t, "hel1", loc)
 	})
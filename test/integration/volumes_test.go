@@ -106,12 +106,12 @@ func TestVolumePublishUnpublish(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			ctx := t.Context()
 			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-			mountService := volumes.NewLinuxMountService(logger)
+			mountService := volumes.NewLinuxMountService(logger, nil)
 			mounter := &mount.SafeFormatAndMount{
 				Interface: mount.New(""),
 				Exec:      exec.New(),
 			}
-			cryptSetup := volumes.NewCryptSetup(logger)
+			cryptSetup := volumes.NewCryptSetup(logger, nil)
 			device, err := createFakeDevice("fake-"+test.name, 512)
 			if err != nil {
 				t.Fatal(err)
@@ -224,9 +224,9 @@ func TestVolumeResize(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			ctx := t.Context()
 			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-			mountService := volumes.NewLinuxMountService(logger)
-			resizeService := volumes.NewLinuxResizeService(logger)
-			cryptSetup := volumes.NewCryptSetup(logger)
+			mountService := volumes.NewLinuxMountService(logger, nil)
+			resizeService := volumes.NewLinuxResizeService(logger, nil)
+			cryptSetup := volumes.NewCryptSetup(logger, nil)
 			deviceName := "fake-" + test.name
 			device, err := createFakeDevice(deviceName, 512)
 			if err != nil {
@@ -328,7 +328,7 @@ func TestDetectDiskFormat(t *testing.T) {
 			name: "crypto_LUKS",
 			prepare: func(ctx context.Context, mounter *mount.SafeFormatAndMount, device string) error {
 				logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-				cryptSetup := volumes.NewCryptSetup(logger)
+				cryptSetup := volumes.NewCryptSetup(logger, nil)
 				err := cryptSetup.Format(ctx, device, "passphrase")
 				return err
 			},